@@ -28,6 +28,13 @@ type Event struct {
 
 	EventType string `json:"eventType"`
 
+	// Tenant is the AlphaSOC Engine account the event was polled from,
+	// empty for the default account.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Incident is set for incident records written by Correlator.
+	Incident *Incident `json:"incident,omitempty"`
+
 	client.EventUnified
 }
 
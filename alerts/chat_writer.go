@@ -0,0 +1,501 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/client"
+)
+
+// Supported chat webhook types.
+const (
+	ChatSlack      = "slack"
+	ChatMattermost = "mattermost"
+	ChatTeams      = "teams"
+)
+
+// Supported Microsoft Teams card formats.
+const (
+	TeamsMessageCard  = "messagecard"
+	TeamsAdaptiveCard = "adaptive"
+)
+
+// ChatConfig keeps configuration of a single chat channel.
+type ChatConfig struct {
+	// Name of the channel used in logs.
+	Name string
+
+	// Type of the webhook: slack, mattermost or teams.
+	Type string
+
+	// Incoming webhook url.
+	WebhookURL string
+
+	// Channel and username overrides for slack compatible webhooks.
+	Channel  string
+	Username string
+
+	// Card format used for teams: messagecard or adaptive.
+	Card string
+
+	// Only alerts with at least this severity are posted.
+	MinSeverity int
+
+	// Maximum number of messages posted per minute and the size of a burst.
+	// Zero rate disables limiting.
+	RateLimit int
+	Burst     int
+}
+
+// ChatWriter implements Writer interface and posts alerts
+// to slack, mattermost or teams incoming webhooks. Alerts are posted
+// in background, so a slow webhook doesn't block other writers.
+// Close posts queued alerts.
+type ChatWriter struct {
+	cfg     ChatConfig
+	client  *http.Client
+	limiter *rateLimiter
+
+	mx         sync.Mutex
+	suppressed int
+
+	// queue of alerts posted by run, closed by Close.
+	queue   chan chatAlert
+	closed  bool
+	stopped chan struct{}
+}
+
+// chatAlert is a queued alert with number of alerts suppressed before.
+type chatAlert struct {
+	event      *Event
+	suppressed int
+}
+
+// chatQueueSize is max number of alerts queued for posting.
+const chatQueueSize = 256
+
+// NewChatWriter creates new chat writer.
+func NewChatWriter(cfg ChatConfig) (*ChatWriter, error) {
+	switch cfg.Type {
+	case ChatSlack, ChatMattermost:
+	case ChatTeams:
+		if cfg.Card == "" {
+			cfg.Card = TeamsMessageCard
+		}
+		if cfg.Card != TeamsMessageCard && cfg.Card != TeamsAdaptiveCard {
+			return nil, fmt.Errorf("unsupported teams card format %s", cfg.Card)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported chat type %s", cfg.Type)
+	}
+
+	u, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s webhook url: %s", cfg.Type, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s webhook url %s", cfg.Type, cfg.WebhookURL)
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+
+	w := &ChatWriter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		queue:   make(chan chatAlert, chatQueueSize),
+		stopped: make(chan struct{}),
+	}
+	if cfg.RateLimit > 0 {
+		w.limiter = newRateLimiter(cfg.RateLimit, cfg.Burst, time.Now)
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write queues alert for posting to the chat channel. Alerts exceeding
+// the channel rate limit or the queue size are dropped and reported
+// with the next posted message. Failed posts are logged, not returned,
+// so they don't stop writing alerts to other outputs.
+func (w *ChatWriter) Write(event *Event) error {
+	if event.Severity < w.cfg.MinSeverity {
+		return nil
+	}
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.closed {
+		return fmt.Errorf("%s chat writer is closed, alert dropped", w.cfg.Name)
+	}
+	if w.limiter != nil && !w.limiter.allow() {
+		if w.suppressed == 0 {
+			log.Warnf("%s chat rate limit reached, suppressing alerts", w.cfg.Name)
+		}
+		w.suppressed++
+		return nil
+	}
+	ev := *event
+	select {
+	case w.queue <- chatAlert{&ev, w.suppressed}:
+		w.suppressed = 0
+	default:
+		if w.suppressed == 0 {
+			log.Warnf("%s chat queue is full, suppressing alerts", w.cfg.Name)
+		}
+		w.suppressed++
+	}
+	return nil
+}
+
+// run posts queued alerts until the writer is closed.
+func (w *ChatWriter) run() {
+	defer close(w.stopped)
+	for a := range w.queue {
+		var payload interface{}
+		switch {
+		case w.cfg.Type != ChatTeams:
+			payload = w.slackMessage(a.event, a.suppressed)
+		case w.cfg.Card == TeamsAdaptiveCard:
+			payload = teamsAdaptiveCard(a.event, a.suppressed)
+		default:
+			payload = teamsMessageCard(a.event, a.suppressed)
+		}
+		if err := w.post(payload); err != nil {
+			log.Errorf("posting chat alert failed: %s", err)
+		}
+	}
+}
+
+// Close posts queued alerts and stops the writer.
+func (w *ChatWriter) Close() error {
+	w.mx.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mx.Unlock()
+	<-w.stopped
+	return nil
+}
+
+// post sends json payload to the webhook.
+func (w *ChatWriter) post(payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.cfg.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", client.DefaultUserAgent)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s webhook request failed: %s", w.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+	defer io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s webhook returned %s: %s", w.cfg.Name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// chatFact is a single name - value pair displayed in chat message.
+type chatFact struct {
+	Name  string
+	Value string
+}
+
+// chatFacts returns facts describing the event.
+func chatFacts(event *Event) []chatFact {
+	facts := []chatFact{
+		{"Severity", strconv.Itoa(event.Severity)},
+		{"Source", eventSource(event)},
+	}
+	if groups := eventGroups(event); groups != "" {
+		facts = append(facts, chatFact{"Group", groups})
+	}
+	if event.Tenant != "" {
+		facts = append(facts, chatFact{"Tenant", event.Tenant})
+	}
+
+	switch event.EventType {
+	case "dns":
+		query := event.Query
+		if event.QueryType != "" {
+			query += " (" + event.QueryType + ")"
+		}
+		facts = append(facts, chatFact{"Query", query})
+	case "http":
+		facts = append(facts, chatFact{"URL", event.URL})
+	case "incident":
+		inc := event.Incident
+		facts = append(facts,
+			chatFact{"Incident", inc.ID + " (" + inc.Status + ")"},
+			chatFact{"Alerts", strconv.Itoa(inc.Events) + " " + strings.Join(inc.EventTypes, ", ")},
+		)
+		if len(inc.Targets) > 0 {
+			facts = append(facts, chatFact{"Targets", strings.Join(inc.Targets, ", ")})
+		}
+	default:
+		if target := eventTarget(event); target != "" {
+			if event.Proto != "" {
+				target += "/" + event.Proto
+			}
+			facts = append(facts, chatFact{"Destination", target})
+		}
+		if event.Ja3 != "" {
+			facts = append(facts, chatFact{"JA3", event.Ja3})
+		}
+	}
+
+	if threats := eventThreats(event); len(threats) > 1 {
+		facts = append(facts, chatFact{"Threats", strings.Join(threats, "; ")})
+	}
+	if !event.Timestamp.IsZero() {
+		facts = append(facts, chatFact{"Time", event.Timestamp.UTC().Format(time.RFC3339)})
+	}
+	return facts
+}
+
+// eventGroups returns comma separated list of event group labels.
+func eventGroups(event *Event) string {
+	var labels []string
+	for _, g := range event.Groups {
+		if g.Label != "" {
+			labels = append(labels, g.Label)
+		}
+	}
+	return strings.Join(labels, ", ")
+}
+
+// eventThreats returns sorted descriptions of all event threats.
+func eventThreats(event *Event) []string {
+	var threats []string
+	for tid, threat := range event.Threats {
+		if threat.Description != "" {
+			threats = append(threats, threat.Description)
+		} else {
+			threats = append(threats, tid)
+		}
+	}
+	sort.Strings(threats)
+	return threats
+}
+
+// severityColor returns color of the message attachment for given severity.
+func severityColor(severity int) string {
+	switch {
+	case severity >= 4:
+		return "#d50200"
+	case severity == 3:
+		return "#de9e31"
+	default:
+		return "#2fa44f"
+	}
+}
+
+// suppressedNote returns text about alerts dropped by the rate limiter.
+func suppressedNote(suppressed int) string {
+	if suppressed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d more alerts were suppressed by the rate limit", suppressed)
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Fields   []slackField `json:"fields"`
+	Footer   string       `json:"footer,omitempty"`
+	Ts       int64        `json:"ts,omitempty"`
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// slackMessage builds slack (and mattermost) compatible message.
+func (w *ChatWriter) slackMessage(event *Event, suppressed int) *slackMessage {
+	title := eventTitle(event)
+	text := fmt.Sprintf("AlphaSOC NFR alert: %s from %s", title, eventSource(event))
+
+	a := slackAttachment{
+		Fallback: text,
+		Color:    severityColor(event.Severity),
+		Title:    title,
+		Footer:   suppressedNote(suppressed),
+	}
+	for _, f := range chatFacts(event) {
+		a.Fields = append(a.Fields, slackField{
+			Title: f.Name,
+			Value: f.Value,
+			Short: f.Name != "URL" && f.Name != "Threats" && f.Name != "Targets",
+		})
+	}
+	if !event.Timestamp.IsZero() {
+		a.Ts = event.Timestamp.Unix()
+	}
+
+	return &slackMessage{
+		Text:        text,
+		Channel:     w.cfg.Channel,
+		Username:    w.cfg.Username,
+		Attachments: []slackAttachment{a},
+	}
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+	Text  string      `json:"text,omitempty"`
+}
+
+type teamsCard struct {
+	Type       string         `json:"@type"`
+	Context    string         `json:"@context"`
+	ThemeColor string         `json:"themeColor"`
+	Summary    string         `json:"summary"`
+	Title      string         `json:"title"`
+	Sections   []teamsSection `json:"sections"`
+}
+
+// teamsMessageCard builds teams legacy MessageCard.
+func teamsMessageCard(event *Event, suppressed int) *teamsCard {
+	title := eventTitle(event)
+	section := teamsSection{Text: suppressedNote(suppressed)}
+	for _, f := range chatFacts(event) {
+		section.Facts = append(section.Facts, teamsFact{f.Name, f.Value})
+	}
+
+	return &teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: strings.TrimPrefix(severityColor(event.Severity), "#"),
+		Summary:    fmt.Sprintf("AlphaSOC NFR alert: %s from %s", title, eventSource(event)),
+		Title:      title,
+		Sections:   []teamsSection{section},
+	}
+}
+
+// teamsAdaptiveCard builds teams message with adaptive card attachment.
+func teamsAdaptiveCard(event *Event, suppressed int) map[string]interface{} {
+	var facts []map[string]string
+	for _, f := range chatFacts(event) {
+		facts = append(facts, map[string]string{"title": f.Name, "value": f.Value})
+	}
+
+	color := "Good"
+	if event.Severity >= 4 {
+		color = "Attention"
+	} else if event.Severity == 3 {
+		color = "Warning"
+	}
+
+	body := []map[string]interface{}{
+		{
+			"type":   "TextBlock",
+			"text":   eventTitle(event),
+			"weight": "Bolder",
+			"size":   "Medium",
+			"color":  color,
+			"wrap":   true,
+		},
+		{
+			"type":  "FactSet",
+			"facts": facts,
+		},
+	}
+	if note := suppressedNote(suppressed); note != "" {
+		body = append(body, map[string]interface{}{
+			"type":     "TextBlock",
+			"text":     note,
+			"isSubtle": true,
+			"wrap":     true,
+		})
+	}
+
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": map[string]interface{}{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.2",
+					"body":    body,
+				},
+			},
+		},
+	}
+}
+
+// rateLimiter is a token bucket allowing rate events per minute.
+type rateLimiter struct {
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter(perMinute, burst int, now func() time.Time) *rateLimiter {
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &rateLimiter{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// allow reports whether an event may happen now and consumes a token.
+func (l *rateLimiter) allow() bool {
+	now := l.now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,184 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookStandIn records bodies posted to the webhook.
+type webhookStandIn struct {
+	*httptest.Server
+
+	mx     sync.Mutex
+	bodies []string
+}
+
+func newWebhookStandIn(status int) *webhookStandIn {
+	s := &webhookStandIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		s.mx.Lock()
+		s.bodies = append(s.bodies, string(b))
+		s.mx.Unlock()
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *webhookStandIn) received() []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func TestChatWriterSlack(t *testing.T) {
+	s := newWebhookStandIn(http.StatusOK)
+	defer s.Close()
+
+	w, err := NewChatWriter(ChatConfig{Type: ChatSlack, WebhookURL: s.URL, Channel: "#soc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "virus.com")
+	ev.Groups = []Group{{Label: "office"}}
+	if err := w.Write(ev); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	bodies := s.received()
+	if len(bodies) != 1 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", len(bodies), 1)
+	}
+	var msg slackMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Channel != "#soc" || len(msg.Attachments) != 1 {
+		t.Fatalf("invalid slack message %s", bodies[0])
+	}
+	a := msg.Attachments[0]
+	if a.Title != "Desc c2_communication" || a.Color != severityColor(5) {
+		t.Fatalf("invalid slack attachment %s", bodies[0])
+	}
+	var fields []string
+	for _, f := range a.Fields {
+		fields = append(fields, f.Title+"="+f.Value)
+	}
+	expected := "Severity=5,Source=10.0.0.1,Group=office,Query=virus.com (A),Time=2018-09-06T14:09:04Z"
+	if got := strings.Join(fields, ","); got != expected {
+		t.Fatalf("invalid slack fields - got %s; expected %s", got, expected)
+	}
+}
+
+func TestChatWriterTeams(t *testing.T) {
+	s := newWebhookStandIn(http.StatusOK)
+	defer s.Close()
+
+	ev := testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "")
+	ev.EventType = "ip"
+	ev.DestIP = net.IPv4(1, 2, 3, 4)
+	ev.DestPort = 443
+	ev.Proto = "tcp"
+
+	for _, card := range []string{TeamsMessageCard, TeamsAdaptiveCard} {
+		w, err := NewChatWriter(ChatConfig{Type: ChatTeams, WebhookURL: s.URL, Card: card})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+
+	bodies := s.received()
+	if len(bodies) != 2 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", len(bodies), 2)
+	}
+	if !strings.Contains(bodies[0], `"@type":"MessageCard"`) ||
+		!strings.Contains(bodies[0], `{"name":"Destination","value":"1.2.3.4:443/tcp"}`) {
+		t.Fatalf("invalid teams message card %s", bodies[0])
+	}
+	if !strings.Contains(bodies[1], `"type":"AdaptiveCard"`) ||
+		!strings.Contains(bodies[1], `{"title":"Destination","value":"1.2.3.4:443/tcp"}`) {
+		t.Fatalf("invalid teams adaptive card %s", bodies[1])
+	}
+}
+
+func TestChatWriterRateLimit(t *testing.T) {
+	s := newWebhookStandIn(http.StatusOK)
+	defer s.Close()
+
+	w, err := NewChatWriter(ChatConfig{Type: ChatMattermost, WebhookURL: s.URL, RateLimit: 60, Burst: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	w.limiter.now = func() time.Time { return now }
+	w.limiter.last = now
+
+	ev := testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "virus.com")
+	for i := 0; i < 5; i++ {
+		w.Write(ev)
+	}
+	w.mx.Lock()
+	suppressed := w.suppressed
+	w.mx.Unlock()
+	if suppressed != 3 {
+		t.Fatalf("rate limit not applied - got %d suppressed alerts; expected %d", suppressed, 3)
+	}
+
+	now = now.Add(time.Second)
+	w.Write(ev)
+	w.Close()
+	bodies := s.received()
+	if len(bodies) != 3 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", len(bodies), 3)
+	}
+	if !strings.Contains(bodies[2], "3 more alerts were suppressed") {
+		t.Fatalf("missing suppressed alerts note in %s", bodies[2])
+	}
+}
+
+func TestChatWriterError(t *testing.T) {
+	s := newWebhookStandIn(http.StatusTooManyRequests)
+	defer s.Close()
+
+	w, err := NewChatWriter(ChatConfig{Type: ChatSlack, WebhookURL: s.URL, MinSeverity: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "a.com")); err != nil {
+		t.Fatalf("alert below min severity must be skipped - got %s", err)
+	}
+	// failed posts must not fail writing to other outputs
+	if err := w.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "a.com")); err != nil {
+		t.Fatalf("webhook error returned by write: %s", err)
+	}
+	w.Close()
+	if n := len(s.received()); n != 1 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", n, 1)
+	}
+	if err := w.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "a.com")); err == nil {
+		t.Fatal("expected error of closed writer")
+	}
+
+	if _, err := NewChatWriter(ChatConfig{Type: "irc", WebhookURL: s.URL}); err == nil {
+		t.Fatal("expected unsupported type error")
+	}
+	if _, err := NewChatWriter(ChatConfig{Type: ChatTeams, WebhookURL: s.URL, Card: "hero"}); err == nil {
+		t.Fatal("expected unsupported card error")
+	}
+	if _, err := NewChatWriter(ChatConfig{Type: ChatSlack, WebhookURL: "hooks.slack.com"}); err == nil {
+		t.Fatal("expected invalid url error")
+	}
+}
@@ -0,0 +1,655 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/utils"
+)
+
+// EmailConfig keeps configuration of email writer.
+type EmailConfig struct {
+	// SMTP relay host and port. If port is not set, port 587 with
+	// required STARTTLS is used.
+	Host string
+	Port int
+
+	// Credentials used for PLAIN authentication. Empty username disables auth.
+	Username string
+	Password string
+
+	// StartTLS requires the relay to support STARTTLS.
+	StartTLS bool
+
+	From    string
+	To      []string
+	Subject string
+
+	// ImmediateSeverity is the lowest severity of alerts sent right away.
+	// Alerts with lower severity are sent in the digest. If DigestInterval
+	// is zero, all alerts are sent right away.
+	ImmediateSeverity int
+	DigestInterval    time.Duration
+
+	// Optional files with custom html and plain text templates.
+	HTMLTemplate string
+	TextTemplate string
+}
+
+// EmailWriter implements Writer interface and sends alerts by email
+// through smtp relay. Alerts are sent in background, so a slow relay
+// doesn't block other writers. Close sends queued alerts.
+type EmailWriter struct {
+	cfg      EmailConfig
+	hostname string
+
+	// envelope addresses without display names
+	envFrom string
+	envTo   []string
+
+	html *htmltemplate.Template
+	text *texttemplate.Template
+
+	mx         sync.Mutex
+	pending    []*Event
+	maxPending int
+	// dropped is number of digest alerts dropped since the last flush.
+	dropped int
+
+	// queue of alerts sent right away by run, closed by Close.
+	queue   chan *Event
+	closed  bool
+	stopped chan struct{}
+
+	// send is used in tests.
+	send func(msg []byte) error
+}
+
+// EmailDigestGroup groups digest alerts with the same source host and threat.
+type EmailDigestGroup struct {
+	Host        string
+	ThreatID    string
+	Description string
+	Severity    int
+	Count       int
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	Targets     []string
+}
+
+// emailData is passed to email templates.
+type emailData struct {
+	Subject  string
+	Hostname string
+	Digest   bool
+	Events   []*Event
+	Groups   []*EmailDigestGroup
+	From     time.Time
+	To       time.Time
+}
+
+// maxDigestTargets is max number of targets listed in the digest group.
+const maxDigestTargets = 5
+
+// emailQueueSize is max number of alerts queued for sending right away.
+const emailQueueSize = 256
+
+// emailMaxPending is max number of alerts kept for the digest,
+// e.g. while the smtp server is unreachable.
+const emailMaxPending = 10000
+
+// NewEmailWriter creates new email writer.
+func NewEmailWriter(cfg EmailConfig) (*EmailWriter, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("email: smtp host is required")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		cfg.StartTLS = true
+	}
+	if cfg.From == "" {
+		return nil, errors.New("email: sender address is required")
+	}
+	if len(cfg.To) == 0 {
+		return nil, errors.New("email: at least one recipient is required")
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "AlphaSOC NFR alert"
+	}
+
+	hostname, _ := os.Hostname()
+	w := &EmailWriter{
+		cfg:        cfg,
+		hostname:   hostname,
+		maxPending: emailMaxPending,
+		queue:      make(chan *Event, emailQueueSize),
+		stopped:    make(chan struct{}),
+	}
+	w.send = w.sendSMTP
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: invalid sender %s: %s", cfg.From, err)
+	}
+	w.envFrom = from.Address
+	for _, to := range cfg.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("email: invalid recipient %s: %s", to, err)
+		}
+		w.envTo = append(w.envTo, addr.Address)
+	}
+
+	if w.html, err = parseHTMLTemplate(cfg.HTMLTemplate); err != nil {
+		return nil, err
+	}
+	if w.text, err = parseTextTemplate(cfg.TextTemplate); err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Write queues alert for sending right away or for the digest.
+// Alert is dropped if the queue of alerts sent right away is full,
+// the oldest digest alert is dropped if the digest is full.
+func (w *EmailWriter) Write(event *Event) error {
+	ev := *event
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.cfg.DigestInterval > 0 && event.Severity < w.cfg.ImmediateSeverity {
+		w.pending = append(w.pending, &ev)
+		w.trimPending()
+		return nil
+	}
+	if w.closed {
+		return errors.New("email: writer is closed, alert dropped")
+	}
+	select {
+	case w.queue <- &ev:
+		return nil
+	default:
+		return errors.New("email: queue is full, alert dropped")
+	}
+}
+
+// run sends queued alerts until the writer is closed.
+func (w *EmailWriter) run() {
+	defer close(w.stopped)
+	for event := range w.queue {
+		if err := w.sendEvent(event); err != nil {
+			log.Errorf("sending email alert failed: %s", err)
+		}
+	}
+}
+
+// Close sends queued alerts and stops the writer. Digest is not sent,
+// use Flush before.
+func (w *EmailWriter) Close() error {
+	w.mx.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mx.Unlock()
+	<-w.stopped
+	return nil
+}
+
+// Flush sends the digest of queued alerts.
+func (w *EmailWriter) Flush() error {
+	w.mx.Lock()
+	events := w.pending
+	w.pending = nil
+	w.mx.Unlock()
+
+	var err error
+	if len(events) > 0 {
+		if err = w.sendDigest(events); err != nil {
+			// put events back, so they are sent with the next digest
+			w.mx.Lock()
+			w.pending = append(events, w.pending...)
+			w.trimPending()
+			w.mx.Unlock()
+		}
+	}
+
+	w.mx.Lock()
+	if w.dropped > 0 {
+		log.Warnf("email digest is full, %d oldest alerts dropped", w.dropped)
+		w.dropped = 0
+	}
+	w.mx.Unlock()
+	return err
+}
+
+// trimPending drops the oldest digest alerts over the limit.
+// It must be called with the mutex held.
+func (w *EmailWriter) trimPending() {
+	if n := len(w.pending) - w.maxPending; n > 0 {
+		w.pending = w.pending[n:]
+		w.dropped += n
+	}
+}
+
+// DigestInterval returns the interval the digest should be flushed with.
+func (w *EmailWriter) DigestInterval() time.Duration {
+	return w.cfg.DigestInterval
+}
+
+func (w *EmailWriter) sendEvent(event *Event) error {
+	subject := fmt.Sprintf("%s: %s from %s", w.cfg.Subject, eventTitle(event), eventSource(event))
+	return w.render(&emailData{
+		Subject:  subject,
+		Hostname: w.hostname,
+		Events:   []*Event{event},
+		From:     event.Timestamp,
+		To:       event.Timestamp,
+	})
+}
+
+func (w *EmailWriter) sendDigest(events []*Event) error {
+	groups := DigestGroups(events)
+	subject := fmt.Sprintf("%s: digest of %d alerts from %d hosts", w.cfg.Subject, len(events), countHosts(groups))
+
+	data := &emailData{
+		Subject:  subject,
+		Hostname: w.hostname,
+		Digest:   true,
+		Events:   events,
+		Groups:   groups,
+	}
+	for _, ev := range events {
+		if data.From.IsZero() || ev.Timestamp.Before(data.From) {
+			data.From = ev.Timestamp
+		}
+		if ev.Timestamp.After(data.To) {
+			data.To = ev.Timestamp
+		}
+	}
+	return w.render(data)
+}
+
+// render executes templates and sends multipart message.
+func (w *EmailWriter) render(data *emailData) error {
+	var text, html bytes.Buffer
+	if err := w.text.Execute(&text, data); err != nil {
+		return fmt.Errorf("email: rendering text template: %s", err)
+	}
+	if err := w.html.Execute(&html, data); err != nil {
+		return fmt.Errorf("email: rendering html template: %s", err)
+	}
+
+	msg, err := buildMessage(w.cfg.From, w.cfg.To, data.Subject, text.Bytes(), html.Bytes())
+	if err != nil {
+		return err
+	}
+	return w.send(msg)
+}
+
+// sendSMTP delivers message through the smtp relay.
+func (w *EmailWriter) sendSMTP(msg []byte) error {
+	addr := net.JoinHostPort(w.cfg.Host, strconv.Itoa(w.cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("email: connect to smtp relay failed: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	c, err := smtp.NewClient(conn, w.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("email: %s", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: w.cfg.Host}); err != nil {
+			return fmt.Errorf("email: starttls failed: %s", err)
+		}
+	} else if w.cfg.StartTLS {
+		return errors.New("email: smtp relay does not support starttls")
+	}
+
+	if w.cfg.Username != "" {
+		auth := smtp.PlainAuth("", w.cfg.Username, w.cfg.Password, w.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("email: authentication failed: %s", err)
+		}
+	}
+
+	if err := c.Mail(w.envFrom); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	for _, to := range w.envTo {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("email: recipient %s: %s", to, err)
+		}
+	}
+
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	if _, err := wc.Write(msg); err != nil {
+		wc.Close()
+		return fmt.Errorf("email: %s", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("email: %s", err)
+	}
+	return c.Quit()
+}
+
+// DigestGroups groups events by source host and threat. Groups are sorted
+// by severity and number of events.
+func DigestGroups(events []*Event) []*EmailDigestGroup {
+	var (
+		groups []*EmailDigestGroup
+		index  = make(map[string]*EmailDigestGroup)
+	)
+
+	for _, ev := range events {
+		host := eventSource(ev)
+		for tid, threat := range ev.Threats {
+			key := host + "|" + tid
+			g, ok := index[key]
+			if !ok {
+				g = &EmailDigestGroup{
+					Host:        host,
+					ThreatID:    tid,
+					Description: threat.Description,
+					FirstSeen:   ev.Timestamp,
+					LastSeen:    ev.Timestamp,
+				}
+				index[key] = g
+				groups = append(groups, g)
+			}
+
+			g.Count++
+			if threat.Severity > g.Severity {
+				g.Severity = threat.Severity
+			}
+			if ev.Timestamp.Before(g.FirstSeen) {
+				g.FirstSeen = ev.Timestamp
+			}
+			if ev.Timestamp.After(g.LastSeen) {
+				g.LastSeen = ev.Timestamp
+			}
+			if target := eventTarget(ev); target != "" && len(g.Targets) < maxDigestTargets &&
+				!utils.StringsContains(g.Targets, target) {
+				g.Targets = append(g.Targets, target)
+			}
+		}
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Severity != groups[j].Severity {
+			return groups[i].Severity > groups[j].Severity
+		}
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		if groups[i].Host != groups[j].Host {
+			return groups[i].Host < groups[j].Host
+		}
+		return groups[i].ThreatID < groups[j].ThreatID
+	})
+	return groups
+}
+
+func countHosts(groups []*EmailDigestGroup) int {
+	hosts := make(map[string]bool)
+	for _, g := range groups {
+		hosts[g.Host] = true
+	}
+	return len(hosts)
+}
+
+// eventTitle returns description of the most severe threat.
+func eventTitle(event *Event) string {
+	var (
+		title    string
+		severity = -1
+	)
+	for tid, threat := range event.Threats {
+		desc := threat.Description
+		if desc == "" {
+			desc = tid
+		}
+		if threat.Severity > severity || (threat.Severity == severity && desc < title) {
+			title, severity = desc, threat.Severity
+		}
+	}
+	return title
+}
+
+// eventSource returns source host name or ip of the event.
+func eventSource(event *Event) string {
+	if event.SrcHost != "" {
+		return event.SrcHost
+	}
+	if event.SrcIP != nil {
+		return event.SrcIP.String()
+	}
+	return "unknown"
+}
+
+// eventTarget returns query, url or destination of the event, depending on its type.
+func eventTarget(event *Event) string {
+	switch event.EventType {
+	case "dns":
+		return event.Query
+	case "http":
+		return event.URL
+	}
+	if event.DestIP != nil {
+		if event.DestPort != 0 {
+			return net.JoinHostPort(event.DestIP.String(), strconv.Itoa(int(event.DestPort)))
+		}
+		return event.DestIP.String()
+	}
+	return ""
+}
+
+// buildMessage builds multipart/alternative mime message.
+func buildMessage(from string, to []string, subject string, text, html []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", from)
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", encodeHeader(subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Type", "multipart/alternative; boundary="+boundary)
+	header.Set("X-Mailer", "AlphaSOC NFR")
+
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, header.Get(k))
+	}
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n", part.contentType)
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		qp := quotedprintable.NewWriter(&buf)
+		if _, err := qp.Write(part.body); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// encodeHeader encodes non-ascii header value. New lines are replaced
+// with spaces, so the value can't add headers.
+func encodeHeader(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return "=?utf-8?q?" + strings.Replace(quotedPrintableString(s), " ", "_", -1) + "?="
+		}
+	}
+	return s
+}
+
+func quotedPrintableString(s string) string {
+	var buf bytes.Buffer
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(s))
+	qp.Close()
+	return buf.String()
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "nfr-" + hex.EncodeToString(b), nil
+}
+
+var templateFuncs = map[string]interface{}{
+	"title":  eventTitle,
+	"source": eventSource,
+	"target": eventTarget,
+	"time": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05 MST")
+	},
+}
+
+func parseHTMLTemplate(file string) (*htmltemplate.Template, error) {
+	content := defaultHTMLTemplate
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("email: reading html template: %s", err)
+		}
+		content = string(b)
+	}
+	return htmltemplate.New("html").Funcs(templateFuncs).Parse(content)
+}
+
+func parseTextTemplate(file string) (*texttemplate.Template, error) {
+	content := defaultTextTemplate
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("email: reading text template: %s", err)
+		}
+		content = string(b)
+	}
+	return texttemplate.New("text").Funcs(templateFuncs).Parse(content)
+}
+
+const defaultTextTemplate = `{{.Subject}}
+{{if .Digest}}
+Alerts between {{time .From}} and {{time .To}}, grouped by source host and threat:
+{{range .Groups}}
+* {{.Host}}: {{.Description}} (severity {{.Severity}}, {{.Count}} alerts)
+  first seen {{time .FirstSeen}}, last seen {{time .LastSeen}}
+{{- range .Targets}}
+  - {{.}}
+{{- end}}
+{{end}}{{else}}{{range .Events}}
+Threat:   {{title .}}
+Severity: {{.Severity}}
+Time:     {{time .Timestamp}}
+Source:   {{source .}}
+{{- range .Groups}}
+Group:    {{.Label}} ({{.Description}})
+{{- end}}
+{{- if .Tenant}}
+Tenant:   {{.Tenant}}
+{{- end}}
+{{- if eq .EventType "dns"}}
+Query:    {{.Query}} {{.QueryType}}
+{{- else if eq .EventType "http"}}
+URL:      {{.URL}}
+{{- else}}
+Dest:     {{target .}} {{.Proto}}
+{{- end}}
+{{- range $id, $t := .Threats}}
+- {{$id}}: {{$t.Description}} (severity {{$t.Severity}})
+{{- end}}
+{{end}}{{end}}
+--
+Sent by AlphaSOC Network Flight Recorder on {{.Hostname}}
+`
+
+const defaultHTMLTemplate = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; font-size: 14px;">
+<h2>{{.Subject}}</h2>
+{{if .Digest}}
+<p>Alerts between {{time .From}} and {{time .To}}, grouped by source host and threat.</p>
+<table cellpadding="4" cellspacing="0" border="1" style="border-collapse: collapse;">
+<tr><th>Host</th><th>Threat</th><th>Severity</th><th>Alerts</th><th>First seen</th><th>Last seen</th><th>Targets</th></tr>
+{{range .Groups}}<tr>
+<td>{{.Host}}</td><td>{{.Description}}</td><td>{{.Severity}}</td><td>{{.Count}}</td>
+<td>{{time .FirstSeen}}</td><td>{{time .LastSeen}}</td>
+<td>{{range .Targets}}{{.}}<br>{{end}}</td>
+</tr>
+{{end}}</table>
+{{else}}{{range .Events}}
+<table cellpadding="4" cellspacing="0">
+<tr><th align="left">Threat</th><td>{{title .}}</td></tr>
+<tr><th align="left">Severity</th><td>{{.Severity}}</td></tr>
+<tr><th align="left">Time</th><td>{{time .Timestamp}}</td></tr>
+<tr><th align="left">Source</th><td>{{source .}}</td></tr>
+{{range .Groups}}<tr><th align="left">Group</th><td>{{.Label}} ({{.Description}})</td></tr>
+{{end}}{{if .Tenant}}<tr><th align="left">Tenant</th><td>{{.Tenant}}</td></tr>
+{{end}}{{if eq .EventType "dns"}}<tr><th align="left">Query</th><td>{{.Query}} {{.QueryType}}</td></tr>
+{{else if eq .EventType "http"}}<tr><th align="left">URL</th><td>{{.URL}}</td></tr>
+{{else}}<tr><th align="left">Destination</th><td>{{target .}} {{.Proto}}</td></tr>
+{{end}}</table>
+<ul>
+{{range $id, $t := .Threats}}<li><b>{{$id}}</b>: {{$t.Description}} (severity {{$t.Severity}})</li>
+{{end}}</ul>
+{{end}}{{end}}
+<p style="color: #888;">Sent by AlphaSOC Network Flight Recorder on {{.Hostname}}</p>
+</body>
+</html>
+`
@@ -0,0 +1,297 @@
+package alerts
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+// smtpStandIn is a minimal smtp server recording received messages.
+type smtpStandIn struct {
+	l net.Listener
+
+	mx       sync.Mutex
+	messages []string
+	rcpts    []string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{l: l}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost stand-in")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH"):
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "MAIL"):
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT"):
+			s.mx.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line))
+			s.mx.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mx.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mx.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpStandIn) received() []string {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func testEvent(src net.IP, tid string, severity int, query string) *Event {
+	return &Event{
+		EventType: "dns",
+		Severity:  severity,
+		Threats: map[string]Threat{
+			tid: {Severity: severity, Description: "Desc " + tid},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 0),
+			SrcIP:     src,
+			Query:     query,
+			QueryType: "A",
+		},
+	}
+}
+
+func TestEmailWriterImmediate(t *testing.T) {
+	s := newSMTPStandIn(t)
+	defer s.l.Close()
+
+	w, err := NewEmailWriter(EmailConfig{
+		Host:     "127.0.0.1",
+		Port:     s.port(),
+		Username: "user",
+		Password: "pass",
+		From:     "nfr@example.com",
+		To:       []string{"soc@example.com", "admin@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 5, "virus.com")); err != nil {
+		t.Fatal(err)
+	}
+	// close sends queued alerts
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := s.received()
+	if len(msgs) != 1 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", len(msgs), 1)
+	}
+	for _, part := range []string{
+		"Subject: AlphaSOC NFR alert: Desc c2_communication from 10.0.0.1",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+		"virus.com",
+	} {
+		if !strings.Contains(msgs[0], part) {
+			t.Fatalf("missing %q in message:\n%s", part, msgs[0])
+		}
+	}
+	if len(s.rcpts) != 2 {
+		t.Fatalf("invalid number of recipients - got %d; expected %d", len(s.rcpts), 2)
+	}
+}
+
+func TestEmailWriterDigest(t *testing.T) {
+	var (
+		mx   sync.Mutex
+		sent []string
+	)
+	w, err := NewEmailWriter(EmailConfig{
+		Host:              "127.0.0.1",
+		From:              "nfr@example.com",
+		To:                []string{"soc@example.com"},
+		ImmediateSeverity: 4,
+		DigestInterval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.send = func(msg []byte) error {
+		mx.Lock()
+		sent = append(sent, string(msg))
+		mx.Unlock()
+		return nil
+	}
+
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "a.com"))
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "b.com"))
+	w.Write(testEvent(net.IPv4(10, 0, 0, 2), "young_domain", 2, "a.com"))
+	w.Write(testEvent(net.IPv4(10, 0, 0, 3), "c2_communication", 5, "c2.com"))
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// nothing left to send
+	w.Flush()
+	w.Close()
+
+	if len(sent) != 2 {
+		t.Fatalf("invalid number of messages - got %d; expected %d", len(sent), 2)
+	}
+	var immediate, digest bool
+	for _, msg := range sent {
+		immediate = immediate || strings.Contains(msg, "Desc c2_communication from 10.0.0.3")
+		digest = digest || strings.Contains(msg, "digest of 3 alerts from 2 hosts")
+	}
+	if !immediate || !digest {
+		t.Fatalf("high severity alert must be sent immediately and others in digest - got:\n%s", strings.Join(sent, "\n"))
+	}
+}
+
+func TestEmailWriterDefaults(t *testing.T) {
+	w, err := NewEmailWriter(EmailConfig{Host: "h", From: "a@b.c", To: []string{"a@b.c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.cfg.Port != 587 || !w.cfg.StartTLS {
+		t.Fatalf("invalid defaults - got port %d, starttls %t; expected port 587, starttls true", w.cfg.Port, w.cfg.StartTLS)
+	}
+}
+
+func TestEmailHeaderInjection(t *testing.T) {
+	msg, err := buildMessage("a@b.c", []string{"a@b.c"}, "Desc\r\nBcc: evil@example.com", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(msg), "\r\nBcc:") {
+		t.Fatalf("new line in subject adds header:\n%s", msg)
+	}
+	if !strings.Contains(string(msg), "Subject: Desc Bcc: evil@example.com\r\n") {
+		t.Fatalf("invalid subject:\n%s", msg)
+	}
+}
+
+func TestDigestGroups(t *testing.T) {
+	groups := DigestGroups([]*Event{
+		testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "a.com"),
+		testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "b.com"),
+		testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "a.com"),
+		testEvent(net.IPv4(10, 0, 0, 2), "c2_communication", 5, "c2.com"),
+	})
+
+	if len(groups) != 2 {
+		t.Fatalf("invalid number of groups - got %d; expected %d", len(groups), 2)
+	}
+	if groups[0].ThreatID != "c2_communication" {
+		t.Fatalf("most severe group must be first - got %s", groups[0].ThreatID)
+	}
+	if g := groups[1]; g.Count != 3 || strings.Join(g.Targets, ",") != "a.com,b.com" {
+		t.Fatalf("invalid group - got count %d, targets %v", g.Count, g.Targets)
+	}
+}
+
+func TestNewEmailWriterInvalid(t *testing.T) {
+	if _, err := NewEmailWriter(EmailConfig{From: "a@b.c", To: []string{"a@b.c"}}); err == nil {
+		t.Fatal("expected missing host error")
+	}
+	if _, err := NewEmailWriter(EmailConfig{Host: "h", To: []string{"a@b.c"}}); err == nil {
+		t.Fatal("expected missing sender error")
+	}
+	if _, err := NewEmailWriter(EmailConfig{Host: "h", From: "a@b.c"}); err == nil {
+		t.Fatal("expected missing recipient error")
+	}
+	_, err := NewEmailWriter(EmailConfig{Host: "h", Port: 25, From: "a@b.c", To: []string{"a@b.c"}, TextTemplate: "/nonexistent/template"})
+	if err == nil {
+		t.Fatal("expected missing template error")
+	}
+}
+
+func TestEmailWriterDigestLimit(t *testing.T) {
+	w, err := NewEmailWriter(EmailConfig{
+		Host:              "127.0.0.1",
+		From:              "nfr@example.com",
+		To:                []string{"soc@example.com"},
+		ImmediateSeverity: 4,
+		DigestInterval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.maxPending = 3
+	w.send = func(msg []byte) error { return errors.New("smtp unreachable") }
+
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "a.com"))
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "b.com"))
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected error of failed digest")
+	}
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "c.com"))
+	w.Write(testEvent(net.IPv4(10, 0, 0, 1), "young_domain", 2, "d.com"))
+	w.Flush()
+
+	if len(w.pending) != 3 || w.pending[0].Query != "b.com" || w.pending[2].Query != "d.com" {
+		t.Fatalf("oldest alerts must be dropped - got %d alerts", len(w.pending))
+	}
+}
@@ -110,6 +110,18 @@ func (w *GraylogWriter) Write(event *Event) error {
 		m.Extra["bytes_in"] = event.BytesIn
 		m.Extra["bytes_out"] = event.BytesOut
 		m.Extra["ja3"] = event.Ja3
+		if event.Tenant != "" {
+			m.Extra["tenant"] = event.Tenant
+		}
+		if inc := event.Incident; inc != nil {
+			m.Extra["incident"] = inc.ID
+			m.Extra["incident_status"] = inc.Status
+			m.Extra["incident_events"] = inc.Events
+			m.Extra["incident_event_types"] = strings.Join(inc.EventTypes, ",")
+			m.Extra["incident_targets"] = strings.Join(inc.Targets, ",")
+			m.Extra["incident_first_seen"] = inc.FirstSeen.String()
+			m.Extra["incident_last_seen"] = inc.LastSeen.String()
+		}
 		if err := w.writeAndRetry(&m); err != nil {
 			return err
 		}
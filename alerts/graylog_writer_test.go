@@ -0,0 +1,44 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGraylogWriterIncident(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := NewGraylogWriter("udp://"+conn.LocalAddr().String(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	c := NewCorrelator(30*time.Minute, w)
+	if err := c.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 3, "c2.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	b := make([]byte, 64*1024)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimRight(b[:n], "\n\x00"), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["_incident"] == nil || m["_incident_status"] != IncidentOpen ||
+		m["_incident_events"] != float64(1) || m["_incident_event_types"] != "dns" ||
+		m["_incident_targets"] != "c2.com" {
+		t.Fatalf("invalid incident fields in %v", m)
+	}
+}
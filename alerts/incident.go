@@ -0,0 +1,304 @@
+package alerts
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/utils"
+)
+
+// Incident statuses.
+const (
+	IncidentOpen   = "open"
+	IncidentUpdate = "update"
+	IncidentClose  = "close"
+)
+
+// maxIncidentTargets limits number of targets kept in incident.
+const maxIncidentTargets = 20
+
+// Incident groups alerts from a single host within a time window.
+type Incident struct {
+	ID         string    `json:"id"`
+	Status     string    `json:"status"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Events     int       `json:"events"`
+	EventTypes []string  `json:"eventTypes"`
+	Targets    []string  `json:"targets,omitempty"`
+}
+
+// incident keeps state of an open incident.
+type incident struct {
+	Incident
+
+	srcIP   net.IP
+	srcHost string
+	tenant  string
+	threats map[string]Threat
+	groups  []Group
+
+	// touched is the wall clock time of the last update,
+	// used for closing idle incidents.
+	touched time.Time
+}
+
+// Correlator implements Writer interface and groups alerts into
+// per-host incidents. Incident open, update and close records are
+// written to the correlator writers as events of type incident.
+type Correlator struct {
+	window  time.Duration
+	writers []Writer
+
+	mx        sync.Mutex
+	incidents map[string]*incident
+	now       func() time.Time
+}
+
+// NewCorrelator creates new correlator. Alerts from the same host
+// within window are grouped into a single incident, which is closed
+// after window without new alerts.
+func NewCorrelator(window time.Duration, writers ...Writer) *Correlator {
+	return &Correlator{
+		window:    window,
+		writers:   writers,
+		incidents: make(map[string]*incident),
+		now:       time.Now,
+	}
+}
+
+// AddWriter adds writer for incident records.
+func (c *Correlator) AddWriter(w Writer) {
+	c.writers = append(c.writers, w)
+}
+
+// Write adds alert to the host incident and writes incident record
+// if the incident was opened or changed.
+func (c *Correlator) Write(event *Event) error {
+	key := incidentKey(event)
+	if key == "" {
+		return nil
+	}
+
+	ts := event.Timestamp
+	if ts.IsZero() {
+		ts = c.now()
+	}
+
+	c.mx.Lock()
+	var records []*Event
+	inc, ok := c.incidents[key]
+	if ok && ts.Sub(inc.LastSeen) > c.window {
+		// alert came long after the last one, start a new incident
+		records = append(records, inc.record(IncidentClose))
+		ok = false
+	}
+	if !ok {
+		inc = newIncident(key, event, ts)
+		c.incidents[key] = inc
+	}
+
+	changed := inc.add(event, ts)
+	inc.touched = c.now()
+	switch {
+	case !ok:
+		records = append(records, inc.record(IncidentOpen))
+	case changed:
+		records = append(records, inc.record(IncidentUpdate))
+	}
+	c.mx.Unlock()
+
+	return c.write(records)
+}
+
+// Expire closes incidents without new alerts within the window.
+func (c *Correlator) Expire() error {
+	now := c.now()
+	return c.closeIncidents(func(inc *incident) bool {
+		return now.Sub(inc.touched) > c.window
+	})
+}
+
+// Close closes all open incidents, so incidents are written
+// before the writers are closed.
+func (c *Correlator) Close() error {
+	return c.closeIncidents(func(*incident) bool { return true })
+}
+
+// closeIncidents closes incidents matching fn and writes
+// close records ordered by incident start.
+func (c *Correlator) closeIncidents(fn func(*incident) bool) error {
+	c.mx.Lock()
+	var records []*Event
+	for key, inc := range c.incidents {
+		if fn(inc) {
+			records = append(records, inc.record(IncidentClose))
+			delete(c.incidents, key)
+		}
+	}
+	c.mx.Unlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i].Incident, records[j].Incident
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			return a.FirstSeen.Before(b.FirstSeen)
+		}
+		return a.ID < b.ID
+	})
+	return c.write(records)
+}
+
+// Open returns number of open incidents.
+func (c *Correlator) Open() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return len(c.incidents)
+}
+
+// write writes records to all writers, so a failing writer doesn't
+// stop records from reaching other ones.
+func (c *Correlator) write(records []*Event) error {
+	var errs []error
+	for _, r := range records {
+		for _, w := range c.writers {
+			if err := w.Write(r); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// incidentKey returns host the event is correlated by.
+func incidentKey(event *Event) string {
+	var key string
+	switch {
+	case event.SrcHost != "":
+		key = event.SrcHost
+	case event.SrcIP != nil:
+		key = event.SrcIP.String()
+	default:
+		return ""
+	}
+	// tenants may use the same private addresses
+	if event.Tenant != "" {
+		key = event.Tenant + "/" + key
+	}
+	return key
+}
+
+func newIncident(key string, event *Event, ts time.Time) *incident {
+	h := sha1.Sum([]byte(key + "|" + strconv.FormatInt(ts.UnixNano(), 10)))
+	return &incident{
+		Incident: Incident{
+			ID:        hex.EncodeToString(h[:8]),
+			FirstSeen: ts,
+			LastSeen:  ts,
+		},
+		srcIP:   event.SrcIP,
+		srcHost: event.SrcHost,
+		tenant:  event.Tenant,
+		threats: make(map[string]Threat),
+	}
+}
+
+// add adds event to the incident. It reports whether incident
+// threats, event types or severity changed.
+func (inc *incident) add(event *Event, ts time.Time) bool {
+	severity := inc.severity()
+
+	inc.Events++
+	if ts.After(inc.LastSeen) {
+		inc.LastSeen = ts
+	}
+	if ts.Before(inc.FirstSeen) {
+		inc.FirstSeen = ts
+	}
+
+	changed := false
+	for tid, threat := range event.Threats {
+		if t, ok := inc.threats[tid]; !ok || threat.Severity > t.Severity {
+			inc.threats[tid] = threat
+			changed = true
+		}
+	}
+	if event.EventType != "" && !utils.StringsContains(inc.EventTypes, event.EventType) {
+		inc.EventTypes = append(inc.EventTypes, event.EventType)
+		sort.Strings(inc.EventTypes)
+		changed = true
+	}
+	for _, g := range event.Groups {
+		if !containsGroup(inc.groups, g) {
+			inc.groups = append(inc.groups, g)
+		}
+	}
+	if target := eventTarget(event); target != "" &&
+		len(inc.Targets) < maxIncidentTargets && !utils.StringsContains(inc.Targets, target) {
+		inc.Targets = append(inc.Targets, target)
+	}
+
+	return changed || inc.severity() != severity
+}
+
+// severity returns incident severity. It is the highest severity of the
+// incident threats, escalated when alerts span several event types
+// or many distinct threats were seen.
+func (inc *incident) severity() int {
+	severity := 0
+	for _, t := range inc.threats {
+		if t.Severity > severity {
+			severity = t.Severity
+		}
+	}
+	if len(inc.EventTypes) > 1 {
+		severity++
+	}
+	if len(inc.threats) > 2 {
+		severity++
+	}
+	if severity > 5 {
+		severity = 5
+	}
+	return severity
+}
+
+// record returns incident record with given status.
+func (inc *incident) record(status string) *Event {
+	i := inc.Incident
+	i.Status = status
+	i.EventTypes = append([]string(nil), inc.EventTypes...)
+	i.Targets = append([]string(nil), inc.Targets...)
+
+	threats := make(map[string]Threat, len(inc.threats))
+	for tid, t := range inc.threats {
+		threats[tid] = t
+	}
+
+	ev := &Event{
+		EventType: "incident",
+		Severity:  inc.severity(),
+		Threats:   threats,
+		Groups:    append([]Group(nil), inc.groups...),
+		Tenant:    inc.tenant,
+		Incident:  &i,
+	}
+	ev.Timestamp = inc.LastSeen
+	ev.SrcIP = inc.srcIP
+	ev.SrcHost = inc.srcHost
+	return ev
+}
+
+func containsGroup(groups []Group, g Group) bool {
+	for i := range groups {
+		if groups[i].Label == g.Label {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package alerts
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// recordWriter keeps written events.
+type recordWriter struct {
+	events []*Event
+}
+
+func (w *recordWriter) Write(event *Event) error {
+	w.events = append(w.events, event)
+	return nil
+}
+
+func (w *recordWriter) statuses() []string {
+	var s []string
+	for _, ev := range w.events {
+		s = append(s, ev.Incident.Status)
+	}
+	return s
+}
+
+func TestCorrelator(t *testing.T) {
+	w := &recordWriter{}
+	c := NewCorrelator(30*time.Minute, w)
+	now := time.Unix(1536242944, 0)
+	c.now = func() time.Time { return now }
+
+	src := net.IPv4(10, 0, 0, 1)
+	dns := testEvent(src, "c2_communication", 3, "c2.com")
+	dns.Timestamp = now
+
+	ip := testEvent(src, "c2_communication", 3, "")
+	ip.EventType = "ip"
+	ip.DestIP = net.IPv4(1, 2, 3, 4)
+	ip.Timestamp = now.Add(5 * time.Minute)
+
+	c.Write(dns)
+	c.Write(dns)
+	c.Write(ip)
+	c.Write(testEvent(net.IPv4(10, 0, 0, 2), "young_domain", 2, "a.com"))
+
+	if c.Open() != 2 {
+		t.Fatalf("invalid number of open incidents - got %d; expected %d", c.Open(), 2)
+	}
+	if got := w.statuses(); len(got) != 3 || got[0] != IncidentOpen || got[1] != IncidentUpdate || got[2] != IncidentOpen {
+		t.Fatalf("invalid incident records %v", got)
+	}
+
+	update := w.events[1]
+	if update.EventType != "incident" || update.Incident.Events != 3 {
+		t.Fatalf("invalid incident update %+v", update.Incident)
+	}
+	if update.Severity != 4 {
+		t.Fatalf("incident spanning several event types must be escalated - got severity %d", update.Severity)
+	}
+	if len(update.Incident.Targets) != 2 || !update.Incident.LastSeen.Equal(ip.Timestamp) {
+		t.Fatalf("invalid incident %+v", update.Incident)
+	}
+
+	now = now.Add(31 * time.Minute)
+	if err := c.Expire(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Open() != 0 {
+		t.Fatalf("idle incidents not closed - %d open", c.Open())
+	}
+	if got := w.statuses(); len(got) != 5 || got[3] != IncidentClose || got[4] != IncidentClose {
+		t.Fatalf("invalid incident records %v", got)
+	}
+	// incidents are closed in order of first seen, then id
+	closed := map[string]bool{w.events[3].Incident.ID: true, w.events[4].Incident.ID: true}
+	if !closed[w.events[0].Incident.ID] || !closed[w.events[2].Incident.ID] {
+		t.Fatal("closed incident id differs from opened one")
+	}
+}
+
+func TestCorrelatorWindow(t *testing.T) {
+	w := &recordWriter{}
+	c := NewCorrelator(10*time.Minute, w)
+
+	src := net.IPv4(10, 0, 0, 1)
+	first := testEvent(src, "c2_communication", 5, "c2.com")
+	later := testEvent(src, "c2_communication", 5, "c2.com")
+	later.Timestamp = first.Timestamp.Add(time.Hour)
+
+	c.Write(first)
+	c.Write(later)
+
+	if got := w.statuses(); len(got) != 3 || got[1] != IncidentClose || got[2] != IncidentOpen {
+		t.Fatalf("alert outside window must start new incident - got %v", got)
+	}
+	if w.events[0].Incident.ID == w.events[2].Incident.ID {
+		t.Fatal("new incident must have new id")
+	}
+}
+
+func TestCorrelatorTenants(t *testing.T) {
+	w := &recordWriter{}
+	c := NewCorrelator(30*time.Minute, w)
+
+	src := net.IPv4(10, 0, 0, 1)
+	acme := testEvent(src, "c2_communication", 3, "c2.com")
+	acme.Tenant = "acme"
+	c.Write(acme)
+	c.Write(testEvent(src, "c2_communication", 3, "c2.com"))
+
+	if c.Open() != 2 {
+		t.Fatalf("alerts of the same ip from other tenants must not be correlated - %d open incidents", c.Open())
+	}
+	if w.events[0].Tenant != "acme" || w.events[1].Tenant != "" {
+		t.Fatalf("invalid incident tenants %q, %q", w.events[0].Tenant, w.events[1].Tenant)
+	}
+}
+
+func TestCorrelatorWriterError(t *testing.T) {
+	w := &recordWriter{}
+	c := NewCorrelator(30*time.Minute, &failWriter{}, w)
+
+	if err := c.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 3, "c2.com")); err == nil {
+		t.Fatal("expected error of failing writer")
+	}
+	if len(w.events) != 1 {
+		t.Fatalf("incident not written after failing writer - got %d records", len(w.events))
+	}
+}
+
+func TestCorrelatorClose(t *testing.T) {
+	w := &recordWriter{}
+	c := NewCorrelator(30*time.Minute, w)
+
+	c.Write(testEvent(net.IPv4(10, 0, 0, 1), "c2_communication", 3, "c2.com"))
+	c.Write(testEvent(net.IPv4(10, 0, 0, 2), "young_domain", 2, "a.com"))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Open() != 0 {
+		t.Fatalf("incidents not closed - %d open", c.Open())
+	}
+	if got := w.statuses(); len(got) != 4 || got[2] != IncidentClose || got[3] != IncidentClose {
+		t.Fatalf("invalid incident records %v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package alerts
+
+import "sync"
+
+// MultiWriter writes alerts to a set of writers, which can be replaced
+// while alerts are written, e.g. when outputs are reloaded.
+type MultiWriter struct {
+	mx      sync.RWMutex
+	writers []Writer
+}
+
+// NewMultiWriter creates writer duplicating alerts to all given writers.
+func NewMultiWriter(writers ...Writer) *MultiWriter {
+	return &MultiWriter{writers: writers}
+}
+
+// Set replaces writers alerts are written to.
+func (w *MultiWriter) Set(writers ...Writer) {
+	w.mx.Lock()
+	w.writers = writers
+	w.mx.Unlock()
+}
+
+// Writers returns writers alerts are written to.
+func (w *MultiWriter) Writers() []Writer {
+	w.mx.RLock()
+	defer w.mx.RUnlock()
+	return w.writers
+}
+
+// Write writes event to all writers, so a failing writer doesn't
+// stop the others. The first error is returned.
+func (w *MultiWriter) Write(event *Event) error {
+	var err error
+	for _, writer := range w.Writers() {
+		if werr := write(writer, event); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// write writes event to w and counts written alerts. Writers of
+// MultiWriter are counted instead of the MultiWriter itself.
+func write(w Writer, event *Event) error {
+	if mw, ok := w.(*MultiWriter); ok {
+		return mw.Write(event)
+	}
+	name := writerName(w)
+	if err := w.Write(event); err != nil {
+		alertsWriteErrors.Inc(name)
+		return err
+	}
+	alertsWritten.Inc(name)
+	return nil
+}
@@ -0,0 +1,32 @@
+package alerts
+
+import (
+	"errors"
+	"testing"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write(*Event) error {
+	return errors.New("write failed")
+}
+
+func TestMultiWriter(t *testing.T) {
+	w1, w2 := &recordWriter{}, &recordWriter{}
+	mw := NewMultiWriter(failWriter{}, w1)
+
+	if err := mw.Write(&Event{}); err == nil {
+		t.Fatal("expected error of failing writer")
+	}
+	if len(w1.events) != 1 {
+		t.Fatalf("writer after failing one got %d events; expected 1", len(w1.events))
+	}
+
+	mw.Set(w2)
+	if err := mw.Write(&Event{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(w1.events) != 1 || len(w2.events) != 1 {
+		t.Fatalf("replaced writers got %d and %d events; expected 1 and 1", len(w1.events), len(w2.events))
+	}
+}
@@ -2,11 +2,27 @@
 package alerts
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/metrics"
+)
+
+// Alerts metrics. Tenant label of the default tenant is empty.
+var (
+	alertsPolled = metrics.NewCounterVec("nfr_alerts_polled_total",
+		"Alerts polled from AlphaSOC Engine.", "tenant")
+	alertsWritten = metrics.NewCounterVec("nfr_alerts_written_total",
+		"Alerts written by outputs.", "writer")
+	alertsWriteErrors = metrics.NewCounterVec("nfr_alerts_write_errors_total",
+		"Alerts outputs failed to write.", "writer")
 )
 
 // Poller polls alerts from AlphaSOC api and user logger
@@ -18,6 +34,10 @@ type Poller struct {
 	follow     string
 	followFile string
 	mapper     *AlertMapper
+	tenant     string
+
+	mx     sync.Mutex
+	polled time.Time
 }
 
 // NewPoller creates new poller base on give client and writer.
@@ -34,6 +54,18 @@ func (p *Poller) AddWriter(w Writer) {
 	p.writers = append(p.writers, w)
 }
 
+// SetTenant sets tenant name the polled alerts are tagged with.
+func (p *Poller) SetTenant(name string) {
+	p.tenant = name
+}
+
+// LastPoll returns time of the last successful poll.
+func (p *Poller) LastPoll() time.Time {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return p.polled
+}
+
 // SetFollowDataFile sets file for storing follow id.
 // If not used then poller will be retriving all alerts from the beging.
 // If set then only new alerts are polled.
@@ -52,45 +84,60 @@ func (p *Poller) SetFollowDataFile(file string) error {
 // Do polls alerts within a period specified by the interval argument.
 // The alerts are written to writer used to create new poller.
 // If the error occurrs Do method should be call again.
-func (p *Poller) Do(interval time.Duration) error {
-	return p.do(interval, 0)
+// Do returns when ctx is done.
+func (p *Poller) Do(ctx context.Context, interval time.Duration) error {
+	return p.do(ctx, interval, 0)
 }
 
 // do polls alerts. If maxTries <=0 then it polls forever.
-func (p *Poller) do(interval time.Duration, maxTries int) error {
+func (p *Poller) do(ctx context.Context, interval time.Duration, maxTries int) error {
 	var tries = 0
 	var more bool
+	var wait = interval
 
 	for {
 		// if there is more to fetch then don't wait for ticker
 		if !more {
-			time.Sleep(interval)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
 		}
+		wait = interval
 
 		if maxTries > 0 && tries >= maxTries {
 			break
 		}
 		tries++
 
-		alerts, err := p.c.Alerts(p.follow)
-		if err == client.ErrTooManyRequests {
-			time.Sleep(30 * time.Second)
-			more = true
+		alerts, err := p.c.Alerts(ctx, p.follow)
+		if d := client.RetryAfter(err); d > 0 {
+			// the client didn't retry as the api asked to wait longer
+			// than the retry policy allows, so wait before next poll.
+			log.Warnf("polling alerts postponed by %s: %s", d, err)
+			wait, more = d, false
 			continue
 		} else if err != nil {
 			return err
 		}
 		more = alerts.More
 
+		p.mx.Lock()
+		p.polled = time.Now()
+		p.mx.Unlock()
+
 		if len(alerts.Alerts) == 0 {
 			continue
 		}
 
 		newAlerts := p.mapper.Map(alerts)
+		for i := range newAlerts.Events {
+			newAlerts.Events[i].Tenant = p.tenant
+		}
+		alertsPolled.Add(float64(len(newAlerts.Events)), p.tenant)
 
 		for _, w := range p.writers {
 			for _, ev := range newAlerts.Events {
-				if err := w.Write(&ev); err != nil {
+				if err := write(w, &ev); err != nil {
 					return err
 				}
 			}
@@ -110,6 +157,26 @@ func (p *Poller) do(interval time.Duration, maxTries int) error {
 	return nil
 }
 
+// writerName returns metrics label of the writer,
+// e.g. "syslog" for *alerts.SyslogWriter.
+func writerName(w Writer) string {
+	name := fmt.Sprintf("%T", w)
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.ToLower(strings.TrimSuffix(name, "Writer"))
+}
+
+// sleep waits for given duration or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // stop stops poller do, by stoping ticker.
 func (p *Poller) stop() {
 	if p.ticker != nil {
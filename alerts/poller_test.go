@@ -2,9 +2,11 @@
 package alerts
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/groups"
@@ -22,7 +24,7 @@ func TestPollerDo(t *testing.T) {
 	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
 	p.AddWriter(w)
 	p.follow = "1"
-	p.do(1, 1)
+	p.do(context.Background(), 1, 1)
 
 	b, err := ioutil.ReadFile(fname)
 	if err != nil {
@@ -33,3 +35,85 @@ func TestPollerDo(t *testing.T) {
 		t.Fatal("no alerts should be written to file")
 	}
 }
+
+// retryAfterClient rejects the first alerts request with Retry-After.
+type retryAfterClient struct {
+	client.Client
+	calls []time.Time
+}
+
+func (c *retryAfterClient) Alerts(ctx context.Context, follow string) (*client.AlertsResponse, error) {
+	c.calls = append(c.calls, time.Now())
+	if len(c.calls) == 1 {
+		return nil, &client.Error{Kind: client.ErrorQuota, RetryAfter: 50 * time.Millisecond}
+	}
+	return &client.AlertsResponse{}, nil
+}
+
+func TestPollerDoRetryAfter(t *testing.T) {
+	c := &retryAfterClient{}
+	p := NewPoller(c, NewAlertMapper(groups.New()))
+	if err := p.do(context.Background(), time.Millisecond, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.calls) != 2 {
+		t.Fatalf("expected 2 alerts requests, got %d", len(c.calls))
+	}
+	if d := c.calls[1].Sub(c.calls[0]); d < 50*time.Millisecond {
+		t.Fatalf("poller didn't wait for Retry-After, next request after %s", d)
+	}
+}
+
+func TestPollerDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
+	if err := p.Do(ctx, time.Hour); err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+// alertClient returns a single alert.
+type alertClient struct {
+	client.Client
+}
+
+func (c *alertClient) Alerts(ctx context.Context, follow string) (*client.AlertsResponse, error) {
+	return &client.AlertsResponse{
+		Follow: "2",
+		Alerts: []client.Alert{{EventType: "dns", Threats: []string{"c2_communication"}}},
+	}, nil
+}
+
+func TestPollerDoTenant(t *testing.T) {
+	w := &recordWriter{}
+	p := NewPoller(&alertClient{}, NewAlertMapper(groups.New()))
+	p.SetTenant("acme")
+	p.AddWriter(w)
+	if err := p.do(context.Background(), time.Millisecond, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w.events) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(w.events))
+	}
+	if w.events[0].Tenant != "acme" {
+		t.Fatalf("invalid alert tenant - got %q; expected %q", w.events[0].Tenant, "acme")
+	}
+	if p.LastPoll().IsZero() {
+		t.Fatal("last poll time not set")
+	}
+}
+
+func TestWriterName(t *testing.T) {
+	for w, name := range map[Writer]string{
+		&recordWriter{}:            "record",
+		&SyslogWriter{}:            "syslog",
+		NewCorrelator(time.Minute): "correlator",
+	} {
+		if got := writerName(w); got != name {
+			t.Errorf("invalid writer name - got %q; expected %q", got, name)
+		}
+	}
+}
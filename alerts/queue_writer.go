@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"errors"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/metrics"
+)
+
+var alertsDropped = metrics.NewCounterVec("nfr_alerts_dropped_total",
+	"Alerts dropped because the queue of a writer was full.", "queue")
+
+// QueueWriter writes alerts to a writer in background, so callers,
+// e.g. local detectors running on sniffer and monitor goroutines,
+// are not blocked by slow outputs. Alerts written while the queue
+// is full are dropped and counted. Close writes queued alerts.
+type QueueWriter struct {
+	name string
+	w    Writer
+
+	mx      sync.Mutex
+	queue   chan *Event
+	closed  bool
+	dropped int
+	stopped chan struct{}
+}
+
+// NewQueueWriter creates writer queuing up to size alerts written to w.
+func NewQueueWriter(name string, w Writer, size int) *QueueWriter {
+	q := &QueueWriter{
+		name:    name,
+		w:       w,
+		queue:   make(chan *Event, size),
+		stopped: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Write queues alert. Alert is dropped if the queue is full.
+func (q *QueueWriter) Write(event *Event) error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.closed {
+		return errors.New("alerts queue is closed, alert dropped")
+	}
+	select {
+	case q.queue <- event:
+	default:
+		q.dropped++
+		alertsDropped.Inc(q.name)
+	}
+	return nil
+}
+
+// Dropped returns number of alerts dropped because the queue was full.
+func (q *QueueWriter) Dropped() int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return q.dropped
+}
+
+// run writes queued alerts until the writer is closed.
+func (q *QueueWriter) run() {
+	defer close(q.stopped)
+	for event := range q.queue {
+		if err := q.w.Write(event); err != nil {
+			log.Errorf("writing %s alert failed: %s", q.name, err)
+		}
+	}
+}
+
+// Close writes queued alerts and stops the writer.
+func (q *QueueWriter) Close() error {
+	q.mx.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mx.Unlock()
+	<-q.stopped
+	return nil
+}
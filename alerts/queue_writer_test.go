@@ -0,0 +1,45 @@
+package alerts
+
+import "testing"
+
+// blockWriter blocks writing until unblock is closed,
+// writes started are signaled on started.
+type blockWriter struct {
+	recordWriter
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (w *blockWriter) Write(event *Event) error {
+	w.started <- struct{}{}
+	<-w.unblock
+	return w.recordWriter.Write(event)
+}
+
+func TestQueueWriter(t *testing.T) {
+	w := &blockWriter{started: make(chan struct{}, 4), unblock: make(chan struct{})}
+	q := NewQueueWriter("test", w, 2)
+
+	// the first alert is taken by the blocked writer, next two are queued
+	if err := q.Write(&Event{}); err != nil {
+		t.Fatal(err)
+	}
+	<-w.started
+	for i := 0; i < 4; i++ {
+		if err := q.Write(&Event{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := q.Dropped(); n != 2 {
+		t.Fatalf("got %d dropped alerts; expected 2", n)
+	}
+
+	close(w.unblock)
+	q.Close()
+	if len(w.events) != 3 {
+		t.Fatalf("got %d written alerts; expected 3", len(w.events))
+	}
+	if err := q.Write(&Event{}); err == nil {
+		t.Fatal("expected error of closed queue")
+	}
+}
@@ -76,6 +76,9 @@ func (f *FormatterCEF) Format(event *Event) ([][]byte, error) {
 		}
 		ext = append(ext, cefCustomString(2, "groups", strings.Join(groups, ","))...)
 	}
+	if event.Tenant != "" {
+		ext = append(ext, cefCustomString(5, "tenant", event.Tenant)...)
+	}
 
 	switch event.EventType {
 	case "dns":
@@ -92,6 +95,12 @@ func (f *FormatterCEF) Format(event *Event) ([][]byte, error) {
 			{Key: "in", Value: strconv.Itoa(int(event.BytesIn))},
 			{Key: "out", Value: strconv.Itoa(int(event.BytesOut))},
 		}...)
+	case "incident":
+		ext = append(ext, cefCustomString(3, "incident", event.Incident.ID)...)
+		ext = append(ext, cefCustomString(4, "status", event.Incident.Status)...)
+		ext = append(ext, ceflog.Extension{
+			{Key: "cnt", Value: strconv.Itoa(event.Incident.Events)},
+		}...)
 	}
 
 	// Format each threat as a separate event
@@ -16,7 +16,7 @@ type AccountRegisterRequest struct {
 }
 
 // AccountRegister registers new alphasoc account.
-func (c *AlphaSOCClient) AccountRegister(req *AccountRegisterRequest) error {
+func (c *AlphaSOCClient) AccountRegister(ctx context.Context, req *AccountRegisterRequest) error {
 	if req.Details.Name == "" {
 		return fmt.Errorf("name is required to register account")
 	}
@@ -30,7 +30,7 @@ func (c *AlphaSOCClient) AccountRegister(req *AccountRegisterRequest) error {
 	}
 	req.Details.Email = email.Address
 
-	resp, err := c.post(context.Background(), "account/register", nil, req)
+	resp, err := c.post(ctx, "account/register", nil, req)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -18,17 +19,17 @@ func TestAccountRegister(t *testing.T) {
 	accountRegisterRequest.Details.Name = "test-name"
 	accountRegisterRequest.Details.Email = "test-email@alphasoc.com"
 
-	require.NoError(t, New(ts.URL, "test-key").AccountRegister(accountRegisterRequest))
+	require.NoError(t, New(ts.URL, "test-key").AccountRegister(context.Background(), accountRegisterRequest))
 }
 
 func TestAccountRegisterFail(t *testing.T) {
 	var accountRegisterRequest = &AccountRegisterRequest{}
 
-	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(accountRegisterRequest))
+	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(context.Background(), accountRegisterRequest))
 
 	accountRegisterRequest.Details.Name = "test-name"
-	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(accountRegisterRequest))
+	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(context.Background(), accountRegisterRequest))
 
 	accountRegisterRequest.Details.Email = "test-emailalphasoc.com"
-	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(accountRegisterRequest))
+	require.Error(t, New(noopServer.URL, "test-key").AccountRegister(context.Background(), accountRegisterRequest))
 }
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 )
 
 // AccountStatusResponse represents response for /account/status call.
@@ -18,12 +17,10 @@ type AccountStatusResponse struct {
 }
 
 // AccountStatus returns AlphaSOC account details status.
-func (c *AlphaSOCClient) AccountStatus() (*AccountStatusResponse, error) {
+func (c *AlphaSOCClient) AccountStatus(ctx context.Context) (*AccountStatusResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 	resp, err := c.get(ctx, "account/status", nil)
 	if err != nil {
 		return nil, err
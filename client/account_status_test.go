@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -15,21 +16,21 @@ func TestAccountStatus(t *testing.T) {
 		json.NewEncoder(w).Encode(&AccountStatusResponse{})
 	}))
 	defer ts.Close()
-	_, err := New(ts.URL, "test-key").AccountStatus()
+	_, err := New(ts.URL, "test-key").AccountStatus(context.Background())
 	require.NoError(t, err)
 }
 
 func TestAccountStatusFail(t *testing.T) {
-	_, err := New(internalServerErrorServer.URL, "test-key").AccountStatus()
+	_, err := New(internalServerErrorServer.URL, "test-key").AccountStatus(context.Background())
 	require.Error(t, err)
 }
 
 func TestAccountStatusNoKey(t *testing.T) {
-	_, err := New("", "").AccountStatus()
+	_, err := New("", "").AccountStatus(context.Background())
 	require.Error(t, err)
 }
 
 func TestAccountStatusInvalidJSON(t *testing.T) {
-	_, err := New(noopServer.URL, "test-key").AccountStatus()
+	_, err := New(noopServer.URL, "test-key").AccountStatus(context.Background())
 	require.Error(t, err)
 }
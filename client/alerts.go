@@ -79,7 +79,7 @@ type Threat struct {
 }
 
 // Alerts returns AlphaSOC events that informs about potential risk.
-func (c *AlphaSOCClient) Alerts(follow string) (*AlertsResponse, error) {
+func (c *AlphaSOCClient) Alerts(ctx context.Context, follow string) (*AlertsResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
@@ -87,7 +87,7 @@ func (c *AlphaSOCClient) Alerts(follow string) (*AlertsResponse, error) {
 	if follow != "" {
 		query.Add("follow", follow)
 	}
-	resp, err := c.get(context.Background(), "alerts", query)
+	resp, err := c.get(ctx, "alerts", query)
 	if err != nil {
 		return nil, err
 	}
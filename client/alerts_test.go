@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,7 +17,7 @@ func TestAlerts(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := New(ts.URL, "test-key").Alerts("")
+	_, err := New(ts.URL, "test-key").Alerts(context.Background(), "")
 	require.NoError(t, err)
 }
 
@@ -29,21 +30,21 @@ func TestAlertsFollow(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := New(ts.URL, "test-key").Alerts("1")
+	_, err := New(ts.URL, "test-key").Alerts(context.Background(), "1")
 	require.NoError(t, err)
 }
 
 func TestAlertsFail(t *testing.T) {
-	_, err := New(internalServerErrorServer.URL, "test-key").Alerts("")
+	_, err := New(internalServerErrorServer.URL, "test-key").Alerts(context.Background(), "")
 	require.Error(t, err)
 }
 
 func TestAlertsNoKey(t *testing.T) {
-	_, err := New("", "").Alerts("")
+	_, err := New("", "").Alerts(context.Background(), "")
 	require.Equal(t, ErrNoAPIKey, err)
 }
 
 func TestAlertsInvalidJSON(t *testing.T) {
-	_, err := New(noopServer.URL, "test-key").Alerts("")
+	_, err := New(noopServer.URL, "test-key").Alerts(context.Background(), "")
 	require.Error(t, err)
 }
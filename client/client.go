@@ -11,22 +11,23 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/alphasoc/nfr/version"
-	"golang.org/x/net/context/ctxhttp"
+	"github.com/cenkalti/backoff/v4"
 )
 
 // Client interface for AlphaSOC API.
 type Client interface {
-	AccountRegister(*AccountRegisterRequest) error
-	AccountStatus() (*AccountStatusResponse, error)
-	Alerts(string) (*AlertsResponse, error)
-	EventsDNS(*EventsDNSRequest) (*EventsDNSResponse, error)
-	EventsIP(*EventsIPRequest) (*EventsIPResponse, error)
-	EventsHTTP([]*HTTPEntry) (*EventsHTTPResponse, error)
-	EventsTLS([]*TLSEntry) (*EventsTLSResponse, error)
-	KeyRequest() (*KeyRequestResponse, error)
-	KeyReset(*KeyResetRequest) error
+	AccountRegister(context.Context, *AccountRegisterRequest) error
+	AccountStatus(context.Context) (*AccountStatusResponse, error)
+	Alerts(context.Context, string) (*AlertsResponse, error)
+	EventsDNS(context.Context, *EventsDNSRequest) (*EventsDNSResponse, error)
+	EventsIP(context.Context, *EventsIPRequest) (*EventsIPResponse, error)
+	EventsHTTP(context.Context, []*HTTPEntry) (*EventsHTTPResponse, error)
+	EventsTLS(context.Context, []*TLSEntry) (*EventsTLSResponse, error)
+	KeyRequest(context.Context) (*KeyRequestResponse, error)
+	KeyReset(context.Context, *KeyResetRequest) error
 }
 
 // ErrorResponse represents AlphaSOC API error response.
@@ -42,10 +43,33 @@ var (
 	// ErrNoRequest is returned when nil request is pass to method.
 	ErrNoRequest = errors.New("request is empty")
 
-	// ErrTooManyRequests is returned when API returns "429 Too Many Requests"
+	// ErrTooManyRequests is wrapped by quota Error returned when API
+	// returns "429 Too Many Requests". Use errors.Is to check for it.
 	ErrTooManyRequests = errors.New("too many requests to API")
 )
 
+// DefaultTimeout is a timeout of a single request to AlphaSOC API.
+const DefaultTimeout = 30 * time.Second
+
+// RetryPolicy describes how failed requests are retried.
+// Transient errors are retried with jittered exponential backoff.
+// Requests rejected with Retry-After header are retried after
+// the requested delay, unless it's longer than MaxInterval.
+type RetryPolicy struct {
+	// Maximum number of retries, 0 disables retrying.
+	MaxRetries int
+	// Initial and maximum delay between retries.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+}
+
+// DefaultRetryPolicy is a retry policy used by new clients.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:      3,
+	InitialInterval: time.Second,
+	MaxInterval:     30 * time.Second,
+}
+
 // DefaultVersion for AlphaSOC API.
 const DefaultVersion = "v1"
 
@@ -58,27 +82,51 @@ type AlphaSOCClient struct {
 	client  *http.Client
 	version string
 	key     string
+	retry   RetryPolicy
+	upload  UploadConfig
+	observe Observer
 }
 
+// Observer is called after every request to AlphaSOC API with the api path,
+// e.g. events/dns, duration of the request and its error.
+type Observer func(path string, d time.Duration, err error)
+
 // New creates new AlphaSOC client with given host.
-// It also sets timeout to 30 seconds.
+// It also sets timeout to 30 seconds and default retry policy.
 func New(host, key string) *AlphaSOCClient {
 	return &AlphaSOCClient{
-		client:  &http.Client{},
+		client:  &http.Client{Timeout: DefaultTimeout},
 		host:    strings.TrimSuffix(host, "/"),
 		version: DefaultVersion,
 		key:     key,
+		retry:   DefaultRetryPolicy,
+		upload:  DefaultUploadConfig,
 	}
 }
 
+// SetTimeout sets timeout of a single request, 0 means no timeout.
+func (c *AlphaSOCClient) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// SetRetryPolicy sets policy for retrying failed requests.
+func (c *AlphaSOCClient) SetRetryPolicy(retry RetryPolicy) {
+	c.retry = retry
+}
+
+// SetObserver sets function observing requests, e.g. to collect metrics.
+func (c *AlphaSOCClient) SetObserver(observe Observer) {
+	c.observe = observe
+}
+
 // SetKey sets API key.
 func (c *AlphaSOCClient) SetKey(key string) {
 	c.key = key
 }
 
 // CheckKey check if client has valid AlphaSOC key.
-func (c *AlphaSOCClient) CheckKey() error {
-	_, err := c.AccountStatus()
+func (c *AlphaSOCClient) CheckKey(ctx context.Context) error {
+	_, err := c.AccountStatus(ctx)
 	return err
 }
 
@@ -96,26 +144,78 @@ func (c *AlphaSOCClient) get(ctx context.Context, path string, query url.Values)
 }
 
 func (c *AlphaSOCClient) post(ctx context.Context, path string, query url.Values, obj interface{}) (*http.Response, error) {
-	var buffer bytes.Buffer
+	var body []byte
 	headers := http.Header{
 		"Content-Type": []string{"application/json"},
 	}
 
 	switch obj.(type) {
 	case []byte:
-		buffer.Write(obj.([]byte))
+		body = obj.([]byte)
 	default:
+		var buffer bytes.Buffer
 		if err := json.NewEncoder(&buffer).Encode(obj); err != nil {
 			return nil, err
 		}
+		body = buffer.Bytes()
+	}
+	return c.do(ctx, http.MethodPost, path, query, func() io.Reader {
+		return bytes.NewReader(body)
+	}, headers)
+}
+
+// do sends request and retries it according to the retry policy.
+// The body function returns a new request body for every try.
+// Non 200 responses are returned as *Error.
+func (c *AlphaSOCClient) do(ctx context.Context, method, path string, query url.Values, body func() io.Reader, headers http.Header) (*http.Response, error) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = c.retry.InitialInterval
+	b.MaxInterval = c.retry.MaxInterval
+	b.MaxElapsedTime = 0
+	b.Reset()
+
+	for retries := 0; ; retries++ {
+		start := time.Now()
+		resp, err := c.doOnce(ctx, method, path, query, body, headers)
+		if c.observe != nil {
+			c.observe(path, time.Since(start), err)
+		}
+		e, ok := err.(*Error)
+		if !ok || !e.temporary() || retries >= c.retry.MaxRetries {
+			return resp, err
+		}
+
+		delay := b.NextBackOff()
+		if e.RetryAfter > 0 {
+			if e.RetryAfter > c.retry.MaxInterval {
+				return nil, err
+			}
+			delay = e.RetryAfter
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			// return the last error, it tells more than context error
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
 	}
-	return c.do(ctx, http.MethodPost, path, query, &buffer, headers)
 }
 
-func (c *AlphaSOCClient) do(ctx context.Context, method, path string, query url.Values, body io.Reader, headers http.Header) (*http.Response, error) {
+func (c *AlphaSOCClient) doOnce(ctx context.Context, method, path string, query url.Values, body func() io.Reader, headers http.Header) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = body()
+	}
 	fullPath := c.getAPIPath(path, query)
-	req, err := http.NewRequest(method, fullPath, body)
+	req, err := http.NewRequestWithContext(ctx, method, fullPath, r)
 	if err != nil {
+		// close pipe, otherwise it's closed by the transport
+		if rc, ok := r.(io.Closer); ok {
+			rc.Close()
+		}
 		return nil, err
 	}
 	if c.key != "" {
@@ -126,26 +226,29 @@ func (c *AlphaSOCClient) do(ctx context.Context, method, path string, query url.
 		req.Header[key] = value
 	}
 
-	resp, err := ctxhttp.Do(ctx, c.client, req)
+	resp, err := c.client.Do(req)
 	if err != nil {
-		if err == context.DeadlineExceeded {
-			return nil, fmt.Errorf("%s %s i/o timeout", method, fullPath)
-		}
-		return nil, err
+		return nil, transportError(ctx, err)
 	}
 
 	if code := resp.StatusCode; code != http.StatusOK {
 		defer resp.Body.Close()
 
+		e := &Error{
+			Kind:       statusErrorKind(code),
+			StatusCode: code,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 		if code == http.StatusTooManyRequests {
-			return nil, ErrTooManyRequests
+			e.Message = ErrTooManyRequests.Error()
+			return nil, e
 		}
 
+		// the body may be empty or not json, e.g. when returned by a proxy
 		var errorResponse ErrorResponse
-		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err != nil {
-			return nil, err
-		}
-		return nil, errors.New(errorResponse.Message)
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+		e.Message = errorResponse.Message
+		return nil, e
 	}
 	return resp, nil
 }
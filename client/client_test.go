@@ -3,10 +3,13 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -29,6 +32,9 @@ func checkMethodAndPath(t *testing.T, r *http.Request, method string, path strin
 }
 
 func TestMain(m *testing.M) {
+	// don't wait for retries of failed requests in tests
+	DefaultRetryPolicy = RetryPolicy{MaxRetries: 2, InitialInterval: time.Millisecond, MaxInterval: 10 * time.Millisecond}
+
 	noopServer = httptest.NewServer(noopHandler)
 	internalServerErrorServer = httptest.NewServer(internalServerErrorHandler)
 
@@ -44,7 +50,7 @@ func TestCheckKey(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	require.NoError(t, New(ts.URL, "test-key").CheckKey())
+	require.NoError(t, New(ts.URL, "test-key").CheckKey(context.Background()))
 }
 
 func TestSetKey(t *testing.T) {
@@ -112,3 +118,165 @@ func TestDoInvalidRequest(t *testing.T) {
 	_, err := New("", "").do(context.Background(), "noop", "/", nil, nil, nil)
 	require.Error(t, err, "exptected invalid method error")
 }
+
+func TestRetryTransient(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		require.Equal(t, "{}\n", string(body), "body not resent")
+		if n++; n < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	_, err := New(ts.URL, "").post(context.Background(), "/", nil, struct{}{})
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+}
+
+func TestObserver(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n++; n < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	var errs []error
+	c := New(ts.URL, "")
+	c.SetObserver(func(path string, d time.Duration, err error) {
+		require.Equal(t, "alerts", path)
+		errs = append(errs, err)
+	})
+	_, err := c.get(context.Background(), "alerts", nil)
+	require.NoError(t, err)
+	require.Len(t, errs, 2, "every try must be observed")
+	require.True(t, IsTransient(errs[0]))
+	require.NoError(t, errs[1])
+}
+
+func TestRetryExhausted(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, "")
+	c.SetRetryPolicy(RetryPolicy{MaxRetries: 1, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond})
+	_, err := c.get(context.Background(), "/", nil)
+	require.True(t, IsTransient(err), "expected transient error, got %v", err)
+	require.Equal(t, 2, n)
+}
+
+func TestRetryAfter(t *testing.T) {
+	var n int
+	var last time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n++; n == 1 {
+			last = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		require.True(t, time.Since(last) >= time.Second, "Retry-After not honoured")
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, "")
+	c.SetRetryPolicy(RetryPolicy{MaxRetries: 1, InitialInterval: time.Millisecond, MaxInterval: 2 * time.Second})
+	_, err := c.get(context.Background(), "/", nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	_, err := New(ts.URL, "").get(context.Background(), "/", nil)
+	require.True(t, IsQuota(err), "expected quota error, got %v", err)
+	require.True(t, errors.Is(err, ErrTooManyRequests))
+	require.Equal(t, 2*time.Minute, RetryAfter(err))
+	require.Equal(t, 1, n)
+}
+
+func TestErrorKinds(t *testing.T) {
+	for _, tt := range []struct {
+		code int
+		kind ErrorKind
+	}{
+		{http.StatusBadRequest, ErrorValidation},
+		{http.StatusUnprocessableEntity, ErrorValidation},
+		{http.StatusUnauthorized, ErrorAuth},
+		{http.StatusForbidden, ErrorAuth},
+		{http.StatusPaymentRequired, ErrorQuota},
+		{http.StatusTooManyRequests, ErrorQuota},
+		{http.StatusInternalServerError, ErrorTransient},
+		{http.StatusNotFound, ErrorTransient},
+		{http.StatusProxyAuthRequired, ErrorTransient},
+		{http.StatusRequestEntityTooLarge, ErrorTransient},
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.code)
+		}))
+		_, err := New(ts.URL, "").get(context.Background(), "/", nil)
+		ts.Close()
+
+		var e *Error
+		require.True(t, errors.As(err, &e), "%d: expected *Error, got %v", tt.code, err)
+		require.Equal(t, tt.kind, e.Kind, "%d: invalid error kind", tt.code)
+		require.Equal(t, tt.code, e.StatusCode)
+	}
+}
+
+func TestNetworkErrorTransient(t *testing.T) {
+	ts := httptest.NewServer(noopHandler)
+	ts.Close()
+
+	_, err := New(ts.URL, "").get(context.Background(), "/", nil)
+	require.True(t, IsTransient(err), "expected transient error, got %v", err)
+}
+
+func TestTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	c := New(ts.URL, "")
+	c.SetTimeout(10 * time.Millisecond)
+	c.SetRetryPolicy(RetryPolicy{})
+	_, err := c.get(context.Background(), "/", nil)
+	require.True(t, IsTransient(err), "expected transient error, got %v", err)
+}
+
+func TestContextCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := New(ts.URL, "").get(ctx, "/", nil)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	require.Equal(t, time.Minute, parseRetryAfter("Wed, 01 Jan 2020 00:01:00 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("Tue, 31 Dec 2019 23:00:00 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
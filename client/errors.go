@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorKind classifies errors returned by AlphaSOC API.
+type ErrorKind int
+
+// Kinds of API errors.
+const (
+	// ErrorTransient is a server (5xx), network or unexpected http error,
+	// e.g. 404 of a wrong host, the request may succeed if retried later.
+	ErrorTransient ErrorKind = iota
+	// ErrorAuth is returned when api key is missing, invalid or revoked.
+	ErrorAuth
+	// ErrorQuota is returned when account quota or rate limit is exceeded.
+	ErrorQuota
+	// ErrorValidation is returned when API rejects request as invalid
+	// (400 or 422), the same request will never succeed.
+	ErrorValidation
+)
+
+// String returns name of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorAuth:
+		return "auth"
+	case ErrorQuota:
+		return "quota"
+	case ErrorValidation:
+		return "validation"
+	}
+	return "transient"
+}
+
+// Error is an error returned by AlphaSOC API or by the transport.
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay requested by API in Retry-After header.
+	RetryAfter time.Duration
+	// Err is the underlying transport error.
+	Err error
+}
+
+// Error returns error message.
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if e.StatusCode != 0 {
+		return http.StatusText(e.StatusCode)
+	}
+	return e.Kind.String() + " error"
+}
+
+// Unwrap returns underlying error. Quota errors caused by
+// "429 Too Many Requests" unwrap to ErrTooManyRequests.
+func (e *Error) Unwrap() error {
+	if e.Err == nil && e.StatusCode == http.StatusTooManyRequests {
+		return ErrTooManyRequests
+	}
+	return e.Err
+}
+
+// temporary reports whether the request may be retried.
+func (e *Error) temporary() bool {
+	return e.Kind == ErrorTransient || e.Kind == ErrorQuota && e.RetryAfter > 0
+}
+
+// IsTransient reports whether err is a server or network error.
+func IsTransient(err error) bool {
+	return errorKind(err) == ErrorTransient
+}
+
+// IsAuth reports whether err is caused by invalid api key.
+func IsAuth(err error) bool {
+	return errorKind(err) == ErrorAuth
+}
+
+// IsQuota reports whether err is caused by exceeded quota or rate limit.
+func IsQuota(err error) bool {
+	return errorKind(err) == ErrorQuota
+}
+
+// IsValidation reports whether err is caused by invalid request.
+func IsValidation(err error) bool {
+	return errorKind(err) == ErrorValidation
+}
+
+// RetryAfter returns delay requested by API before
+// the next request, or 0 if there is none.
+func RetryAfter(err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+func errorKind(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return -1
+}
+
+// statusErrorKind maps http status code to error kind.
+func statusErrorKind(code int) ErrorKind {
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrorAuth
+	case code == http.StatusPaymentRequired || code == http.StatusTooManyRequests:
+		return ErrorQuota
+	case code == http.StatusBadRequest || code == http.StatusUnprocessableEntity:
+		return ErrorValidation
+	}
+	// other errors, e.g. 404 of a wrong host or path, 407 and 413 of a proxy,
+	// are not caused by invalid events, so they must not be dropped
+	return ErrorTransient
+}
+
+// transportError wraps error returned by http client. Errors caused
+// by cancelled context are not wrapped, as retrying them makes no sense.
+func transportError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &Error{Kind: ErrorTransient, Err: err}
+}
+
+// parseRetryAfter parses Retry-After header value
+// given in seconds or as http date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
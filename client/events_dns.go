@@ -1,9 +1,7 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
 	"time"
 )
@@ -22,14 +20,10 @@ type EventsDNSRequest struct {
 }
 
 // EventsDNSResponse represents response for /events/dns call.
-type EventsDNSResponse struct {
-	Received int            `json:"received"`
-	Accepted int            `json:"accepted"`
-	Rejected map[string]int `json:"rejected"`
-}
+type EventsDNSResponse = EventsResponse
 
 // EventsDNS sends dns queries to AlphaSOC api for analize.
-func (c *AlphaSOCClient) EventsDNS(req *EventsDNSRequest) (*EventsDNSResponse, error) {
+func (c *AlphaSOCClient) EventsDNS(ctx context.Context, req *EventsDNSRequest) (*EventsDNSResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
@@ -38,26 +32,7 @@ func (c *AlphaSOCClient) EventsDNS(req *EventsDNSRequest) (*EventsDNSResponse, e
 		return nil, ErrNoRequest
 	}
 
-	var (
-		buffer = &bytes.Buffer{}
-		enc    = json.NewEncoder(buffer)
-	)
-
-	for _, entry := range req.Entries {
-		if err := enc.Encode(entry); err != nil {
-			return nil, err
-		}
-	}
-
-	resp, err := c.post(context.Background(), "events/dns", nil, buffer.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var r EventsDNSResponse
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return nil, err
-	}
-	return &r, nil
+	return c.postEvents(ctx, "events/dns", len(req.Entries), func(i int) interface{} {
+		return req.Entries[i]
+	})
 }
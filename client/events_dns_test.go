@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,21 +17,21 @@ func TestEventsDNS(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := New(ts.URL, "test-key").EventsDNS(&EventsDNSRequest{Entries: []*DNSEntry{{}, {}}})
+	_, err := New(ts.URL, "test-key").EventsDNS(context.Background(), &EventsDNSRequest{Entries: []*DNSEntry{{}, {}}})
 	require.NoError(t, err)
 }
 
 func TestEventsDNSFail(t *testing.T) {
-	_, err := New(internalServerErrorServer.URL, "test-key").EventsDNS(nil)
+	_, err := New(internalServerErrorServer.URL, "test-key").EventsDNS(context.Background(), nil)
 	require.Error(t, err)
 }
 
 func TestEventsDNSNoKey(t *testing.T) {
-	_, err := New("", "").EventsDNS(nil)
+	_, err := New("", "").EventsDNS(context.Background(), nil)
 	require.Equal(t, ErrNoAPIKey, err)
 }
 
 func TestEventsDNSInvalidJSON(t *testing.T) {
-	_, err := New(noopServer.URL, "test-key").EventsDNS(nil)
+	_, err := New(noopServer.URL, "test-key").EventsDNS(context.Background(), nil)
 	require.Error(t, err)
 }
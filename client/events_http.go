@@ -1,9 +1,7 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
 	"time"
 )
@@ -28,14 +26,10 @@ type HTTPEntry struct {
 }
 
 // EventsHTTPResponse represents response for /events/http call.
-type EventsHTTPResponse struct {
-	Received int            `json:"received"`
-	Accepted int            `json:"accepted"`
-	Rejected map[string]int `json:"rejected"`
-}
+type EventsHTTPResponse = EventsResponse
 
 // EventsHTTP sends http queries to AlphaSOC api for analize.
-func (c *AlphaSOCClient) EventsHTTP(events []*HTTPEntry) (*EventsHTTPResponse, error) {
+func (c *AlphaSOCClient) EventsHTTP(ctx context.Context, events []*HTTPEntry) (*EventsHTTPResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
@@ -44,26 +38,7 @@ func (c *AlphaSOCClient) EventsHTTP(events []*HTTPEntry) (*EventsHTTPResponse, e
 		return nil, ErrNoRequest
 	}
 
-	var (
-		buffer = &bytes.Buffer{}
-		enc    = json.NewEncoder(buffer)
-	)
-
-	for _, entry := range events {
-		if err := enc.Encode(entry); err != nil {
-			return nil, err
-		}
-	}
-
-	resp, err := c.post(context.Background(), "events/http", nil, buffer.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var r EventsHTTPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return nil, err
-	}
-	return &r, nil
+	return c.postEvents(ctx, "events/http", len(events), func(i int) interface{} {
+		return events[i]
+	})
 }
@@ -1,9 +1,7 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
 	"time"
 )
@@ -27,14 +25,10 @@ type EventsIPRequest struct {
 }
 
 // EventsIPResponse for logs/ip call.
-type EventsIPResponse struct {
-	Received int            `json:"received"`
-	Accepted int            `json:"accepted"`
-	Rejected map[string]int `json:"rejected"`
-}
+type EventsIPResponse = EventsResponse
 
 // EventsIP sends ip events to AlphaSOC engine for analize.
-func (c *AlphaSOCClient) EventsIP(req *EventsIPRequest) (*EventsIPResponse, error) {
+func (c *AlphaSOCClient) EventsIP(ctx context.Context, req *EventsIPRequest) (*EventsIPResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
@@ -43,26 +37,7 @@ func (c *AlphaSOCClient) EventsIP(req *EventsIPRequest) (*EventsIPResponse, erro
 		return nil, ErrNoRequest
 	}
 
-	var (
-		buffer = &bytes.Buffer{}
-		enc    = json.NewEncoder(buffer)
-	)
-
-	for _, entry := range req.Entries {
-		if err := enc.Encode(entry); err != nil {
-			return nil, err
-		}
-	}
-
-	resp, err := c.post(context.Background(), "events/ip", nil, buffer.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var r EventsIPResponse
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return nil, err
-	}
-	return &r, nil
+	return c.postEvents(ctx, "events/ip", len(req.Entries), func(i int) interface{} {
+		return req.Entries[i]
+	})
 }
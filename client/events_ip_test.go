@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,21 +17,21 @@ func TestEventsIP(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := New(ts.URL, "test-key").EventsIP(&EventsIPRequest{})
+	_, err := New(ts.URL, "test-key").EventsIP(context.Background(), &EventsIPRequest{})
 	require.NoError(t, err)
 }
 
 func TestEventsIPFail(t *testing.T) {
-	_, err := New(internalServerErrorServer.URL, "test-key").EventsIP(nil)
+	_, err := New(internalServerErrorServer.URL, "test-key").EventsIP(context.Background(), nil)
 	require.Error(t, err)
 }
 
 func TestEventsIPNoKey(t *testing.T) {
-	_, err := New("", "").EventsIP(nil)
+	_, err := New("", "").EventsIP(context.Background(), nil)
 	require.Error(t, err)
 }
 
 func TestEventsIPInvalidJSON(t *testing.T) {
-	_, err := New(noopServer.URL, "test-key").EventsIP(nil)
+	_, err := New(noopServer.URL, "test-key").EventsIP(context.Background(), nil)
 	require.Error(t, err)
 }
@@ -1,10 +1,9 @@
 package client
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -24,17 +23,29 @@ type TLSEntry struct {
 	ValidTo   time.Time `json:"validTo,omitempty"`
 	JA3       string    `json:"ja3,omitempty"`
 	JA3s      string    `json:"ja3s,omitempty"`
+
+	// ServerName is the server name indication (SNI) sent by the client.
+	// It's used for scoping events only and not sent to the Engine.
+	ServerName string `json:"-"`
 }
 
-// EventsHTTPResponse represents response for /events/http call.
-type EventsTLSResponse struct {
-	Received int            `json:"received"`
-	Accepted int            `json:"accepted"`
-	Rejected map[string]int `json:"rejected"`
+// CommonName returns common name of the certificate subject,
+// e.g. example.com for CN=example.com,O=Example.
+func (e *TLSEntry) CommonName() string {
+	for _, part := range strings.Split(e.Subject, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "CN=") {
+			return strings.TrimPrefix(part, "CN=")
+		}
+	}
+	return ""
 }
 
+// EventsTLSResponse represents response for /events/tls call.
+type EventsTLSResponse = EventsResponse
+
 // EventsHTTP sends tls events to AlphaSOC api for analize.
-func (c *AlphaSOCClient) EventsTLS(events []*TLSEntry) (*EventsTLSResponse, error) {
+func (c *AlphaSOCClient) EventsTLS(ctx context.Context, events []*TLSEntry) (*EventsTLSResponse, error) {
 	if c.key == "" {
 		return nil, ErrNoAPIKey
 	}
@@ -43,26 +54,7 @@ func (c *AlphaSOCClient) EventsTLS(events []*TLSEntry) (*EventsTLSResponse, erro
 		return nil, ErrNoRequest
 	}
 
-	var (
-		buffer = &bytes.Buffer{}
-		enc    = json.NewEncoder(buffer)
-	)
-
-	for _, entry := range events {
-		if err := enc.Encode(entry); err != nil {
-			return nil, err
-		}
-	}
-
-	resp, err := c.post(context.Background(), "events/tls", nil, buffer.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var r EventsTLSResponse
-	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
-		return nil, err
-	}
-	return &r, nil
+	return c.postEvents(ctx, "events/tls", len(events), func(i int) interface{} {
+		return events[i]
+	})
 }
@@ -21,10 +21,10 @@ type KeyRequestRequest struct {
 }
 
 // KeyRequest returns new AlphaSOC account key.
-func (c *AlphaSOCClient) KeyRequest() (*KeyRequestResponse, error) {
+func (c *AlphaSOCClient) KeyRequest(ctx context.Context) (*KeyRequestResponse, error) {
 	var req KeyRequestRequest
 	req.Platform.Name = fmt.Sprintf("nfr-%s-%s", runtime.GOOS, runtime.GOARCH)
-	resp, err := c.post(context.Background(), "key/request", nil, &req)
+	resp, err := c.post(ctx, "key/request", nil, &req)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -16,16 +17,16 @@ func TestKeyRequest(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	_, err := New(ts.URL, "").KeyRequest()
+	_, err := New(ts.URL, "").KeyRequest(context.Background())
 	require.NoError(t, err)
 }
 
 func TestKeyRequestFail(t *testing.T) {
-	_, err := New(internalServerErrorServer.URL, "").KeyRequest()
+	_, err := New(internalServerErrorServer.URL, "").KeyRequest(context.Background())
 	require.Error(t, err)
 }
 
 func TestKeyRequestInvalidJSON(t *testing.T) {
-	_, err := New(noopServer.URL, "").KeyRequest()
+	_, err := New(noopServer.URL, "").KeyRequest(context.Background())
 	require.Error(t, err)
 }
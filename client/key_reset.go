@@ -8,8 +8,8 @@ type KeyResetRequest struct {
 }
 
 // KeyReset reset AlphaSOC account key.
-func (c *AlphaSOCClient) KeyReset(req *KeyResetRequest) error {
-	resp, err := c.post(context.Background(), "key/reset", nil, req)
+func (c *AlphaSOCClient) KeyReset(ctx context.Context, req *KeyResetRequest) error {
+	resp, err := c.post(ctx, "key/reset", nil, req)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -14,9 +15,9 @@ func TestKeyReset(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	require.NoError(t, New(ts.URL, "").KeyReset(&KeyResetRequest{}))
+	require.NoError(t, New(ts.URL, "").KeyReset(context.Background(), &KeyResetRequest{}))
 }
 
 func TestResetFail(t *testing.T) {
-	require.Error(t, New(internalServerErrorServer.URL, "").KeyReset(nil))
+	require.Error(t, New(internalServerErrorServer.URL, "").KeyReset(context.Background(), nil))
 }
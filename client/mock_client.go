@@ -1,5 +1,7 @@
 package client
 
+import "context"
+
 // MockAlphaSOCClient creates Client for testing.
 type MockAlphaSOCClient struct{}
 
@@ -9,44 +11,44 @@ func NewMock() Client {
 }
 
 // AccountRegister mock.
-func (c *MockAlphaSOCClient) AccountRegister(req *AccountRegisterRequest) error {
+func (c *MockAlphaSOCClient) AccountRegister(ctx context.Context, req *AccountRegisterRequest) error {
 	return nil
 }
 
 // AccountStatus mock.
-func (c *MockAlphaSOCClient) AccountStatus() (*AccountStatusResponse, error) {
+func (c *MockAlphaSOCClient) AccountStatus(ctx context.Context) (*AccountStatusResponse, error) {
 	return &AccountStatusResponse{}, nil
 }
 
 // Alerts mock.
-func (c *MockAlphaSOCClient) Alerts(follow string) (*AlertsResponse, error) {
+func (c *MockAlphaSOCClient) Alerts(ctx context.Context, follow string) (*AlertsResponse, error) {
 	return &AlertsResponse{}, nil
 }
 
 // EventsDNS mock.
-func (c *MockAlphaSOCClient) EventsDNS(req *EventsDNSRequest) (*EventsDNSResponse, error) {
+func (c *MockAlphaSOCClient) EventsDNS(ctx context.Context, req *EventsDNSRequest) (*EventsDNSResponse, error) {
 	return &EventsDNSResponse{}, nil
 }
 
 // EventsIP mock.
-func (c *MockAlphaSOCClient) EventsIP(req *EventsIPRequest) (*EventsIPResponse, error) {
+func (c *MockAlphaSOCClient) EventsIP(ctx context.Context, req *EventsIPRequest) (*EventsIPResponse, error) {
 	return &EventsIPResponse{}, nil
 }
 
-func (c *MockAlphaSOCClient) EventsHTTP(req []*HTTPEntry) (*EventsHTTPResponse, error) {
+func (c *MockAlphaSOCClient) EventsHTTP(ctx context.Context, req []*HTTPEntry) (*EventsHTTPResponse, error) {
 	return &EventsHTTPResponse{}, nil
 }
 
-func (c *MockAlphaSOCClient) EventsTLS(req []*TLSEntry) (*EventsTLSResponse, error) {
+func (c *MockAlphaSOCClient) EventsTLS(ctx context.Context, req []*TLSEntry) (*EventsTLSResponse, error) {
 	return &EventsTLSResponse{}, nil
 }
 
 // KeyRequest mock.
-func (c *MockAlphaSOCClient) KeyRequest() (*KeyRequestResponse, error) {
+func (c *MockAlphaSOCClient) KeyRequest(ctx context.Context) (*KeyRequestResponse, error) {
 	return &KeyRequestResponse{}, nil
 }
 
 // KeyReset mock.
-func (c *MockAlphaSOCClient) KeyReset(req *KeyResetRequest) error {
+func (c *MockAlphaSOCClient) KeyReset(ctx context.Context, req *KeyResetRequest) error {
 	return nil
 }
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compressions of event uploads.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Default limits of a single events upload.
+const (
+	DefaultMaxEntries = 10000
+	DefaultMaxBytes   = 8 << 20
+)
+
+// UploadConfig describes how events are sent to AlphaSOC API.
+// Events are split into chunks, each sent in a separate request.
+type UploadConfig struct {
+	// Compression of the request body: none, gzip or zstd.
+	Compression string
+	// Maximum number of entries and maximum size of uncompressed
+	// json in a single request. Entry bigger than MaxBytes is sent alone.
+	MaxEntries int
+	MaxBytes   int
+}
+
+// DefaultUploadConfig is an upload config used by new clients.
+var DefaultUploadConfig = UploadConfig{
+	Compression: CompressionNone,
+	MaxEntries:  DefaultMaxEntries,
+	MaxBytes:    DefaultMaxBytes,
+}
+
+// EventsResponse represents response for /events/* calls. If events were
+// sent in more chunks, then counters are summed up from all chunks.
+type EventsResponse struct {
+	Received int            `json:"received"`
+	Accepted int            `json:"accepted"`
+	Rejected map[string]int `json:"rejected"`
+
+	// Chunks keeps results of every sent chunk.
+	Chunks []EventsChunk `json:"-"`
+}
+
+// EventsChunk is a result of sending a single chunk of events.
+type EventsChunk struct {
+	// Entries is a number of entries sent in the chunk.
+	Entries  int            `json:"-"`
+	Received int            `json:"received"`
+	Accepted int            `json:"accepted"`
+	Rejected map[string]int `json:"rejected"`
+}
+
+// Sent returns number of entries in successfully sent chunks.
+func (r *EventsResponse) Sent() int {
+	n := 0
+	for _, chunk := range r.Chunks {
+		n += chunk.Entries
+	}
+	return n
+}
+
+func (r *EventsResponse) add(chunk EventsChunk) {
+	r.Chunks = append(r.Chunks, chunk)
+	r.Received += chunk.Received
+	r.Accepted += chunk.Accepted
+	for reason, n := range chunk.Rejected {
+		if r.Rejected == nil {
+			r.Rejected = make(map[string]int)
+		}
+		r.Rejected[reason] += n
+	}
+}
+
+// SetUploadConfig sets compression and limits of event uploads.
+func (c *AlphaSOCClient) SetUploadConfig(cfg UploadConfig) error {
+	switch cfg.Compression {
+	case "":
+		cfg.Compression = CompressionNone
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %s", cfg.Compression)
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = DefaultMaxEntries
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	c.upload = cfg
+	return nil
+}
+
+// gzipWriters and zstdEncoders keep compressors reused by uploads.
+var gzipWriters, zstdEncoders sync.Pool
+
+// compressor returns writer compressing to w with the upload compression,
+// or nil if events are not compressed. Compressor is taken from a pool
+// and reset, release returns it to the pool once it's closed.
+func (c *AlphaSOCClient) compressor(w io.Writer) (wc io.WriteCloser, release func(), err error) {
+	switch c.upload.Compression {
+	case CompressionGzip:
+		zw, ok := gzipWriters.Get().(*gzip.Writer)
+		if ok {
+			zw.Reset(w)
+		} else {
+			zw = gzip.NewWriter(w)
+		}
+		return zw, func() { gzipWriters.Put(zw) }, nil
+	case CompressionZstd:
+		zw, ok := zstdEncoders.Get().(*zstd.Encoder)
+		if ok {
+			zw.Reset(w)
+		} else if zw, err = zstd.NewWriter(w); err != nil {
+			return nil, nil, err
+		}
+		return zw, func() { zstdEncoders.Put(zw) }, nil
+	}
+	return nil, func() {}, nil
+}
+
+// postEvents sends n entries to the events endpoint, split into chunks
+// fitting the upload limits. Every entry is encoded once, and json lines
+// of only a single chunk are kept in memory. If a chunk fails, then
+// the error is returned together with response of already sent chunks,
+// so the caller knows how many entries were sent.
+func (c *AlphaSOCClient) postEvents(ctx context.Context, path string, n int, entry func(int) interface{}) (*EventsResponse, error) {
+	headers := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+	if c.upload.Compression != CompressionNone {
+		headers.Set("Content-Encoding", c.upload.Compression)
+	}
+
+	var (
+		r     EventsResponse
+		lines [][]byte // json lines of the chunk
+		size  int
+	)
+	for i := 0; i < n; i++ {
+		line, err := json.Marshal(entry(i))
+		if err != nil {
+			return &r, err
+		}
+		line = append(line, '\n')
+		if len(lines) > 0 && (len(lines) >= c.upload.MaxEntries || size+len(line) > c.upload.MaxBytes) {
+			if err := c.postChunk(ctx, path, headers, lines, &r); err != nil {
+				return &r, err
+			}
+			lines, size = nil, 0
+		}
+		lines = append(lines, line)
+		size += len(line)
+	}
+	if len(lines) > 0 {
+		if err := c.postChunk(ctx, path, headers, lines, &r); err != nil {
+			return &r, err
+		}
+	}
+	return &r, nil
+}
+
+// postChunk sends json lines of a chunk and adds its result to r.
+func (c *AlphaSOCClient) postChunk(ctx context.Context, path string, headers http.Header, lines [][]byte, r *EventsResponse) error {
+	resp, err := c.do(ctx, http.MethodPost, path, nil, func() io.Reader {
+		return c.encodeEvents(lines)
+	}, headers)
+	if err != nil {
+		return err
+	}
+
+	chunk := EventsChunk{Entries: len(lines)}
+	err = json.NewDecoder(resp.Body).Decode(&chunk)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	r.add(chunk)
+	return nil
+}
+
+// encodeEvents returns reader streaming compressed json lines. Lines are
+// compressed while the request body is read, so the compressed body is
+// never kept in memory, and it's compressed again if the request is retried.
+func (c *AlphaSOCClient) encodeEvents(lines [][]byte) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.writeEvents(pw, lines))
+	}()
+	return pr
+}
+
+func (c *AlphaSOCClient) writeEvents(w io.Writer, lines [][]byte) error {
+	wc, release, err := c.compressor(w)
+	if err != nil {
+		return err
+	}
+	if wc != nil {
+		w = wc
+	}
+	for _, line := range lines {
+		if _, err := w.Write(line); err != nil {
+			if wc != nil {
+				wc.Close()
+			}
+			return err
+		}
+	}
+	if wc == nil {
+		return nil
+	}
+	err = wc.Close()
+	release()
+	return err
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsServer decodes uploaded events and responds with number of
+// received entries, rejecting entries with "bad" query.
+func eventsServer(t *testing.T, chunks *[]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case CompressionGzip:
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		case CompressionZstd:
+			zr, err := zstd.NewReader(r.Body)
+			require.NoError(t, err)
+			defer zr.Close()
+			body = zr
+		}
+
+		var resp EventsDNSResponse
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			var entry DNSEntry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			resp.Received++
+			if entry.Query == "bad" {
+				resp.Rejected = map[string]int{"invalid": 1}
+			} else {
+				resp.Accepted++
+			}
+		}
+		require.NoError(t, scanner.Err())
+		*chunks = append(*chunks, resp.Received)
+		json.NewEncoder(w).Encode(&resp)
+	}))
+}
+
+func dnsEntries(n int) []*DNSEntry {
+	entries := make([]*DNSEntry, n)
+	for i := range entries {
+		entries[i] = &DNSEntry{Query: "alphasoc.com"}
+	}
+	return entries
+}
+
+func TestEventsChunksByEntries(t *testing.T) {
+	var chunks []int
+	ts := eventsServer(t, &chunks)
+	defer ts.Close()
+
+	c := New(ts.URL, "test-key")
+	require.NoError(t, c.SetUploadConfig(UploadConfig{MaxEntries: 4}))
+	entries := dnsEntries(10)
+	entries[5].Query = "bad"
+
+	resp, err := c.EventsDNS(context.Background(), &EventsDNSRequest{Entries: entries})
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 4, 2}, chunks)
+	require.Equal(t, 10, resp.Received)
+	require.Equal(t, 9, resp.Accepted)
+	require.Equal(t, map[string]int{"invalid": 1}, resp.Rejected)
+	require.Len(t, resp.Chunks, 3)
+	require.Equal(t, 3, resp.Chunks[1].Accepted)
+	require.Equal(t, 10, resp.Sent())
+}
+
+func TestEventsChunksByBytes(t *testing.T) {
+	var chunks []int
+	ts := eventsServer(t, &chunks)
+	defer ts.Close()
+
+	line, err := json.Marshal(&DNSEntry{Query: "alphasoc.com"})
+	require.NoError(t, err)
+
+	c := New(ts.URL, "test-key")
+	require.NoError(t, c.SetUploadConfig(UploadConfig{MaxBytes: 3 * (len(line) + 1)}))
+	entries := dnsEntries(7)
+	// entry bigger than the limit is sent alone
+	entries[3].Query = strings.Repeat("a", 4*len(line))
+
+	_, err = c.EventsDNS(context.Background(), &EventsDNSRequest{Entries: entries})
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 1, 3}, chunks)
+}
+
+func TestEventsCompression(t *testing.T) {
+	for _, compression := range []string{CompressionGzip, CompressionZstd} {
+		var chunks []int
+		ts := eventsServer(t, &chunks)
+
+		c := New(ts.URL, "test-key")
+		require.NoError(t, c.SetUploadConfig(UploadConfig{Compression: compression, MaxEntries: 500}))
+		resp, err := c.EventsDNS(context.Background(), &EventsDNSRequest{Entries: dnsEntries(1000)})
+		ts.Close()
+
+		require.NoError(t, err, compression)
+		require.Equal(t, []int{500, 500}, chunks, compression)
+		require.Equal(t, 1000, resp.Accepted, compression)
+	}
+}
+
+func TestEventsChunkFailed(t *testing.T) {
+	var n int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if n++; n > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&EventsDNSResponse{Received: 2, Accepted: 2})
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, "test-key")
+	require.NoError(t, c.SetUploadConfig(UploadConfig{MaxEntries: 2}))
+	resp, err := c.EventsDNS(context.Background(), &EventsDNSRequest{Entries: dnsEntries(5)})
+	require.True(t, IsValidation(err), "expected validation error, got %v", err)
+	require.Equal(t, 2, resp.Sent())
+	require.Equal(t, 2, resp.Accepted)
+}
+
+func TestEventsChunkRetried(t *testing.T) {
+	var chunks []int
+	var n int
+	ts := eventsServer(t, &chunks)
+	defer ts.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first try without reading the body
+		if n++; n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ts.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	c := New(proxy.URL, "test-key")
+	require.NoError(t, c.SetUploadConfig(UploadConfig{Compression: CompressionGzip}))
+	resp, err := c.EventsDNS(context.Background(), &EventsDNSRequest{Entries: dnsEntries(100)})
+	require.NoError(t, err)
+	require.Equal(t, []int{100}, chunks)
+	require.Equal(t, 100, resp.Accepted)
+}
+
+func TestEventsEncodedOnce(t *testing.T) {
+	var chunks []int
+	ts := eventsServer(t, &chunks)
+	defer ts.Close()
+
+	c := New(ts.URL, "test-key")
+	require.NoError(t, c.SetUploadConfig(UploadConfig{MaxEntries: 3}))
+	entries := dnsEntries(10)
+	encoded := make([]int, len(entries))
+	resp, err := c.postEvents(context.Background(), "events/dns", len(entries), func(i int) interface{} {
+		encoded[i]++
+		return entries[i]
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 3, 3, 1}, chunks)
+	require.Equal(t, 10, resp.Sent())
+	for i, n := range encoded {
+		require.Equal(t, 1, n, "entry %d encoded %d times", i, n)
+	}
+}
+
+func TestSetUploadConfigInvalidCompression(t *testing.T) {
+	require.Error(t, New("", "").SetUploadConfig(UploadConfig{Compression: "lz4"}))
+}
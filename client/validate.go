@@ -0,0 +1,88 @@
+package client
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alphasoc/nfr/utils"
+)
+
+// Reasons of entries rejected by pre-send validation.
+const (
+	RejectTimestamp = "invalid_timestamp"
+	RejectIP        = "invalid_ip"
+	RejectPort      = "invalid_port"
+	RejectQuery     = "invalid_query"
+	RejectURL       = "invalid_url"
+)
+
+// MaxClockSkew is how far in the future an entry timestamp may be.
+const MaxClockSkew = time.Hour
+
+// minTimestamp is the oldest accepted entry timestamp.
+var minTimestamp = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func validTimestamp(ts, now time.Time) bool {
+	return !ts.Before(minTimestamp) && ts.Sub(now) <= MaxClockSkew
+}
+
+func validIP(ip net.IP) bool {
+	return ip != nil && !ip.IsUnspecified()
+}
+
+// Validate returns the reason the entry would be rejected
+// by AlphaSOC API, or empty string if the entry is valid.
+func (e *DNSEntry) Validate(now time.Time) string {
+	switch {
+	case !validTimestamp(e.Timestamp, now):
+		return RejectTimestamp
+	case !validIP(e.SrcIP):
+		return RejectIP
+	case !utils.IsDomainName(strings.TrimSuffix(e.Query, ".")):
+		return RejectQuery
+	}
+	return ""
+}
+
+// Validate returns the reason the entry would be rejected
+// by AlphaSOC API, or empty string if the entry is valid.
+func (e *IPEntry) Validate(now time.Time) string {
+	switch {
+	case !validTimestamp(e.Timestamp, now):
+		return RejectTimestamp
+	case !validIP(e.SrcIP) || !validIP(e.DstIP):
+		return RejectIP
+	case e.SrcPort < 0 || e.SrcPort > 65535 || e.DstPort < 0 || e.DstPort > 65535:
+		return RejectPort
+	}
+	return ""
+}
+
+// Validate returns the reason the entry would be rejected
+// by AlphaSOC API, or empty string if the entry is valid.
+func (e *HTTPEntry) Validate(now time.Time) string {
+	if !validTimestamp(e.Timestamp, now) {
+		return RejectTimestamp
+	}
+	if !validIP(e.SrcIP) {
+		return RejectIP
+	}
+	if u, err := url.Parse(e.URL); err != nil || u.Host == "" {
+		return RejectURL
+	}
+	return ""
+}
+
+// Validate returns the reason the entry would be rejected
+// by AlphaSOC API, or empty string if the entry is valid.
+func (e *TLSEntry) Validate(now time.Time) string {
+	switch {
+	case !validTimestamp(e.Timestamp, now):
+		return RejectTimestamp
+	case !validIP(e.SrcIP) || !validIP(e.DstIP):
+		return RejectIP
+	}
+	return ""
+}
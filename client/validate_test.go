@@ -0,0 +1,63 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDNSEntryValidate(t *testing.T) {
+	now := time.Now()
+	valid := DNSEntry{Timestamp: now, SrcIP: net.IPv4(10, 0, 0, 1), Query: "alphasoc.com.", QType: "aaaa"}
+
+	for _, tt := range []struct {
+		update func(*DNSEntry)
+		reason string
+	}{
+		{func(e *DNSEntry) {}, ""},
+		{func(e *DNSEntry) { e.Timestamp = time.Time{} }, RejectTimestamp},
+		{func(e *DNSEntry) { e.Timestamp = now.Add(2 * time.Hour) }, RejectTimestamp},
+		{func(e *DNSEntry) { e.SrcIP = nil }, RejectIP},
+		{func(e *DNSEntry) { e.SrcIP = net.IPv4zero }, RejectIP},
+		{func(e *DNSEntry) { e.Query = "bad..domain" }, RejectQuery},
+	} {
+		entry := valid
+		tt.update(&entry)
+		if reason := entry.Validate(now); reason != tt.reason {
+			t.Errorf("invalid reason for %+v - got %q; expected %q", entry, reason, tt.reason)
+		}
+	}
+}
+
+func TestIPEntryValidate(t *testing.T) {
+	now := time.Now()
+	valid := IPEntry{Timestamp: now, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(8, 8, 8, 8), DstPort: 443, Protocol: "tcp"}
+
+	for _, tt := range []struct {
+		update func(*IPEntry)
+		reason string
+	}{
+		{func(e *IPEntry) {}, ""},
+		{func(e *IPEntry) { e.Timestamp = time.Unix(0, 0) }, RejectTimestamp},
+		{func(e *IPEntry) { e.DstIP = nil }, RejectIP},
+		{func(e *IPEntry) { e.DstPort = 70000 }, RejectPort},
+	} {
+		entry := valid
+		tt.update(&entry)
+		if reason := entry.Validate(now); reason != tt.reason {
+			t.Errorf("invalid reason for %+v - got %q; expected %q", entry, reason, tt.reason)
+		}
+	}
+}
+
+func TestHTTPEntryValidate(t *testing.T) {
+	now := time.Now()
+	entry := HTTPEntry{Timestamp: now, SrcIP: net.IPv4(10, 0, 0, 1), URL: "http://alphasoc.com/path"}
+	if reason := entry.Validate(now); reason != "" {
+		t.Fatalf("valid entry rejected with %s", reason)
+	}
+	entry.URL = "/path"
+	if reason := entry.Validate(now); reason != RejectURL {
+		t.Fatalf("invalid reason - got %q; expected %q", reason, RejectURL)
+	}
+}
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path"
+	"time"
 
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/executor"
 	"github.com/alphasoc/nfr/utils"
 	"github.com/spf13/cobra"
 )
@@ -21,7 +25,10 @@ func newAccountRegisterCommand() *cobra.Command {
 			RunE: func(cmd *cobra.Command, args []string) error {
 				cfg := config.NewDefault()
 				cfg.Engine.Host, cfg.Engine.APIKey = host, key
-				c := client.New(host, key)
+				c, err := executor.NewClient(cfg)
+				if err != nil {
+					return err
+				}
 
 				// do not send error to log output, print on console for user
 				if err := register(cfg, c); err != nil {
@@ -43,7 +50,11 @@ func register(cfg *config.Config, c *client.AlphaSOCClient) error {
 		fmt.Printf("Using key %s for registration\n", utils.ShadowKey(cfg.Engine.APIKey))
 	}
 
-	if status, err := c.AccountStatus(); err == nil && status.Registered {
+	// don't wait for retries, the check is only informative
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	status, err := c.AccountStatus(ctx)
+	cancel()
+	if err == nil && status.Registered {
 		return fmt.Errorf("Account is already registered")
 	}
 
@@ -59,7 +70,7 @@ By performing this request you agree to our Terms of Service and Privacy Policy
 	}
 
 	if cfg.Engine.APIKey == "" {
-		keyReq, err2 := c.KeyRequest()
+		keyReq, err2 := c.KeyRequest(context.Background())
 		if err2 != nil {
 			fmt.Fprintln(os.Stderr)
 			return err2
@@ -79,6 +90,7 @@ alphasoc:
 `, cfg.Engine.APIKey)
 	} else {
 		fmt.Println("\nSuccess! The configuration has been written to /etc/nfr/config.yml")
+		fmt.Printf("The API key has been written to %s\n", path.Join(path.Dir(configPath), "api_key"))
 	}
 
 	req := &client.AccountRegisterRequest{Details: struct {
@@ -88,7 +100,7 @@ alphasoc:
 		Name:  details.Name,
 		Email: details.Email,
 	}}
-	if err := c.AccountRegister(req); err != nil {
+	if err := c.AccountRegister(context.Background(), req); err != nil {
 		if errSave != nil {
 			fmt.Fprintf(os.Stderr, `We were unable to register your account. Please run nfr again with following command:
 
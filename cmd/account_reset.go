@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"net/mail"
 
@@ -35,7 +36,7 @@ func newAccountKeyResetCommand() *cobra.Command {
 }
 
 func accountKeyReset(c client.Client, email string) error {
-	if err := c.KeyReset(&client.KeyResetRequest{Email: email}); err != nil {
+	if err := c.KeyReset(context.Background(), &client.KeyResetRequest{Email: email}); err != nil {
 		return err
 	}
 
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/spf13/cobra"
@@ -24,7 +25,7 @@ func newAccountStatusCommand() *cobra.Command {
 }
 
 func accountStatus(c client.Client) error {
-	status, err := c.AccountStatus()
+	status, err := c.AccountStatus(context.Background())
 	if err != nil {
 		return fmt.Errorf("get account status failed: %s", err)
 	}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/executor"
+	"github.com/alphasoc/nfr/utils"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// secretMask replaces secrets printed by nfr config show.
+const secretMask = "********"
+
+// secretKeys are config keys with secret values.
+var secretKeys = map[string]bool{
+	"api_key":     true,
+	"password":    true,
+	"webhook_url": true,
+}
+
+func newConfigCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "config",
+		Short: "Validate, show and create config",
+	}
+	cmd.AddCommand(newConfigValidateCommand())
+	cmd.AddCommand(newConfigShowCommand())
+	cmd.AddCommand(newConfigInitCommand())
+	return cmd
+}
+
+func newConfigValidateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate",
+		Short: "Validate config and scope files",
+		Long: `Validate config and scope files, including their fragments, monitored files
+and elasticsearch searches. Invalid fields are reported with the file and line they are set on.
+Monitored files which don't exist are reported as warnings.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.New(configPath)
+			if err != nil {
+				return err
+			}
+			if _, err := executor.NewGroups(cfg); err != nil {
+				return fmt.Errorf("%s: %s", cfg.Scope.File, err)
+			}
+
+			w := cmd.OutOrStdout()
+			for i, monitor := range cfg.Inputs.Monitors {
+				if _, err := os.Stat(monitor.File); err != nil {
+					fmt.Fprintf(w, "warning: inputs.monitor.%d: %s\n", i, err)
+				}
+			}
+			for _, file := range cfg.Files() {
+				if info, err := os.Stat(file); err == nil && !info.IsDir() {
+					fmt.Fprintf(w, "%s: ok\n", file)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func newConfigShowCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show effective config with secrets masked",
+		Long: `Show effective config, with defaults of fields not set in the config file,
+followed by scope groups as a second yaml document. Api keys, passwords,
+webhook urls and proxy credentials are masked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.New(configPath)
+			if err != nil {
+				return err
+			}
+
+			enc := yaml.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent(2)
+			for _, v := range []interface{}{cfg, &cfg.ScopeConfig} {
+				var node yaml.Node
+				if err := node.Encode(v); err != nil {
+					return err
+				}
+				maskSecrets(&node)
+				if err := enc.Encode(&node); err != nil {
+					return err
+				}
+			}
+			return enc.Close()
+		},
+	}
+}
+
+// maskSecrets masks values of secret keys and credentials of urls.
+func maskSecrets(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if value.Kind != yaml.ScalarNode || value.Value == "" {
+				continue
+			}
+			if secretKeys[key] {
+				value.Value = secretMask
+			} else if u, err := url.Parse(value.Value); err == nil && u.User != nil {
+				u.User = url.User(secretMask)
+				value.Value = u.String()
+			}
+		}
+	}
+	for _, n := range node.Content {
+		maskSecrets(n)
+	}
+}
+
+// initConfig is data of config created by nfr config init.
+type initConfig struct {
+	Interface string
+	Monitors  []config.Monitor
+}
+
+// logLocations are common locations of logs monitored by nfr.
+var logLocations = []config.Monitor{
+	{File: "/opt/zeek/logs/current/dns.log", Type: "dns", Format: "bro"},
+	{File: "/opt/zeek/logs/current/conn.log", Type: "ip", Format: "bro"},
+	{File: "/opt/zeek/logs/current/http.log", Type: "http", Format: "bro"},
+	{File: "/usr/local/zeek/logs/current/dns.log", Type: "dns", Format: "bro"},
+	{File: "/usr/local/zeek/logs/current/conn.log", Type: "ip", Format: "bro"},
+	{File: "/usr/local/zeek/logs/current/http.log", Type: "http", Format: "bro"},
+	{File: "/opt/bro/logs/current/dns.log", Type: "dns", Format: "bro"},
+	{File: "/opt/bro/logs/current/conn.log", Type: "ip", Format: "bro"},
+	{File: "/opt/bro/logs/current/http.log", Type: "http", Format: "bro"},
+	{File: "/var/log/bro/current/dns.log", Type: "dns", Format: "bro"},
+	{File: "/var/log/bro/current/conn.log", Type: "ip", Format: "bro"},
+	{File: "/var/log/bro/current/http.log", Type: "http", Format: "bro"},
+	{File: "/var/log/suricata/eve.json", Type: "dns", Format: "suricata"},
+	{File: "/var/log/suricata/eve.json", Type: "http", Format: "suricata"},
+	{File: "/var/log/named/queries.log", Type: "dns", Format: "syslog-named"},
+	{File: "/var/log/named/query.log", Type: "dns", Format: "syslog-named"},
+}
+
+// detectMonitors returns monitors of logs found in common locations.
+func detectMonitors() []config.Monitor {
+	var monitors []config.Monitor
+	for _, monitor := range logLocations {
+		if _, err := os.Stat(monitor.File); err == nil {
+			monitors = append(monitors, monitor)
+		}
+	}
+	return monitors
+}
+
+var initConfigTemplate = template.Must(template.New("config").Parse(`# Network Flight Recorder (NFR) configuration file created by nfr config init.
+# See https://github.com/alphasoc/nfr/blob/master/config.yml for all settings.
+
+engine:
+  # Your AlphaSOC API key (required to use the service)
+  # Use "nfr account register" to generate one
+  api_key: ""
+
+inputs:
+  sniffer:
+    enabled: {{if .Interface}}true{{else}}false{{end}}
+    interface: {{if .Interface}}{{.Interface}}{{else}}""{{end}}
+{{- if .Monitors}}
+  monitor:
+{{- range .Monitors}}
+  - format: {{.Format}}
+    type: {{.Type}}
+    file: {{.File}}
+{{- end}}
+{{- end}}
+
+outputs:
+  enabled: true
+  file: stderr
+`))
+
+func newConfigInitCommand() *cobra.Command {
+	var (
+		output string
+		force  bool
+	)
+	var cmd = &cobra.Command{
+		Use:   "init",
+		Short: "Create starter config",
+		Long: `Create starter config sniffing the interface with a public ip address
+and monitoring zeek (bro), suricata and named logs found in common locations.
+Alerts are written to stderr. Existing file is not overwritten without --force.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output == "" {
+				output = configPath
+			}
+			if _, err := os.Stat(output); err == nil && !force {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+			}
+
+			var data initConfig
+			if iface, err := utils.InterfaceWithPublicIP(); err == nil && iface != nil {
+				data.Interface = iface.Name
+			}
+			data.Monitors = detectMonitors()
+			if data.Interface == "" && len(data.Monitors) == 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "warning: no interface with public ip nor logs found, set inputs in the config")
+			}
+
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				return err
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := initConfigTemplate.Execute(f, &data); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "config written to %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File the config is written to (default --config)")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing file")
+	return cmd
+}
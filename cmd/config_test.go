@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alphasoc/nfr/config"
+)
+
+func TestInitConfigValid(t *testing.T) {
+	for _, data := range []initConfig{
+		{},
+		{Interface: "eth0", Monitors: logLocations},
+	} {
+		file := filepath.Join(t.TempDir(), "config.yml")
+		f, err := os.Create(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := initConfigTemplate.Execute(f, &data); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		if _, err := config.New(file); err != nil {
+			t.Fatalf("init config with %d monitors is invalid: %s", len(data.Monitors), err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/enginetest"
+	"github.com/spf13/cobra"
+)
+
+func newDevCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "dev",
+		Short: "Tools for testing nfr pipelines",
+	}
+	cmd.AddCommand(newDevEngineCommand())
+	return cmd
+}
+
+func newDevEngineCommand() *cobra.Command {
+	var (
+		listen   string
+		rules    []string
+		keys     []string
+		pageSize int
+	)
+
+	var cmd = &cobra.Command{
+		Use:   "engine",
+		Short: "Run fake AlphaSOC Engine on localhost",
+		Long: `Run fake AlphaSOC Engine for testing nfr pipelines without connecting
+to AlphaSOC api. The engine accepts dns, ip, http and tls events, and raises
+alerts for events matching rules. Rules files with .yml or .yaml extension
+contain a list of rules, e.g.
+
+- threat: c2_communication
+  severity: 5
+  domains: ["*.evil.com"]
+  ips: [203.0.113.0/24]
+
+Any other file is a list of domains, ips and cidrs, one per line.
+Set engine.host to http://<listen address> in nfr config to use the engine.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s := enginetest.NewServer()
+			s.AlertsPageSize = pageSize
+			for _, file := range rules {
+				rules, err := enginetest.LoadRules(file)
+				if err != nil {
+					return err
+				}
+				for _, rule := range rules {
+					if err := s.AddRule(rule); err != nil {
+						return err
+					}
+				}
+			}
+			for _, key := range keys {
+				s.AddKey(key)
+			}
+
+			log.Infof("fake engine listening on %s", listen)
+			return http.ListenAndServe(listen, logRequests(s))
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:8080", "Address to listen on")
+	cmd.Flags().StringSliceVar(&rules, "rules", nil, "Rules files raising alerts")
+	cmd.Flags().StringSliceVar(&keys, "key", nil, "Accepted api keys, any key is accepted if not set")
+	cmd.Flags().IntVar(&pageSize, "page-size", enginetest.DefaultAlertsPageSize, "Maximum number of alerts in a single response")
+	return cmd
+}
+
+// statusWriter records response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// logRequests logs requests served by the handler.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(sw, r)
+		log.WithFields(log.Fields{
+			"status":   sw.code,
+			"duration": time.Since(start),
+		}).Infof("%s %s", r.Method, r.URL.Path)
+	})
+}
@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"os"
 	"path"
 	"runtime"
 
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/executor"
 	"github.com/alphasoc/nfr/logger"
 	"github.com/spf13/cobra"
 )
@@ -27,7 +29,7 @@ func init() {
 // NewRootCommand represents the base command when called without any subcommands
 func NewRootCommand() *cobra.Command {
 	var cmd = &cobra.Command{
-		Use:   "nfr account|listen|read|version",
+		Use:   "nfr account|config|dev|listen|read|scope|status|version",
 		Short: "nfr is main command used to send dns and ip events to AlphaSOC Engine",
 		Long: `Network Flight Recorder (NFR) is an application which captures network traffic
 and provides deep analysis and alerting of suspicious events, identifying gaps
@@ -42,6 +44,10 @@ in your security controls, highlighting targeted attacks and policy violations.`
 	cmd.AddCommand(newAccountCommand())
 	cmd.AddCommand(newStartCommand())
 	cmd.AddCommand(newReadCommand())
+	cmd.AddCommand(newDevCommand())
+	cmd.AddCommand(newStatusCommand())
+	cmd.AddCommand(newScopeCommand())
+	cmd.AddCommand(newConfigCommand())
 	return cmd
 }
 
@@ -57,9 +63,12 @@ func createConfigAndClient(checkKey bool) (*config.Config, *client.AlphaSOCClien
 	}
 	logger.SetLevel(cfg.Log.Level)
 
-	c := client.New(cfg.Engine.Host, cfg.Engine.APIKey)
+	c, err := executor.NewClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
 	if checkKey {
-		if err := c.CheckKey(); err != nil {
+		if err := c.CheckKey(context.Background()); err != nil {
 			return nil, nil, err
 		}
 	}
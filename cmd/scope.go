@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/executor"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newScopeCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "scope",
+		Short: "Test monitoring scope",
+	}
+	cmd.AddCommand(newScopeTestCommand())
+	return cmd
+}
+
+// scopeCase is an event tested against the monitoring scope.
+type scopeCase struct {
+	Name   string `yaml:"name"`
+	Src    string `yaml:"src"`
+	Dst    string `yaml:"dst,omitempty"`
+	Port   int    `yaml:"port,omitempty"`
+	Proto  string `yaml:"proto,omitempty"`
+	Domain string `yaml:"domain,omitempty"`
+	URL    string `yaml:"url,omitempty"`
+	// tls session of events to dst (and port)
+	SNI     string `yaml:"sni,omitempty"`
+	Subject string `yaml:"subject,omitempty"`
+	Cert    string `yaml:"cert,omitempty"`
+	JA3     string `yaml:"ja3,omitempty"`
+	JA3S    string `yaml:"ja3s,omitempty"`
+	// InScope is the expected decision for test cases read from file.
+	InScope bool `yaml:"in_scope"`
+}
+
+// scopeDecision is a decision of whitelisting event of a type.
+type scopeDecision struct {
+	eventType string
+	group     string
+	inScope   bool
+}
+
+func newScopeTestCommand() *cobra.Command {
+	var (
+		c    scopeCase
+		file string
+	)
+	var cmd = &cobra.Command{
+		Use:   "test",
+		Short: "Explain scope decisions of an event",
+		Long: `Explain scope decisions of an event, loading the scope of the config.
+For each scope group it shows whether the source ip is in scope or out of scope,
+whether the destination ip, domain, url and tls session are trusted and whether
+the destination port and protocol are in scope, followed by the decision of dns
+(--domain), http (--url), tls (--dst and --port with --sni, --subject, --cert,
+--ja3 or --ja3s) and ip (--dst, --port and --proto) events. Destination ip
+of dns queries is not considered.
+
+Test cases read from file with --file are checked against the expected decision
+and the command fails if any of them doesn't match, e.g.
+
+- name: workstation query
+  src: 10.1.2.3
+  domain: foo.example.com
+  in_scope: true
+- name: trusted dns server
+  src: 10.1.2.3
+  dst: 10.0.0.53
+  in_scope: false
+- name: ntp
+  src: 10.1.2.3
+  dst: 203.0.113.1
+  port: 123
+  proto: udp
+  in_scope: false
+- name: corporate agent
+  src: 10.1.2.3
+  dst: 203.0.113.2
+  port: 443
+  ja3: e7d705a3286e19ea42f587b344ee6865
+  in_scope: false`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.New(configPath)
+			if err != nil {
+				return err
+			}
+			g, err := executor.NewGroups(cfg)
+			if err != nil {
+				return err
+			}
+
+			if file != "" {
+				return testScopeFile(cmd.OutOrStdout(), g, file)
+			}
+			if c.Src == "" {
+				return errors.New("--src or --file is required")
+			}
+			if c.Dst == "" && c.Domain == "" && c.URL == "" {
+				return errors.New("--dst, --domain or --url is required")
+			}
+			return explainScope(cmd.OutOrStdout(), g, &c)
+		},
+	}
+	cmd.Flags().StringVar(&c.Src, "src", "", "Source ip of the event")
+	cmd.Flags().StringVar(&c.Dst, "dst", "", "Destination ip of the event")
+	cmd.Flags().IntVar(&c.Port, "port", 0, "Destination port of ip event")
+	cmd.Flags().StringVar(&c.Proto, "proto", "", "Protocol of ip event, e.g. tcp or udp")
+	cmd.Flags().StringVar(&c.Domain, "domain", "", "Queried domain of dns event")
+	cmd.Flags().StringVar(&c.URL, "url", "", "Requested url of http event")
+	cmd.Flags().StringVar(&c.SNI, "sni", "", "Server name of tls event")
+	cmd.Flags().StringVar(&c.Subject, "subject", "", "Certificate subject of tls event, e.g. CN=example.com")
+	cmd.Flags().StringVar(&c.Cert, "cert", "", "Certificate sha1 fingerprint of tls event")
+	cmd.Flags().StringVar(&c.JA3, "ja3", "", "JA3 hash of tls event")
+	cmd.Flags().StringVar(&c.JA3S, "ja3s", "", "JA3S hash of tls event")
+	cmd.Flags().StringVar(&file, "file", "", "File with test cases")
+	return cmd
+}
+
+// decide returns scope decisions of events described by the case.
+func (c *scopeCase) decide(g *groups.Groups) ([]scopeDecision, error) {
+	src, dst, err := c.ips()
+	if err != nil {
+		return nil, err
+	}
+
+	var decisions []scopeDecision
+	if c.Domain != "" {
+		// destination of dns queries is not considered, as by nfr
+		group, ok := g.IsDNSQueryWhitelisted(c.Domain, src, nil)
+		decisions = append(decisions, scopeDecision{"dns", group, ok})
+	}
+	if c.URL != "" {
+		group, ok := g.IsHTTPQueryWhitelisted(c.URL, src)
+		decisions = append(decisions, scopeDecision{"http", group, ok})
+	}
+	if tls := c.tls(src, dst); tls != nil {
+		if dst == nil {
+			return nil, errors.New("dst is required for tls event")
+		}
+		group, ok := g.IsTLSWhitelisted(tls)
+		decisions = append(decisions, scopeDecision{"tls", group, ok})
+	} else if dst != nil {
+		group, ok := g.IsIPWhitelisted(src, dst, c.Port, c.Proto)
+		decisions = append(decisions, scopeDecision{"ip", group, ok})
+	}
+	if len(decisions) == 0 {
+		return nil, errors.New("dst, domain or url is required")
+	}
+	return decisions, nil
+}
+
+// tls returns tls session of the case, or nil if the case
+// is not a tls event.
+func (c *scopeCase) tls(src, dst net.IP) *client.TLSEntry {
+	if c.SNI == "" && c.Subject == "" && c.Cert == "" && c.JA3 == "" && c.JA3S == "" {
+		return nil
+	}
+	return &client.TLSEntry{
+		SrcIP:      src,
+		DstIP:      dst,
+		DstPort:    uint16(c.Port),
+		ServerName: c.SNI,
+		Subject:    c.Subject,
+		CertHash:   c.Cert,
+		JA3:        c.JA3,
+		JA3s:       c.JA3S,
+	}
+}
+
+// ips parses source and destination ips of the case.
+func (c *scopeCase) ips() (src, dst net.IP, err error) {
+	if src = net.ParseIP(c.Src); src == nil {
+		return nil, nil, fmt.Errorf("invalid source ip %q", c.Src)
+	}
+	if c.Dst != "" {
+		if dst = net.ParseIP(c.Dst); dst == nil {
+			return nil, nil, fmt.Errorf("invalid destination ip %q", c.Dst)
+		}
+	}
+	return src, dst, nil
+}
+
+// String describes the decision.
+func (d scopeDecision) String() string {
+	if d.inScope {
+		return d.eventType + ": in scope"
+	}
+	switch d.group {
+	case "", "<no-match>":
+		return d.eventType + ": out of scope, source ip is not in scope of any group"
+	case "<no-data>":
+		return d.eventType + ": out of scope, missing event data"
+	}
+	return fmt.Sprintf("%s: out of scope, excluded by group %s", d.eventType, d.group)
+}
+
+// explainScope writes matches of scope groups and decisions of the case.
+func explainScope(w io.Writer, g *groups.Groups, c *scopeCase) error {
+	decisions, err := c.decide(g)
+	if err != nil {
+		return err
+	}
+	src, dst, _ := c.ips()
+	domain := c.Domain
+	if domain == "" && c.URL != "" {
+		domain = groups.URLDomain(c.URL)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	tls := c.tls(src, dst)
+	fmt.Fprintln(tw, "GROUP\tSOURCE\tDESTINATION\tPORT\tDOMAIN\tURL\tTLS")
+	for _, m := range g.Explain(src, dst, c.Port, c.Proto, domain, c.URL, tls) {
+		source := "not in scope"
+		if m.SrcIncluded {
+			source = "in scope"
+			if m.SrcExcluded {
+				source = "out of scope"
+			}
+		}
+		port := "-"
+		if c.Port != 0 || c.Proto != "" {
+			port = "in scope"
+			if m.PortExcluded {
+				port = "out of scope"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", m.Group, source,
+			trusted(m.DstExcluded, dst != nil), port, trusted(m.DomainExcluded, domain != ""),
+			trusted(m.URLExcluded, c.URL != ""), trusted(m.TLSExcluded, tls != nil))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	if tenant := g.TenantBySrcIP(src); tenant != "" {
+		fmt.Fprintf(w, "tenant: %s\n", tenant)
+	}
+	for _, d := range decisions {
+		fmt.Fprintln(w, d)
+	}
+	return nil
+}
+
+// trusted describes whether destination ip, domain, url or tls session is trusted by a group.
+func trusted(excluded, set bool) string {
+	switch {
+	case !set:
+		return "-"
+	case excluded:
+		return "trusted"
+	}
+	return "not trusted"
+}
+
+// testScopeFile checks decisions of test cases read from file.
+func testScopeFile(w io.Writer, g *groups.Groups, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var cases []scopeCase
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&cases); err != nil && err != io.EOF {
+		return fmt.Errorf("parsing test cases: %w", err)
+	}
+
+	failed := 0
+	for i := range cases {
+		c := &cases[i]
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+
+		decisions, err := c.decide(g)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		ok := true
+		for _, d := range decisions {
+			if d.inScope != c.InScope {
+				ok = false
+				fmt.Fprintf(w, "FAIL %s: %s\n", name, d)
+			} else {
+				fmt.Fprintf(w, "ok   %s: %s\n", name, d)
+			}
+		}
+		if !ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scope test cases failed", failed, len(cases))
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/status"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCommand() *cobra.Command {
+	var (
+		addr    string
+		asJSON  bool
+		timeout time.Duration
+	)
+	var cmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show health and status of running nfr",
+		Long: `Show health and status of running nfr, queried from the status endpoint
+enabled in the status section of the config.
+
+The exit code is suitable for Nagios checks: 0 - ok, 1 - warning,
+2 - critical, 3 - unknown (nfr is not running or status is disabled).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if addr == "" {
+				addr = statusAddr(cmd.ErrOrStderr())
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			r, err := status.Fetch(ctx, addr)
+			if err != nil {
+				fmt.Printf("NFR UNKNOWN: can't get status from %s: %s\n", addr, err)
+				os.Exit(int(status.Unknown))
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				err = enc.Encode(r)
+			} else {
+				err = r.WriteSummary(os.Stdout)
+			}
+			if err != nil {
+				return err
+			}
+			if state := r.State(); state != status.OK {
+				os.Exit(int(state))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&addr, "addr", "", "Status address, host:port or unix:/path/to/socket (default from config)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print status report in json")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of the status request")
+	return cmd
+}
+
+// statusAddr returns status listen address from config, or the default
+// address if config doesn't exist or can't be read.
+func statusAddr(w io.Writer) string {
+	addr, err := config.StatusListen(configPath)
+	if err != nil {
+		addr = config.NewDefault().Status.Listen
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(w, "warning: %s, using default status address %s\n", err, addr)
+		}
+	}
+	return addr
+}
@@ -237,3 +237,160 @@ group:
 		t.Errorf("invalid error type - got %T; expected %T", err, want)
 	}
 }
+
+func TestReadScopeTenants(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{"defaults", `
+groups:
+  acme:
+    in_scope: [10.1.0.0/16]
+    engine:
+      api_key: acme-key
+`, false},
+		{"shared", `
+groups:
+  acme-lan:
+    in_scope: [10.1.0.0/16]
+    engine: {tenant: acme, api_key: acme-key}
+  acme-wifi:
+    in_scope: [10.2.0.0/16]
+    engine: {tenant: acme, api_key: acme-key}
+`, false},
+		{"conflicting keys", `
+groups:
+  acme-lan:
+    engine: {tenant: acme, api_key: acme-key}
+  acme-wifi:
+    engine: {tenant: acme, api_key: other-key}
+`, true},
+		{"missing key", `
+groups:
+  acme:
+    engine: {host: "https://engine.local"}
+`, true},
+		{"invalid tenant", `
+groups:
+  acme:
+    engine: {tenant: "acme/lan", api_key: acme-key}
+`, true},
+	}
+
+	for _, tt := range tests {
+		file := path.Join(t.TempDir(), "scope.yml")
+		if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := NewDefault()
+		cfg.Scope.File = file
+		err := cfg.loadScopeConfig()
+		if (err != nil) != tt.err {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.name != "defaults" || err != nil {
+			continue
+		}
+
+		tenant, ok := cfg.Tenants()["acme"]
+		if !ok {
+			t.Fatalf("%s: no acme tenant %v", tt.name, cfg.Tenants())
+		}
+		if tenant.Host != cfg.Engine.Host || tenant.APIKey != "acme-key" {
+			t.Fatalf("%s: invalid tenant %+v", tt.name, tenant)
+		}
+	}
+}
+
+func TestReadScopeSampling(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{"valid", `
+groups:
+  guest:
+    analyze: {dns: true, ip: false, http: false}
+    sample_rate: {dns: 0.5}
+`, false},
+		{"unknown type", `
+groups:
+  guest:
+    analyze: {tls: false}
+`, true},
+		{"enabled globally disabled", `
+groups:
+  guest:
+    analyze: {http: true}
+`, true},
+		{"invalid rate", `
+groups:
+  guest:
+    sample_rate: {ip: 10}
+`, true},
+	}
+
+	for _, tt := range tests {
+		file := path.Join(t.TempDir(), "scope.yml")
+		if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := NewDefault()
+		cfg.Engine.Analyze.HTTP = false
+		cfg.Scope.File = file
+		if err := cfg.loadScopeConfig(); (err != nil) != tt.err {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+}
+
+func TestReadScopeTrusted(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{"valid", `
+groups:
+  private:
+    trusted_certs:
+    - 2fd4e1c67a2d28fced849ee1bb76e7391b93eb12
+    - 2F:D4:E1:C6:7A:2D:28:FC:ED:84:9E:E1:BB:76:E7:39:1B:93:EB:12
+    trusted_ja3: [e7d705a3286e19ea42f587b344ee6865]
+    trusted_urls: ["*.windowsupdate.com/msdownload/", "https://cdn.example.com/*.js"]
+`, false},
+		{"invalid url", `
+groups:
+  private:
+    trusted_urls: ["windowsupdate.com:http/msdownload/"]
+`, true},
+		{"invalid cert", `
+groups:
+  private:
+    trusted_certs: [2fd4e1c67a2d]
+`, true},
+		{"invalid ja3", `
+groups:
+  private:
+    trusted_ja3: [corporate-agent]
+`, true},
+	}
+
+	for _, tt := range tests {
+		file := path.Join(t.TempDir(), "scope.yml")
+		if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cfg := NewDefault()
+		cfg.Scope.File = file
+		if err := cfg.loadScopeConfig(); (err != nil) != tt.err {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+	}
+}
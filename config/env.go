@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of environment variables overriding config fields.
+const envPrefix = "NFR"
+
+// envRegexp matches ${VAR} and ${VAR:-default} references in config values.
+// $${VAR} is an escaped reference kept as ${VAR}.
+var envRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces environment variable references in scalar values
+// of the node. It returns true if any value was changed.
+func expandEnv(node *yaml.Node) (bool, error) {
+	expanded := false
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		var err error
+		value := envRegexp.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			m := envRegexp.FindStringSubmatch(ref)
+			if v, ok := os.LookupEnv(m[1]); ok {
+				return v
+			}
+			if m[2] == "" && err == nil {
+				err = fmt.Errorf("line %d: environment variable %s is not set", node.Line, m[1])
+			}
+			return m[3]
+		})
+		if err != nil {
+			return false, err
+		}
+		if value != node.Value {
+			node.Value = value
+			// plain values are resolved again, e.g. ${PORT} as int
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+			expanded = true
+		}
+	}
+	for _, n := range node.Content {
+		ok, err := expandEnv(n)
+		if err != nil {
+			return false, err
+		}
+		expanded = expanded || ok
+	}
+	return expanded, nil
+}
+
+// applyEnv overrides config fields by NFR_* environment variables named
+// after the path of the field, e.g. NFR_ENGINE_API_KEY for engine.api_key.
+// Values other than strings are parsed as yaml, e.g. NFR_OUTPUTS_EMAIL_TO='[a@example.com]'.
+func (cfg *Config) applyEnv() error {
+	return applyEnv(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			if err := applyEnv(v.Field(i), prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+
+		key := prefix + "_" + strings.ToUpper(name)
+		value, ok := os.LookupEnv(key)
+		switch {
+		case ok && field.Type.Kind() == reflect.String:
+			v.Field(i).SetString(value)
+		case ok:
+			if err := yaml.Unmarshal([]byte(value), v.Field(i).Addr().Interface()); err != nil {
+				return fmt.Errorf("invalid %s value: %w", key, err)
+			}
+		case field.Type.Kind() == reflect.Struct:
+			if err := applyEnv(v.Field(i), key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readSecret reads secret from file, if set. Leading and trailing
+// whitespace of the secret, e.g. new line, is removed.
+func readSecret(path string, secret *string, file string) error {
+	if file == "" {
+		return nil
+	}
+	if *secret != "" {
+		return fmt.Errorf("%s and %s_file are mutually exclusive", path, path)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("can't read secret: %w", err)
+	}
+	*secret = strings.TrimSpace(string(content))
+	return nil
+}
+
+// loadSecrets reads secrets set by *_file fields.
+func (cfg *Config) loadSecrets() error {
+	for _, s := range []struct {
+		path   string
+		secret *string
+		file   string
+	}{
+		{"engine.api_key", &cfg.Engine.APIKey, cfg.Engine.APIKeyFile},
+		{"outputs.email.password", &cfg.Outputs.Email.Password, cfg.Outputs.Email.PasswordFile},
+		{"inputs.elastic.api_key", &cfg.Inputs.Elastic.APIKey, cfg.Inputs.Elastic.APIKeyFile},
+		{"inputs.elastic.password", &cfg.Inputs.Elastic.Password, cfg.Inputs.Elastic.PasswordFile},
+	} {
+		if err := readSecret(s.path, s.secret, s.file); err != nil {
+			return fieldError(s.path+"_file", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestEnvInterpolation(t *testing.T) {
+	t.Setenv("NFR_TEST_KEY", "test-key")
+	t.Setenv("NFR_TEST_PORT", "1514")
+	file := writeFile(t, t.TempDir(), "config.yml", `
+engine:
+  api_key: ${NFR_TEST_KEY}
+outputs:
+  syslog:
+    ip: ${NFR_TEST_IP:-127.0.0.1}
+    port: ${NFR_TEST_PORT}
+  email:
+    subject: "$${NFR_TEST_KEY}"
+`)
+
+	cfg, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Engine.APIKey != "test-key" {
+		t.Errorf("invalid api key - got %q; expected %q", cfg.Engine.APIKey, "test-key")
+	}
+	if cfg.Outputs.Syslog.IP != "127.0.0.1" || cfg.Outputs.Syslog.Port != 1514 {
+		t.Errorf("invalid syslog address - got %s:%d; expected 127.0.0.1:1514", cfg.Outputs.Syslog.IP, cfg.Outputs.Syslog.Port)
+	}
+	if cfg.Outputs.Email.Subject != "${NFR_TEST_KEY}" {
+		t.Errorf("escaped reference replaced - got %q", cfg.Outputs.Email.Subject)
+	}
+
+	file = writeFile(t, t.TempDir(), "config.yml", "engine:\n  api_key: ${NFR_TEST_UNSET}\n")
+	if _, err := New(file); err == nil || !strings.Contains(err.Error(), "NFR_TEST_UNSET is not set") {
+		t.Fatalf("invalid error of unset variable - got %v", err)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("NFR_ENGINE_API_KEY", "env-key")
+	t.Setenv("NFR_ENGINE_ALERTS_POLL_INTERVAL", "1m")
+	t.Setenv("NFR_OUTPUTS_EMAIL_TO", "[a@example.com, b@example.com]")
+	t.Setenv("NFR_INPUTS_ELASTIC_USERNAME", "elastic")
+	file := writeFile(t, t.TempDir(), "config.yml", "engine:\n  api_key: file-key\n")
+
+	cfg, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Engine.APIKey != "env-key" {
+		t.Errorf("invalid api key - got %q; expected %q", cfg.Engine.APIKey, "env-key")
+	}
+	if cfg.Engine.Alerts.PollInterval != time.Minute {
+		t.Errorf("invalid poll interval - got %s; expected %s", cfg.Engine.Alerts.PollInterval, time.Minute)
+	}
+	if len(cfg.Outputs.Email.To) != 2 || cfg.Outputs.Email.To[1] != "b@example.com" {
+		t.Errorf("invalid email recipients - got %v", cfg.Outputs.Email.To)
+	}
+	if cfg.Inputs.Elastic.Username != "elastic" {
+		t.Errorf("invalid elastic username - got %q; expected %q", cfg.Inputs.Elastic.Username, "elastic")
+	}
+
+	t.Setenv("NFR_DNS_EVENTS_BUFFER_SIZE", "many")
+	if _, err := New(file); err == nil || !strings.Contains(err.Error(), "NFR_DNS_EVENTS_BUFFER_SIZE") {
+		t.Fatalf("invalid error of invalid value - got %v", err)
+	}
+}
+
+func TestSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "api_key", "secret-key\n")
+	writeFile(t, dir, "es_password", "secret-password\n")
+	writeFile(t, dir, "tenant_key", "tenant-key\n")
+	scope := writeFile(t, dir, "scope.yml", `
+groups:
+  private:
+    in_scope: [10.0.0.0/8]
+    engine:
+      api_key_file: `+filepath.Join(dir, "tenant_key")+`
+`)
+	file := writeFile(t, dir, "config.yml", `
+engine:
+  api_key_file: `+filepath.Join(dir, "api_key")+`
+inputs:
+  elastic:
+    password_file: `+filepath.Join(dir, "es_password")+`
+scope:
+  file: `+scope+`
+`)
+
+	cfg, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Engine.APIKey != "secret-key" {
+		t.Errorf("invalid api key - got %q; expected %q", cfg.Engine.APIKey, "secret-key")
+	}
+	if cfg.Inputs.Elastic.Password != "secret-password" {
+		t.Errorf("invalid elastic password - got %q; expected %q", cfg.Inputs.Elastic.Password, "secret-password")
+	}
+	if key := cfg.ScopeConfig.Groups["private"].Engine.APIKey; key != "tenant-key" {
+		t.Errorf("invalid tenant api key - got %q; expected %q", key, "tenant-key")
+	}
+
+	t.Setenv("NFR_ENGINE_API_KEY", "env-key")
+	if _, err := New(file); err == nil {
+		t.Fatal("expected error of api key set with api key file")
+	}
+}
+
+func TestSaveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yml")
+	cfg := NewDefault()
+	cfg.Engine.APIKey = "secret-key"
+	if err := cfg.Save(file); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "secret-key") {
+		t.Fatal("api key saved in config")
+	}
+	info, err := os.Stat(filepath.Join(dir, "api_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("invalid api key file mode - got %s; expected %s", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	cfg, err = New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Engine.APIKey != "secret-key" {
+		t.Errorf("invalid api key - got %q; expected %q", cfg.Engine.APIKey, "secret-key")
+	}
+}
+
+func TestStatusListen(t *testing.T) {
+	// config is invalid, but status address can be read
+	file := writeFile(t, t.TempDir(), "config.yml", `
+engine:
+  api_key_file: /nonexistent
+status:
+  listen: 127.0.0.1:9000
+`)
+	if _, err := New(file); err == nil {
+		t.Fatal("expected error of invalid config")
+	}
+	addr, err := StatusListen(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "127.0.0.1:9000" {
+		t.Fatalf("invalid status address - got %s; expected 127.0.0.1:9000", addr)
+	}
+
+	if _, err := StatusListen(filepath.Join(t.TempDir(), "config.yml")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected error of missing config - got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+)
+
+// FieldError is a validation error of a config field.
+type FieldError struct {
+	// Path of the field, e.g. outputs.email or inputs.monitor.0.format.
+	Path string
+	Err  error
+
+	// File and line of the field, or the closest parent set in the config.
+	// The file is the main config file or the fragment the field is set in.
+	// Line is 0 if the file is unknown.
+	File string
+	Line int
+}
+
+func (e *FieldError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Err)
+}
+
+// Unwrap returns the validation error.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError returns validation error err of the field at path.
+func fieldError(path string, err error) error {
+	return &FieldError{Path: path, Err: err}
+}
+
+// fieldErrorf returns formatted validation error of the field at path.
+func fieldErrorf(path, format string, args ...interface{}) error {
+	return fieldError(path, fmt.Errorf(format, args...))
+}
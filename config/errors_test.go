@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFieldErrorLine(t *testing.T) {
+	for _, tt := range []struct {
+		content string
+		path    string
+		line    int
+	}{
+		{"log:\n  file: stdout\n  level: verbose\n", "log.level", 3},
+		{"inputs:\n  monitor:\n  - file: a.log\n    type: dns\n    format: bro\n  - file: b.log\n    type: dns\n    format: xml\n", "inputs.monitor.1.format", 8},
+		// closest parent of the field with default value
+		{"outputs:\n  enabled: true\n  email:\n    enabled: true\n", "outputs.email", 3},
+	} {
+		file := path.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(file, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var ferr *FieldError
+		if _, err := New(file); !errors.As(err, &ferr) {
+			t.Fatalf("invalid error - got %v; expected field error", err)
+		}
+		if ferr.Path != tt.path || ferr.File != file || ferr.Line != tt.line {
+			t.Errorf("invalid field error - got %s:%d %s; expected %s:%d %s",
+				ferr.File, ferr.Line, ferr.Path, file, tt.line, tt.path)
+		}
+	}
+}
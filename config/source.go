@@ -0,0 +1,205 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// source is a yaml document merged from the main file and its fragments,
+// with the file each node was read from.
+type source struct {
+	file  string
+	root  *yaml.Node
+	files map[*yaml.Node]string
+	// read are files and directories the document was read from.
+	read []string
+}
+
+// loadSource reads the main file into v, merged with fragments matching
+// include globs of the main file and yaml files in confDir, if set.
+// Maps are merged deeply, lists are appended and other values are
+// overridden by fragments read later. Fragments are read in the order
+// of include globs, then files of confDir, each sorted by name.
+func loadSource(file, confDir string, v interface{}) (*source, error) {
+	root, err := readYAML(file, v)
+	if err != nil {
+		return nil, err
+	}
+	s := &source{file: file, root: root, files: make(map[*yaml.Node]string), read: []string{file}}
+
+	var include struct {
+		Include []string `yaml:"include"`
+	}
+	if err := root.Decode(&include); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	patterns := include.Include
+	if confDir != "" {
+		if info, err := os.Stat(confDir); err == nil && info.IsDir() {
+			patterns = append(patterns, filepath.Join(confDir, "*.yml"))
+			s.read = append(s.read, confDir)
+		}
+	}
+
+	seen := map[string]bool{filepath.Clean(file): true}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %s: %w", file, pattern, err)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+
+			node, err := readYAML(match, v)
+			if err != nil {
+				return nil, err
+			}
+			s.merge(s.root, node, match)
+			s.read = append(s.read, match)
+		}
+	}
+
+	if err := s.root.Decode(v); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readYAML reads mapping of yaml file, replacing environment variable
+// references in values of the file. The file is checked to be decodable
+// into a value of v type, with no unknown fields.
+func readYAML(file string, v interface{}) (*yaml.Node, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	expanded, err := expandEnv(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	// re-encode only when needed, to keep line numbers of decoding errors
+	if expanded {
+		if content, err = yaml.Marshal(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(reflect.New(reflect.TypeOf(v).Elem()).Interface()); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return doc.Content[0], nil
+}
+
+// merge merges mapping src read from file into mapping dst.
+func (s *source) merge(dst, src *yaml.Node, file string) {
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		if key.Value == "include" || value.Tag == "!!null" {
+			continue
+		}
+
+		j := 0
+		for ; j+1 < len(dst.Content) && dst.Content[j].Value != key.Value; j += 2 {
+		}
+		if j+1 >= len(dst.Content) {
+			s.mark(key, file)
+			s.mark(value, file)
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+
+		old := dst.Content[j+1]
+		switch {
+		case old.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			s.merge(old, value, file)
+		case old.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			for _, item := range value.Content {
+				s.mark(item, file)
+			}
+			old.Content = append(old.Content, value.Content...)
+		default:
+			s.mark(key, file)
+			s.mark(value, file)
+			dst.Content[j], dst.Content[j+1] = key, value
+		}
+	}
+}
+
+// mark records file of the node and its children.
+func (s *source) mark(node *yaml.Node, file string) {
+	s.files[node] = file
+	for _, n := range node.Content {
+		s.mark(n, file)
+	}
+}
+
+// locate sets location of the invalid field, if err is a field error.
+func (s *source) locate(err error) error {
+	var ferr *FieldError
+	if s == nil || !errors.As(err, &ferr) {
+		return err
+	}
+	node := s.field(ferr.Path)
+	ferr.File, ferr.Line = s.file, node.Line
+	if file, ok := s.files[node]; ok {
+		ferr.File = file
+	}
+	return err
+}
+
+// field returns node of the field at path, that is the key of a mapping
+// or an item of a sequence, or of its closest parent if the field is not set.
+func (s *source) field(path string) *yaml.Node {
+	node, field := s.root, s.root
+	for _, key := range strings.Split(path, ".") {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next, field = node.Content[i+1], node.Content[i]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+				next, field = node.Content[i], node.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return field
+}
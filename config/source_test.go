@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLoadFragments(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "roles"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, "roles/sniffer.yml", `
+engine:
+  analyze:
+    ip: false
+`)
+	writeFile(t, dir, "conf.d/10-dns.yml", `
+inputs:
+  monitor:
+  - file: /var/log/dns.log
+    type: dns
+    format: bro
+`)
+	writeFile(t, dir, "conf.d/20-outputs.yml", `
+outputs:
+  file: `+filepath.Join(dir, "alerts.json")+`
+`)
+	writeFile(t, dir, "scope-extra.yml", `
+groups:
+  private:
+    in_scope: [192.168.0.0/16]
+  dmz:
+    in_scope: [172.16.0.0/12]
+`)
+	writeFile(t, dir, "scope.yml", `
+include: [scope-extra.yml]
+groups:
+  private:
+    in_scope: [10.0.0.0/8]
+`)
+	file := writeFile(t, dir, "config.yml", `
+include: [roles/*.yml]
+engine:
+  api_key: test
+inputs:
+  monitor:
+  - file: /var/log/conn.log
+    type: ip
+    format: bro
+scope:
+  file: `+filepath.Join(dir, "scope.yml")+`
+`)
+
+	cfg, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Engine.Analyze.DNS || cfg.Engine.Analyze.IP {
+		t.Errorf("invalid analyze - got dns %t ip %t; expected dns true ip false", cfg.Engine.Analyze.DNS, cfg.Engine.Analyze.IP)
+	}
+	if len(cfg.Inputs.Monitors) != 2 || cfg.Inputs.Monitors[1].File != "/var/log/dns.log" {
+		t.Errorf("monitors not appended - got %v", cfg.Inputs.Monitors)
+	}
+	if cfg.Outputs.File != filepath.Join(dir, "alerts.json") {
+		t.Errorf("invalid output file - got %s; expected %s", cfg.Outputs.File, filepath.Join(dir, "alerts.json"))
+	}
+	if l := len(cfg.ScopeConfig.Groups); l != 2 {
+		t.Fatalf("invalid number of scope groups - got %d; expected %d", l, 2)
+	}
+	if in := cfg.ScopeConfig.Groups["private"].InScope; len(in) != 2 {
+		t.Errorf("scope group not merged - got %v", in)
+	}
+	if l := len(cfg.Files()); l != 7 {
+		t.Errorf("invalid number of config files - got %d (%v); expected %d", l, cfg.Files(), 7)
+	}
+
+	// errors name the fragment of the invalid field
+	fragment := writeFile(t, dir, "conf.d/30-http.yml", `
+inputs:
+  monitor:
+  - file: /var/log/http.log
+    type: http
+    format: xml
+`)
+	var ferr *FieldError
+	if _, err := New(file); !errors.As(err, &ferr) {
+		t.Fatalf("invalid error - got %v; expected field error", err)
+	}
+	if ferr.File != fragment || ferr.Line != 6 || ferr.Path != "inputs.monitor.2.format" {
+		t.Errorf("invalid field error - got %s:%d %s; expected %s:%d %s",
+			ferr.File, ferr.Line, ferr.Path, fragment, 6, "inputs.monitor.2.format")
+	}
+}
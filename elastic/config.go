@@ -117,6 +117,7 @@ var defaultFieldNames = map[client.EventType]map[IndexSchema]FieldNamesConfig{
 			ValidTo:       []string{"tls", "server", "not_after"},
 			JA3:           []string{"tls", "client", "ja3"},
 			JA3s:          []string{"tls", "server", "ja3s"},
+			ServerName:    []string{"tls", "client", "server_name"},
 		},
 	},
 }
@@ -159,6 +160,8 @@ type FieldNamesConfig struct {
 	ValidTo   FieldPath `yaml:"valid_to"`
 	JA3       FieldPath `yaml:"ja3"`
 	JA3s      FieldPath `yaml:"ja3s"`
+	// ServerName is only used for scoping, see trusted_domains of scope groups.
+	ServerName FieldPath `yaml:"server_name"`
 }
 
 // SearchConfig contains all necessary information for
@@ -189,6 +192,10 @@ type Config struct {
 	Username string   `yaml:"username"`
 	Password string   `yaml:"password"`
 
+	// Files with api key and password, e.g. mounted secrets.
+	APIKeyFile   string `yaml:"api_key_file,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+
 	Searches []*SearchConfig `yaml:"searches"`
 }
 
@@ -397,7 +404,8 @@ func (sc *SearchConfig) EventFields() ([]string, error) {
 	case client.EventTypeTLS:
 		fields = append(fields,
 			fn.DstIP.Join(), fn.DstPort.Join(), fn.CertHash.Join(), fn.Issuer.Join(),
-			fn.Subject.Join(), fn.ValidFrom.Join(), fn.ValidTo.Join(), fn.JA3.Join(), fn.JA3s.Join())
+			fn.Subject.Join(), fn.ValidFrom.Join(), fn.ValidTo.Join(), fn.JA3.Join(), fn.JA3s.Join(),
+			fn.ServerName.Join())
 	default:
 		return nil, fmt.Errorf("event type %s is not supported", sc.EventType)
 	}
@@ -341,6 +341,7 @@ func (h *Hit) DecodeTLS(cfg *SearchConfig) (*client.TLSEntry, error) {
 	e.ValidTo = h.sourceTimestamp(fn.ValidTo)
 	e.JA3 = h.sourceString(fn.JA3)
 	e.JA3s = h.sourceString(fn.JA3s)
+	e.ServerName = h.sourceString(fn.ServerName)
 
 	return e, nil
 }
@@ -0,0 +1,145 @@
+package enginetest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alphasoc/nfr/matchers"
+	"gopkg.in/yaml.v3"
+)
+
+// Default threat raised by rules without threat.
+const (
+	DefaultThreat   = "c2_communication"
+	DefaultSeverity = 5
+)
+
+// Rule raises an alert with the threat for events matching
+// any of rule domains or ip addresses.
+type Rule struct {
+	// Threat id and its details returned with alerts.
+	Threat   string `yaml:"threat"`
+	Title    string `yaml:"title"`
+	Severity int    `yaml:"severity"`
+	Policy   bool   `yaml:"policy"`
+
+	// Domains matched against dns queries, http url hosts and tls
+	// certificate subjects. Use *.example.com to match subdomains.
+	Domains []string `yaml:"domains"`
+	// IPs are destination ip addresses or cidrs of ip and tls events.
+	IPs []string `yaml:"ips"`
+
+	dm  *matchers.Domain
+	ips []*net.IPNet
+}
+
+// LoadRules loads rules from file. Files with .yml or .yaml extension
+// contain a list of rules with threat, title, severity, policy, domains
+// and ips keys, see Rule. Any other file is a list of domains, ips and cidrs, one per line,
+// raising the default threat. Lines starting with # are ignored.
+func LoadRules(file string) ([]*Rule, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []*Rule
+	switch filepath.Ext(file) {
+	case ".yml", ".yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("parsing rules file: %w", err)
+		}
+	default:
+		rule := &Rule{}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			switch {
+			case line == "" || strings.HasPrefix(line, "#"):
+			case isIPOrCIDR(line):
+				rule.IPs = append(rule.IPs, line)
+			default:
+				rule.Domains = append(rule.Domains, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// compile sets rule defaults and prepares matchers.
+func (r *Rule) compile() (err error) {
+	if r.Threat == "" {
+		r.Threat = DefaultThreat
+	}
+	if r.Title == "" {
+		r.Title = r.Threat
+	}
+	if r.Severity == 0 {
+		r.Severity = DefaultSeverity
+	}
+
+	if r.dm, err = matchers.NewDomain(r.Domains); err != nil {
+		return fmt.Errorf("rule %s: %s", r.Threat, err)
+	}
+	r.ips = nil
+	for _, s := range r.IPs {
+		ipnet, err := parseIPOrCIDR(s)
+		if err != nil {
+			return fmt.Errorf("rule %s: %s", r.Threat, err)
+		}
+		r.ips = append(r.ips, ipnet)
+	}
+	return nil
+}
+
+// matchDomain reports whether the domain matches the rule.
+func (r *Rule) matchDomain(domain string) bool {
+	return r.dm.Match(strings.ToLower(strings.TrimSuffix(domain, ".")))
+}
+
+// matchIP reports whether the ip matches the rule.
+func (r *Rule) matchIP(ip net.IP) bool {
+	for _, ipnet := range r.ips {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIPOrCIDR(s string) bool {
+	_, err := parseIPOrCIDR(s)
+	return err == nil
+}
+
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an ip or cidr", s)
+	}
+	return ipnet, nil
+}
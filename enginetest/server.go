@@ -0,0 +1,440 @@
+// Package enginetest provides a fake AlphaSOC Engine for testing nfr
+// pipelines without connecting to AlphaSOC api. The server records
+// received events and raises alerts for events matching rules.
+package enginetest
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/klauspost/compress/zstd"
+)
+
+// RejectJSON is a reason of rejected events that are not valid json.
+const RejectJSON = "invalid_json"
+
+// DefaultAlertsPageSize is a maximum number of alerts returned by
+// a single alerts call, more alerts are returned with the more flag.
+const DefaultAlertsPageSize = 100
+
+// Server is a fake AlphaSOC Engine implementing http.Handler.
+type Server struct {
+	// AlertsPageSize is a maximum number of alerts in a single response.
+	AlertsPageSize int
+
+	mx         sync.Mutex
+	mux        *http.ServeMux
+	rules      []*Rule
+	keys       map[string]bool
+	registered bool
+	now        func() time.Time
+
+	dns  []*client.DNSEntry
+	ip   []*client.IPEntry
+	http []*client.HTTPEntry
+	tls  []*client.TLSEntry
+
+	alerts  []client.Alert
+	threats map[string]client.Threat
+}
+
+// NewServer creates new fake AlphaSOC Engine.
+func NewServer() *Server {
+	s := &Server{
+		AlertsPageSize: DefaultAlertsPageSize,
+		mux:            http.NewServeMux(),
+		keys:           make(map[string]bool),
+		now:            time.Now,
+		threats:        make(map[string]client.Threat),
+	}
+	s.mux.HandleFunc("/v1/events/dns", s.handleEvents(client.EventTypeDNS))
+	s.mux.HandleFunc("/v1/events/ip", s.handleEvents(client.EventTypeIP))
+	s.mux.HandleFunc("/v1/events/http", s.handleEvents(client.EventTypeHTTP))
+	s.mux.HandleFunc("/v1/events/tls", s.handleEvents(client.EventTypeTLS))
+	s.mux.HandleFunc("/v1/alerts", s.handleAlerts)
+	s.mux.HandleFunc("/v1/account/status", s.handleAccountStatus)
+	s.mux.HandleFunc("/v1/account/register", s.handleAccountRegister)
+	s.mux.HandleFunc("/v1/key/request", s.handleKeyRequest)
+	s.mux.HandleFunc("/v1/key/reset", s.handleKeyReset)
+	return s
+}
+
+// AddRule adds rule raising alerts for matching events.
+func (s *Server) AddRule(rule *Rule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.rules = append(s.rules, rule)
+	return nil
+}
+
+// AddKey adds api key accepted by the server. If no key
+// is added, then any non empty key is accepted.
+func (s *Server) AddKey(key string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.keys[key] = true
+}
+
+// DNS returns received dns events.
+func (s *Server) DNS() []*client.DNSEntry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]*client.DNSEntry(nil), s.dns...)
+}
+
+// IP returns received ip events.
+func (s *Server) IP() []*client.IPEntry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]*client.IPEntry(nil), s.ip...)
+}
+
+// HTTP returns received http events.
+func (s *Server) HTTP() []*client.HTTPEntry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]*client.HTTPEntry(nil), s.http...)
+}
+
+// TLS returns received tls events.
+func (s *Server) TLS() []*client.TLSEntry {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]*client.TLSEntry(nil), s.tls...)
+}
+
+// Alerts returns all raised alerts.
+func (s *Server) Alerts() []client.Alert {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return append([]client.Alert(nil), s.alerts...)
+}
+
+// ServeHTTP serves AlphaSOC api requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorized checks api key of the request and writes error if it's invalid.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	key, _, _ := r.BasicAuth()
+
+	s.mx.Lock()
+	ok := key != "" && (len(s.keys) == 0 || s.keys[key])
+	s.mx.Unlock()
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+	}
+	return ok
+}
+
+func (s *Server) handleEvents(eventType client.EventType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if !s.authorized(w, r) {
+			return
+		}
+
+		body, err := decodeBody(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer body.Close()
+
+		var resp client.EventsResponse
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(nil, client.DefaultMaxBytes)
+		for scanner.Scan() {
+			if len(strings.TrimSpace(scanner.Text())) == 0 {
+				continue
+			}
+			resp.Received++
+			if reason := s.addEvent(eventType, scanner.Bytes()); reason != "" {
+				if resp.Rejected == nil {
+					resp.Rejected = make(map[string]int)
+				}
+				resp.Rejected[reason]++
+				continue
+			}
+			resp.Accepted++
+		}
+		if err := scanner.Err(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, &resp)
+	}
+}
+
+// addEvent decodes and records a single event. It returns
+// the reason the event was rejected, or empty string.
+func (s *Server) addEvent(eventType client.EventType, line []byte) string {
+	now := s.now()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	switch eventType {
+	case client.EventTypeDNS:
+		var entry client.DNSEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return RejectJSON
+		}
+		if reason := entry.Validate(now); reason != "" {
+			return reason
+		}
+		s.dns = append(s.dns, &entry)
+		s.match(eventType, client.EventUnified{
+			Timestamp: entry.Timestamp,
+			SrcIP:     entry.SrcIP,
+			Query:     entry.Query,
+			QueryType: entry.QType,
+		}, entry.Query, nil)
+	case client.EventTypeIP:
+		var entry client.IPEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return RejectJSON
+		}
+		if reason := entry.Validate(now); reason != "" {
+			return reason
+		}
+		s.ip = append(s.ip, &entry)
+		s.match(eventType, client.EventUnified{
+			Timestamp: entry.Timestamp,
+			SrcIP:     entry.SrcIP,
+			SrcPort:   uint16(entry.SrcPort),
+			DestIP:    entry.DstIP,
+			DestPort:  uint16(entry.DstPort),
+			Proto:     entry.Protocol,
+			BytesIn:   int64(entry.BytesIn),
+			BytesOut:  int64(entry.BytesOut),
+			Ja3:       entry.Ja3,
+		}, "", entry.DstIP)
+	case client.EventTypeHTTP:
+		var entry client.HTTPEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return RejectJSON
+		}
+		if reason := entry.Validate(now); reason != "" {
+			return reason
+		}
+		s.http = append(s.http, &entry)
+		var host string
+		if u, err := url.Parse(entry.URL); err == nil {
+			host = u.Hostname()
+		}
+		s.match(eventType, client.EventUnified{
+			Timestamp:   entry.Timestamp,
+			SrcIP:       entry.SrcIP,
+			SrcPort:     entry.SrcPort,
+			URL:         entry.URL,
+			Method:      entry.Method,
+			Status:      int32(entry.Status),
+			Action:      entry.Action,
+			ContentType: entry.ContentType,
+			Referrer:    entry.Referrer,
+			UserAgent:   entry.UserAgent,
+			BytesIn:     entry.BytesIn,
+			BytesOut:    entry.BytesOut,
+		}, host, net.ParseIP(host))
+	case client.EventTypeTLS:
+		var entry client.TLSEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return RejectJSON
+		}
+		if reason := entry.Validate(now); reason != "" {
+			return reason
+		}
+		s.tls = append(s.tls, &entry)
+		s.match(eventType, client.EventUnified{
+			Timestamp: entry.Timestamp,
+			SrcIP:     entry.SrcIP,
+			SrcPort:   entry.SrcPort,
+			DestIP:    entry.DstIP,
+			DestPort:  entry.DstPort,
+			Ja3:       entry.JA3,
+		}, entry.CommonName(), entry.DstIP)
+	}
+	return ""
+}
+
+// match raises an alert if event domain or ip matches any rule.
+// It must be called with the server mutex held.
+func (s *Server) match(eventType client.EventType, event client.EventUnified, domain string, ip net.IP) {
+	var threats []string
+	for _, rule := range s.rules {
+		if (domain != "" && rule.matchDomain(domain)) || (ip != nil && rule.matchIP(ip)) {
+			threats = append(threats, rule.Threat)
+			s.threats[rule.Threat] = client.Threat{
+				Title:    rule.Title,
+				Severity: rule.Severity,
+				Policy:   rule.Policy,
+			}
+		}
+	}
+	if len(threats) == 0 {
+		return
+	}
+	s.alerts = append(s.alerts, client.Alert{
+		EventType: string(eventType),
+		Event:     event,
+		Threats:   threats,
+	})
+}
+
+// handleAlerts returns alerts after the follow id. The follow id is
+// an index of the next alert, so polling with the returned follow id
+// returns only new alerts.
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	var from int
+	if follow := r.URL.Query().Get("follow"); follow != "" {
+		n, err := strconv.Atoi(follow)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid follow id")
+			return
+		}
+		from = n
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if from > len(s.alerts) {
+		from = len(s.alerts)
+	}
+	to := len(s.alerts)
+	if s.AlertsPageSize > 0 && to-from > s.AlertsPageSize {
+		to = from + s.AlertsPageSize
+	}
+
+	resp := client.AlertsResponse{
+		Follow:  strconv.Itoa(to),
+		More:    to < len(s.alerts),
+		Alerts:  s.alerts[from:to],
+		Threats: make(map[string]client.Threat),
+	}
+	for _, alert := range resp.Alerts {
+		for _, tid := range alert.Threats {
+			resp.Threats[tid] = s.threats[tid]
+		}
+	}
+	writeJSON(w, &resp)
+}
+
+func (s *Server) handleAccountStatus(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+	s.mx.Lock()
+	resp := client.AccountStatusResponse{Registered: s.registered}
+	s.mx.Unlock()
+	writeJSON(w, &resp)
+}
+
+func (s *Server) handleAccountRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	var req client.AccountRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if req.Details.Name == "" || req.Details.Email == "" {
+		writeError(w, http.StatusBadRequest, "name and email are required")
+		return
+	}
+	s.mx.Lock()
+	s.registered = true
+	s.mx.Unlock()
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) handleKeyRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	key := "test-key-" + strconv.FormatInt(s.now().UnixNano(), 36)
+	s.AddKey(key)
+	writeJSON(w, &client.KeyRequestResponse{Key: key})
+}
+
+func (s *Server) handleKeyReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	var req client.KeyResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if req.Email == "" {
+		writeError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+	writeJSON(w, struct{}{})
+}
+
+// decodeBody returns request body reader decompressing
+// gzip and zstd content encoding.
+func decodeBody(r *http.Request) (io.ReadCloser, error) {
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+		return r.Body, nil
+	case client.CompressionGzip:
+		return gzip.NewReader(r.Body)
+	case client.CompressionZstd:
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %s", r.Header.Get("Content-Encoding"))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&client.ErrorResponse{Message: message})
+}
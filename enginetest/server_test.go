@@ -0,0 +1,158 @@
+package enginetest
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer starts fake engine and returns client connected to it.
+func newTestServer(t *testing.T) (*Server, *client.AlphaSOCClient, string) {
+	s := NewServer()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	c := client.New(ts.URL, "test-key")
+	c.SetRetryPolicy(client.RetryPolicy{})
+	return s, c, ts.URL
+}
+
+func TestServerEvents(t *testing.T) {
+	s, c, _ := newTestServer(t)
+	require.NoError(t, s.AddRule(&Rule{Threat: "c2_communication", Domains: []string{"*.evil.com"}}))
+	require.NoError(t, s.AddRule(&Rule{Threat: "tor_exit", Severity: 3, IPs: []string{"203.0.113.0/24"}}))
+	require.NoError(t, c.SetUploadConfig(client.UploadConfig{Compression: client.CompressionGzip}))
+
+	src := net.IPv4(10, 0, 0, 1)
+	now := time.Now()
+	resp, err := c.EventsDNS(context.Background(), &client.EventsDNSRequest{Entries: []*client.DNSEntry{
+		{Timestamp: now, SrcIP: src, Query: "alphasoc.com", QType: "A"},
+		{Timestamp: now, SrcIP: src, Query: "c2.evil.com", QType: "A"},
+		{Timestamp: now, SrcIP: nil, Query: "c2.evil.com", QType: "A"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, 3, resp.Received)
+	require.Equal(t, 2, resp.Accepted)
+	require.Equal(t, map[string]int{client.RejectIP: 1}, resp.Rejected)
+	require.Len(t, s.DNS(), 2)
+
+	_, err = c.EventsIP(context.Background(), &client.EventsIPRequest{Entries: []*client.IPEntry{
+		{Timestamp: now, SrcIP: src, DstIP: net.IPv4(203, 0, 113, 7), DstPort: 443, Protocol: "tcp"},
+		{Timestamp: now, SrcIP: src, DstIP: net.IPv4(198, 51, 100, 1), DstPort: 443, Protocol: "tcp"},
+	}})
+	require.NoError(t, err)
+	_, err = c.EventsTLS(context.Background(), []*client.TLSEntry{
+		{Timestamp: now, SrcIP: src, DstIP: net.IPv4(198, 51, 100, 1), Subject: "CN=www.evil.com,O=Evil"},
+	})
+	require.NoError(t, err)
+
+	alerts, err := c.Alerts(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, alerts.Alerts, 3)
+	require.Equal(t, "dns", alerts.Alerts[0].EventType)
+	require.Equal(t, "c2.evil.com", alerts.Alerts[0].Event.Query)
+	require.Equal(t, []string{"tor_exit"}, alerts.Alerts[1].Threats)
+	require.Equal(t, "tls", alerts.Alerts[2].EventType)
+	require.Equal(t, 3, alerts.Threats["tor_exit"].Severity)
+	require.Equal(t, DefaultSeverity, alerts.Threats["c2_communication"].Severity)
+}
+
+func TestServerAlertsFollow(t *testing.T) {
+	s, c, _ := newTestServer(t)
+	s.AlertsPageSize = 2
+	require.NoError(t, s.AddRule(&Rule{Domains: []string{"evil.com"}}))
+
+	entries := make([]*client.DNSEntry, 3)
+	for i := range entries {
+		entries[i] = &client.DNSEntry{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), Query: "evil.com", QType: "A"}
+	}
+	_, err := c.EventsDNS(context.Background(), &client.EventsDNSRequest{Entries: entries})
+	require.NoError(t, err)
+
+	alerts, err := c.Alerts(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, alerts.Alerts, 2)
+	require.True(t, alerts.More)
+
+	alerts, err = c.Alerts(context.Background(), alerts.Follow)
+	require.NoError(t, err)
+	require.Len(t, alerts.Alerts, 1)
+	require.False(t, alerts.More)
+
+	// nothing new after the last follow id
+	alerts, err = c.Alerts(context.Background(), alerts.Follow)
+	require.NoError(t, err)
+	require.Empty(t, alerts.Alerts)
+	require.Equal(t, "3", alerts.Follow)
+}
+
+func TestServerAccount(t *testing.T) {
+	s, c, url := newTestServer(t)
+	s.AddKey("other-key")
+
+	_, err := c.AccountStatus(context.Background())
+	require.True(t, client.IsAuth(err), "expected auth error, got %v", err)
+
+	key, err := client.New(url, "").KeyRequest(context.Background())
+	require.NoError(t, err)
+
+	c = client.New(url, key.Key)
+	status, err := c.AccountStatus(context.Background())
+	require.NoError(t, err)
+	require.False(t, status.Registered)
+
+	var req client.AccountRegisterRequest
+	req.Details.Name = "Test"
+	req.Details.Email = "test@example.com"
+	require.NoError(t, c.AccountRegister(context.Background(), &req))
+	status, err = c.AccountStatus(context.Background())
+	require.NoError(t, err)
+	require.True(t, status.Registered)
+
+	err = client.New(url, "").KeyReset(context.Background(), &client.KeyResetRequest{Email: "test@example.com"})
+	require.True(t, client.IsAuth(err), "expected auth error, got %v", err)
+	err = c.KeyReset(context.Background(), &client.KeyResetRequest{})
+	require.True(t, client.IsValidation(err), "expected validation error, got %v", err)
+	require.NoError(t, c.KeyReset(context.Background(), &client.KeyResetRequest{Email: "test@example.com"}))
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+
+	list := filepath.Join(dir, "blocklist.txt")
+	require.NoError(t, os.WriteFile(list, []byte("# test list\nevil.com\n*.evil.net\n\n203.0.113.1\n198.51.100.0/24\n"), 0644))
+	rules, err := LoadRules(list)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.Equal(t, DefaultThreat, rules[0].Threat)
+	require.Equal(t, []string{"evil.com", "*.evil.net"}, rules[0].Domains)
+	require.True(t, rules[0].matchDomain("a.evil.net."))
+	require.True(t, rules[0].matchIP(net.IPv4(203, 0, 113, 1)))
+	require.True(t, rules[0].matchIP(net.IPv4(198, 51, 100, 9)))
+	require.False(t, rules[0].matchIP(net.IPv4(203, 0, 113, 2)))
+
+	yml := filepath.Join(dir, "rules.yml")
+	require.NoError(t, os.WriteFile(yml, []byte(`
+- threat: cryptomining
+  title: Cryptomining
+  severity: 4
+  policy: true
+  domains: ["*.pool.example"]
+`), 0644))
+	rules, err = LoadRules(yml)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.Equal(t, 4, rules[0].Severity)
+	require.True(t, rules[0].Policy)
+
+	require.NoError(t, os.WriteFile(yml, []byte("- domains: [\"not a domain\"]\n"), 0644))
+	_, err = LoadRules(yml)
+	require.Error(t, err)
+}
@@ -9,8 +9,11 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -19,6 +22,8 @@ import (
 	"github.com/alphasoc/nfr/config"
 	"github.com/alphasoc/nfr/elastic"
 	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/heuristics"
+	"github.com/alphasoc/nfr/ioc"
 	"github.com/alphasoc/nfr/logs"
 	"github.com/alphasoc/nfr/logs/bro"
 	"github.com/alphasoc/nfr/logs/edge"
@@ -26,34 +31,91 @@ import (
 	"github.com/alphasoc/nfr/logs/pcap"
 	"github.com/alphasoc/nfr/logs/suricata"
 	"github.com/alphasoc/nfr/logs/syslognamed"
+	"github.com/alphasoc/nfr/metrics"
 	"github.com/alphasoc/nfr/packet"
+	"github.com/alphasoc/nfr/response"
 	"github.com/alphasoc/nfr/sniffer"
 	"github.com/alphasoc/nfr/utils"
+	"github.com/google/gopacket"
 	"github.com/hpcloud/tail"
 )
 
 // Executor executes main nfr loop. It's respnsible for start the sniffer,
 // send ip/dns events to AlphaSOC Engine and poll alerts from it.
 type Executor struct {
-	c   client.Client
-	cfg *config.Config
-
-	alertsPoller *alerts.Poller
+	// cfg is the running config, replaced as a whole on reload
+	// and read with config.
+	cfg   *config.Config
+	cfgMx sync.RWMutex
+
+	// ctx is used for all requests to AlphaSOC Engine. It's canceled
+	// if buffered events are not sent within shutdown timeout.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// done is canceled when the executor is stopped.
+	done context.Context
+
+	// sends waits for buffers sent in background.
+	sends sync.WaitGroup
+
+	// inputs waits for the sniffer, monitored files and elasticsearch
+	// searches to stop.
+	inputs sync.WaitGroup
+
+	// tenants are AlphaSOC Engine accounts events are sent to,
+	// the first one is the default tenant.
+	tenants       []*tenant
+	tenantsByName map[string]*tenant
+
+	// outputs alerts are written to through outputsWriter, replaced
+	// on reload and guarded by mx. emailStop stops the email digest.
+	outputs       []*output
+	outputsWriter *alerts.MultiWriter
+	emailStop     context.CancelFunc
+	correlator    *alerts.Correlator
+	blocklist     *response.Blocklist
+	ioc           *ioc.Detector
+
+	// localAlerts queues alerts of local detectors, so slow outputs
+	// don't block the sniffer and monitors.
+	localAlerts *alerts.QueueWriter
+
+	dnsHeuristics *heuristics.DNSDetector
+	beacons       *heuristics.BeaconDetector
 
 	groups *groups.Groups
 
-	dnsbuf    *packet.DNSPacketBuffer
-	dnsWriter *packet.Writer
-
-	ipbuf    *packet.IPPacketBuffer
-	ipWriter *packet.Writer
-
-	httpbuf    *packet.HTTPPacketBuffer
+	dnsWriter  *packet.Writer
+	ipWriter   *packet.Writer
 	httpWriter *packet.Writer
 
 	sniffer sniffer.Sniffer
 	lr      logs.FileParser
 
+	rejects *rejectStats
+
+	// metrics of executor state, checkpoints of elasticsearch
+	// searches and monitored files reported by them.
+	metrics     *metrics.Registry
+	checkpoints map[string]time.Time
+	tails       map[string]*tail.Tail
+
+	// running monitors and elasticsearch searches stopped
+	// when removed from the config on reload.
+	monitors  map[config.Monitor]context.CancelFunc
+	searches  []*search
+	searchSeq int
+
+	// configFiles are config and scope files watched for changes.
+	configFiles []string
+
+	// status of the packet sender and inputs reported by status endpoints.
+	started     time.Time
+	flushed     map[string]time.Time
+	monitorErrs map[string]error
+	searchErrs  map[string]error
+
 	// mutex for synchronize sending packets.
 	mx sync.Mutex
 }
@@ -71,134 +133,366 @@ func getFormatter(format string) alerts.Formatter {
 	return f
 }
 
+// NewClient creates AlphaSOC client with timeout, retry policy,
+// upload, tls and proxy settings from engine configuration.
+func NewClient(cfg *config.Config) (*client.AlphaSOCClient, error) {
+	return newClient(cfg, cfg.Engine.Host, cfg.Engine.APIKey)
+}
+
+// newClient creates AlphaSOC client for given host and api key
+// with the rest of settings from engine configuration.
+func newClient(cfg *config.Config, host, apiKey string) (*client.AlphaSOCClient, error) {
+	c := client.New(host, apiKey)
+	c.SetObserver(observeAPIRequest)
+	c.SetTimeout(cfg.Engine.Timeout)
+	c.SetRetryPolicy(client.RetryPolicy{
+		MaxRetries:      cfg.Engine.Retry.MaxRetries,
+		InitialInterval: cfg.Engine.Retry.InitialInterval,
+		MaxInterval:     cfg.Engine.Retry.MaxInterval,
+	})
+	err := c.SetUploadConfig(client.UploadConfig{
+		Compression: cfg.Engine.Upload.Compression,
+		MaxEntries:  cfg.Engine.Upload.MaxEntries,
+		MaxBytes:    cfg.Engine.Upload.MaxBytes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = c.SetTransport(client.TLSConfig{
+		CAFile:     cfg.Engine.TLS.CAFile,
+		CertFile:   cfg.Engine.TLS.CertFile,
+		KeyFile:    cfg.Engine.TLS.KeyFile,
+		MinVersion: cfg.Engine.TLS.MinVersion,
+		ServerName: cfg.Engine.TLS.ServerName,
+	}, client.ProxyConfig{
+		URL:     cfg.Engine.Proxy.URL,
+		NoProxy: cfg.Engine.Proxy.NoProxy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("engine connection: %s", err)
+	}
+	return c, nil
+}
+
+// config returns the running config. It must not be modified,
+// as it's shared by the inputs and outputs.
+func (e *Executor) config() *config.Config {
+	e.cfgMx.RLock()
+	defer e.cfgMx.RUnlock()
+	return e.cfg
+}
+
+// localAlertsQueueSize is max number of alerts of local detectors
+// waiting to be written to outputs.
+const localAlertsQueueSize = 1024
+
 // New creates new executor.
 func New(c client.Client, cfg *config.Config) (*Executor, error) {
 	e := &Executor{
-		c:   c,
-		cfg: cfg,
+		cfg:         cfg,
+		done:        context.Background(),
+		checkpoints: make(map[string]time.Time),
+		tails:       make(map[string]*tail.Tail),
+		monitors:    make(map[config.Monitor]context.CancelFunc),
+		started:     time.Now(),
+		flushed:     make(map[string]time.Time),
+		monitorErrs: make(map[string]error),
+		searchErrs:  make(map[string]error),
+		configFiles: cfg.Files(),
 	}
 
-	groups, err := createGroups(cfg)
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	groups, err := NewGroups(cfg)
 	if err != nil {
 		return nil, err
 	}
+	log.Infof("loaded %d groups containing monitoring scope data", len(cfg.ScopeConfig.Groups))
 	e.groups = groups
 
+	if err := e.createTenants(c); err != nil {
+		return nil, err
+	}
+
 	if cfg.HasOutputs() {
 		log.Info("outputs enabled")
 		mapper := alerts.NewAlertMapper(groups)
-		e.alertsPoller = alerts.NewPoller(c, mapper)
-		if err := e.alertsPoller.SetFollowDataFile(cfg.Data.File); err != nil {
-			return nil, err
+		for _, t := range e.tenants {
+			t.poller = alerts.NewPoller(t.c, mapper)
+			t.poller.SetTenant(t.name)
+			if err := t.poller.SetFollowDataFile(t.followFile(cfg.Data.File)); err != nil {
+				return nil, err
+			}
 		}
 
-		if cfg.Outputs.File != "" {
-			format := getFormatter(cfg.Outputs.Format)
-			if format == nil {
-				return nil, fmt.Errorf("invalid output format: %s", cfg.Outputs.Format)
+		e.outputs, err = newOutputs(cfg, nil)
+		if err != nil {
+			return nil, err
+		}
+		e.outputsWriter = alerts.NewMultiWriter(outputWriters(e.outputs)...)
+		writers := []alerts.Writer{e.outputsWriter}
+
+		if cfg.Outputs.Incidents.Enabled {
+			e.correlator = alerts.NewCorrelator(cfg.Outputs.Incidents.Window, e.outputsWriter)
+			if cfg.Outputs.Incidents.Mode == "incidents" {
+				writers = []alerts.Writer{e.correlator}
+			} else {
+				writers = append(writers, e.correlator)
 			}
+		}
+		for _, w := range writers {
+			e.addAlertsWriter(w)
+		}
 
-			fileWriter, err := alerts.NewFileWriter(cfg.Outputs.File, format)
-
+		if cfg.Response.Blocklist.Enabled {
+			bl := &cfg.Response.Blocklist
+			e.blocklist, err = response.NewBlocklist(response.Config{
+				File:           bl.File,
+				Format:         bl.Format,
+				MinSeverity:    bl.MinSeverity,
+				Expiry:         bl.Expiry,
+				AllowedDomains: bl.AllowedDomains,
+				AllowedIPs:     bl.AllowedIPs,
+				Zone:           bl.Zone,
+				SetName:        bl.SetName,
+				Hook:           bl.Hook,
+				StateFile:      path.Join(cfg.Data.Dir, "blocklist.state"),
+			})
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(fileWriter)
+			e.addAlertsWriter(e.blocklist)
+			writers = append(writers, e.blocklist)
+		}
+
+		if cfg.IOC.Enabled || cfg.Heuristics.DNS.Enabled || cfg.Heuristics.Beacon.Enabled {
+			e.localAlerts = alerts.NewQueueWriter("local", alerts.NewMultiWriter(writers...), localAlertsQueueSize)
 		}
 
-		if cfg.Outputs.Graylog.URI != "" {
-			graylogWriter, err := alerts.NewGraylogWriter(cfg.Outputs.Graylog.URI, cfg.Outputs.Graylog.Level)
+		if cfg.IOC.Enabled {
+			feeds := make([]ioc.FeedConfig, len(cfg.IOC.Feeds))
+			for i, feed := range cfg.IOC.Feeds {
+				feeds[i] = ioc.FeedConfig{
+					Name:     feed.Name,
+					File:     feed.File,
+					Format:   feed.Format,
+					Type:     feed.Type,
+					Threat:   feed.Threat,
+					Severity: feed.Severity,
+				}
+			}
+			e.ioc, err = ioc.NewDetector(ioc.Config{Feeds: feeds, Suppress: cfg.IOC.Suppress}, groups)
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(graylogWriter)
+			e.ioc.SetWriter(e.localAlerts)
 		}
 
-		if cfg.Outputs.Syslog.IP != "" {
-			addr := net.JoinHostPort(cfg.Outputs.Syslog.IP, strconv.FormatInt(int64(cfg.Outputs.Syslog.Port), 10))
-			format := getFormatter(cfg.Outputs.Syslog.Format)
-			if format == nil {
-				return nil, fmt.Errorf("invalid syslog format: %s", cfg.Outputs.Syslog.Format)
+		if cfg.Heuristics.DNS.Enabled {
+			h := &cfg.Heuristics.DNS
+			e.dnsHeuristics, err = heuristics.NewDNSDetector(heuristics.DNSConfig{
+				Window:          h.Window,
+				MinQueries:      h.MinQueries,
+				Entropy:         h.Entropy,
+				Subdomains:      h.Subdomains,
+				QueryLength:     h.QueryLength,
+				TXTRatio:        h.TXTRatio,
+				MinSignals:      h.MinSignals,
+				MinResponses:    h.MinResponses,
+				NXDomainRatio:   h.NXDomainRatio,
+				NXDomainDomains: h.NXDomainDomains,
+				Severity:        h.Severity,
+			}, groups)
+			if err != nil {
+				return nil, err
 			}
+			e.dnsHeuristics.SetWriter(e.localAlerts)
+		}
 
-			syslogWriter, err := alerts.NewSyslogWriter(cfg.Outputs.Syslog.Proto, addr, format)
+		if cfg.Heuristics.Beacon.Enabled {
+			b := &cfg.Heuristics.Beacon
+			e.beacons, err = heuristics.NewBeaconDetector(heuristics.BeaconConfig{
+				Window:      b.Window,
+				Coalesce:    b.Coalesce,
+				MinEvents:   b.MinEvents,
+				MinInterval: b.MinInterval,
+				MaxJitter:   b.MaxJitter,
+				MinScore:    b.MinScore,
+				MaxFlows:    b.MaxFlows,
+				Severity:    b.Severity,
+			}, groups)
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(syslogWriter)
+			e.beacons.SetWriter(e.localAlerts)
 		}
 	}
 
-	e.dnsbuf = packet.NewDNSPacketBuffer()
-	e.ipbuf = packet.NewIPPacketBuffer()
-	e.httpbuf = packet.NewHTTPPacketBuffer()
+	rejects := &cfg.Engine.Rejects
+	if e.rejects, err = newRejectStats(rejects.Validate, rejects.Log.File, rejects.Log.Samples); err != nil {
+		return nil, err
+	}
+	e.metrics = e.newMetrics()
 	return e, nil
 }
 
+// createTenants creates the default tenant with client c
+// and tenants defined by scope groups.
+func (e *Executor) createTenants(c client.Client) error {
+	cfg := e.config()
+	e.tenants = []*tenant{newTenant("", c)}
+	e.tenantsByName = map[string]*tenant{"": e.tenants[0]}
+
+	tenants := cfg.Tenants()
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tc, err := newClient(cfg, tenants[name].Host, tenants[name].APIKey)
+		if err != nil {
+			return fmt.Errorf("tenant %s: %s", name, err)
+		}
+		t := newTenant(name, tc)
+		e.tenants = append(e.tenants, t)
+		e.tenantsByName[name] = t
+	}
+	if len(names) > 0 {
+		log.Infof("events are sent to %d tenants: %s", len(names), strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// addAlertsWriter adds writer to alerts pollers of all tenants.
+func (e *Executor) addAlertsWriter(w alerts.Writer) {
+	for _, t := range e.tenants {
+		t.poller.AddWriter(w)
+	}
+}
+
 // Start starts sniffer in online mode, where network alerts are sent to api.
+// It runs until SIGINT or SIGTERM is received, then it stops all inputs
+// and sends buffered events, see shutdown.
 func (e *Executor) Start() (err error) {
+	cfg := e.config()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	e.done = ctx
+
 	e.init()
-	if e.cfg.Engine.Analyze.DNS || e.cfg.Engine.Analyze.IP {
+	if cfg.Engine.Analyze.DNS || cfg.Engine.Analyze.IP {
 		e.monitor()
 
-		if e.cfg.Inputs.Sniffer.Enabled {
-			if e.cfg.DNSEvents.Failed.File != "" {
-				if e.dnsWriter, err = packet.NewWriter(e.cfg.DNSEvents.Failed.File); err != nil {
-					return fmt.Errorf("can't open file %s for writing dns events: %s", e.cfg.DNSEvents.Failed.File, err.(*net.OpError).Err)
+		if cfg.Inputs.Sniffer.Enabled {
+			if cfg.DNSEvents.Failed.File != "" {
+				if e.dnsWriter, err = packet.NewWriter(cfg.DNSEvents.Failed.File); err != nil {
+					return fmt.Errorf("can't open file %s for writing dns events: %s", cfg.DNSEvents.Failed.File, err.(*net.OpError).Err)
 				}
 			}
-			if e.cfg.IPEvents.Failed.File != "" {
-				if e.ipWriter, err = packet.NewWriter(e.cfg.IPEvents.Failed.File); err != nil {
-					return fmt.Errorf("can't open file %s for writing ip events: %s", e.cfg.IPEvents.Failed.File, err.(*net.OpError).Err)
+			if cfg.IPEvents.Failed.File != "" {
+				if e.ipWriter, err = packet.NewWriter(cfg.IPEvents.Failed.File); err != nil {
+					return fmt.Errorf("can't open file %s for writing ip events: %s", cfg.IPEvents.Failed.File, err.(*net.OpError).Err)
 				}
 			}
-			log.Infof("creating the network sniffer on %s", e.cfg.Inputs.Sniffer.Interface)
-			e.sniffer, err = sniffer.NewLivePcapSniffer(e.cfg.Inputs.Sniffer.Interface, &sniffer.Config{
+			log.Infof("creating the network sniffer on %s", cfg.Inputs.Sniffer.Interface)
+			s, err := sniffer.NewLivePcapSniffer(cfg.Inputs.Sniffer.Interface, &sniffer.Config{
 				BPFilter: "tcp or udp",
 			})
 			if err != nil {
 				return fmt.Errorf("can't create the network sniffer: %s", err)
 			}
-			log.Infof("starting the network sniffer on %s", e.cfg.Inputs.Sniffer.Interface)
-			e.do()
+			e.mx.Lock()
+			e.sniffer = s
+			e.mx.Unlock()
+			log.Infof("starting the network sniffer on %s", cfg.Inputs.Sniffer.Interface)
+			e.inputs.Add(1)
+			go func() {
+				defer e.inputs.Done()
+				e.do()
+			}()
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	wg := &sync.WaitGroup{}
-
-	if e.cfg.Inputs.Elastic.Enabled {
-		e.startElastic(ctx, wg)
+	if cfg.Inputs.Elastic.Enabled {
+		es := cfg.Inputs.Elastic
+		if err := e.startElastic(&es, es.Searches); err != nil {
+			return err
+		}
 	}
+	e.startReload()
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	<-ctx.Done()
+	// the next signal terminates nfr immediately
+	stop()
+	log.Infof("stopping, buffered events are sent within %s", cfg.Engine.ShutdownTimeout)
 
-	cancel()
-	wg.Wait()
+	// requests still running after the timeout are canceled
+	timer := time.AfterFunc(cfg.Engine.ShutdownTimeout, e.cancel)
+	defer timer.Stop()
 
+	e.inputs.Wait()
+	e.shutdown()
 	return nil
 }
 
-func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
-	cfg := &e.cfg.Inputs.Elastic
-	for searchIdx, search := range cfg.Searches {
+// startElastic starts elasticsearch searches, which run until the executor
+// is stopped or the search is removed by reload. The config must not be
+// changed afterwards.
+func (e *Executor) startElastic(cfg *elastic.Config, searches []*elastic.SearchConfig) error {
+	for _, search := range searches {
 		c, err := elastic.NewClient(cfg)
 		if err != nil {
 			return err
 		}
+		asoclient, err := NewClient(e.config())
+		if err != nil {
+			return err
+		}
+
+		// searches are numbered in order they were started, so names
+		// of searches added by reload don't clash with running ones
+		ctx, cancel := context.WithCancel(e.done)
+		e.mx.Lock()
+		name := fmt.Sprintf("%v-%03d", search.EventType, e.searchSeq)
+		e.searchSeq++
+		e.searches = append(e.searches, newSearch(name, cfg, search, cancel))
+		e.mx.Unlock()
 
-		wg.Add(1)
-		go func(idx int, c *elastic.Client, search *elastic.SearchConfig) {
-			defer wg.Done()
+		e.inputs.Add(1)
+		go func(ctx context.Context, name string, c *elastic.Client, search *elastic.SearchConfig) {
+			defer e.inputs.Done()
+			defer func() {
+				// the search was removed by reload
+				if e.done.Err() == nil {
+					e.removeSearch(name)
+				}
+			}()
 
-			asoclient := client.New(e.cfg.Engine.Host, e.cfg.Engine.APIKey)
-			log := log.WithField("name", fmt.Sprintf("%v-%03d", search.EventType, idx))
+			log := log.WithField("name", name)
 			checkpointFname := "elastic-" + elastic.ConfigFingerprint(cfg, search)
 
 			// Load last es search checkpoint.
-			lastIngested := e.cfg.LoadTimestamp(checkpointFname, 24*time.Hour)
+			lastIngested := e.config().LoadTimestamp(checkpointFname, 24*time.Hour)
+			e.setCheckpoint(name, lastIngested)
+
+			saveCheckpoint := func(t time.Time) {
+				if err := e.config().SaveTimestamp(checkpointFname, t); err != nil {
+					log.Errorf("error writing checkpoint: %v", err)
+					return
+				}
+				lastIngested = t
+				e.setCheckpoint(name, t)
+				e.setSearchError(name, nil)
+			}
+
+			// batches of the last page not sent completely, and the checkpoint
+			// saved once they are sent
+			var (
+				pending    []*elasticBatch
+				checkpoint time.Time
+			)
 
 			// We want the ticker to fire immediately once, and then with the configured
 			// search poll interval.
@@ -218,20 +512,27 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 						ticker.Reset(time.Duration(search.PollInterval) * time.Second)
 					}
 
-					lctx := context.Background()
-					cur, err := c.Fetch(lctx, search, lastIngested)
+					if len(pending) > 0 {
+						if pending = e.sendElastic(string(search.EventType), pending, log.WithField("lastIngested", checkpoint)); len(pending) > 0 {
+							continue
+						}
+						saveCheckpoint(checkpoint)
+					}
+
+					cur, err := c.Fetch(ctx, search, lastIngested)
 					if err != nil {
 						log.Errorf("es query failed: %v", err)
+						e.setSearchError(name, err)
 						continue
 					}
 
 					firstSearchPage := true
-					for {
-						hits, err := cur.Next(lctx)
+					for ctx.Err() == nil {
+						hits, err := cur.Next(ctx)
 
-						if e.cfg.Log.Level == "debug" {
+						if e.config().Log.Level == "debug" {
 							fname := "elastic-" + elastic.ConfigFingerprint(cfg, search) + "-search"
-							fullname := path.Join(e.cfg.Data.Dir, fname)
+							fullname := path.Join(e.config().Data.Dir, fname)
 							if err := cur.DumpLastSearchQuery(fullname); err != nil {
 								log.Debugf("error saving last search query: %v", err)
 							} else {
@@ -241,6 +542,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 
 						if err != nil {
 							log.Errorf("fetch events: %v", err)
+							e.setSearchError(name, err)
 							break
 						}
 
@@ -254,140 +556,202 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 
 						firstSearchPage = false
 
+						var batches []*elasticBatch
 						switch search.EventType {
 						case client.EventTypeDNS:
-							// Convert []elastic.Hit to client.EventsDNSRequest
-							req := &client.EventsDNSRequest{}
+							// Convert []elastic.Hit to client.EventsDNSRequest of each tenant
+							reqs := make(map[*tenant]*client.EventsDNSRequest)
 							for n, h := range hits {
 								entry, err := h.DecodeDNS(search)
 								if err != nil {
 									log.Debugf("failed to decode dns event: %v", err)
 									continue
 								}
+								eventsParsed.Inc("dns", inputElastic)
+								if !e.rejects.check("dns", entry.Validate(time.Now()), entry) {
+									continue
+								}
+								if e.ioc != nil {
+									e.ioc.CheckDNS(entry.Timestamp, entry.SrcIP, entry.Query, entry.QType)
+								}
 
-								if e.cfg.Log.Level == "debug" && n < 5 {
+								if e.config().Log.Level == "debug" && n < 5 {
 									log.Debugf("event: %+v", entry)
 								}
 
-								if _, ok := e.groups.IsDNSQueryWhitelisted(entry.Query, entry.SrcIP, nil); ok {
-									req.Entries = append(req.Entries, entry)
+								group, ok := e.groups.IsDNSQueryWhitelisted(entry.Query, entry.SrcIP, nil)
+								if !ok {
+									eventsFiltered.Inc("dns", inputElastic, group)
+									continue
+								}
+								if !e.sampled("dns", inputElastic, entry.SrcIP, strings.ToLower(entry.Query)) {
+									continue
+								}
+								t := e.tenant(entry.SrcIP)
+								if reqs[t] == nil {
+									reqs[t] = &client.EventsDNSRequest{}
+								}
+								reqs[t].Entries = append(reqs[t].Entries, entry)
+								if e.dnsHeuristics != nil {
+									e.dnsHeuristics.ObserveQuery(entry.Timestamp, entry.SrcIP, entry.Query, entry.QType)
 								}
 							}
 
 							// Send events to the API
 							inglog := log.WithField("lastIngested", cur.NewestIngested())
-							if len(req.Entries) > 0 {
-								resp, err := asoclient.EventsDNS(req)
-								if err != nil {
-									log.Errorf("sending dns events: %v", err)
-									continue
-								}
-								inglog.WithField("events", resp.Accepted).Info("telemetry sent")
-							} else {
+							if len(reqs) == 0 {
 								inglog.WithField("retrievedEvents", len(hits)).Info("no retrieved events in scope")
 							}
+							for t, req := range reqs {
+								c, entries := t.elasticClient(asoclient), req.Entries
+								batches = append(batches, &elasticBatch{t: t, n: len(entries), send: func(from int) (*client.EventsResponse, error) {
+									return c.EventsDNS(e.ctx, &client.EventsDNSRequest{Entries: entries[from:]})
+								}})
+							}
 
 						case client.EventTypeIP:
-							req := &client.EventsIPRequest{}
+							reqs := make(map[*tenant]*client.EventsIPRequest)
 							for n, h := range hits {
 								entry, err := h.DecodeIP(search)
 								if err != nil {
 									log.Debugf("failed to decode ip event: %v", err)
 									continue
 								}
+								eventsParsed.Inc("ip", inputElastic)
+								if !e.rejects.check("ip", entry.Validate(time.Now()), entry) {
+									continue
+								}
+								if e.ioc != nil {
+									e.ioc.CheckIP(entry.Timestamp, entry.SrcIP, entry.SrcPort, entry.DstIP, entry.DstPort, entry.Protocol, entry.Ja3)
+								}
 
-								if e.cfg.Log.Level == "debug" && n < 5 {
+								if e.config().Log.Level == "debug" && n < 5 {
 									log.Debugf("event: %+v", entry)
 								}
 
-								if _, ok := e.groups.IsIPWhitelisted(entry.SrcIP, entry.DstIP); ok {
-									req.Entries = append(req.Entries, entry)
+								group, ok := e.groups.IsIPWhitelisted(entry.SrcIP, entry.DstIP, entry.DstPort, entry.Protocol)
+								if !ok {
+									eventsFiltered.Inc("ip", inputElastic, group)
+									continue
+								}
+								if !e.sampled("ip", inputElastic, entry.SrcIP, entry.DstIP.String(), strconv.Itoa(entry.DstPort), entry.Protocol) {
+									continue
+								}
+								t := e.tenant(entry.SrcIP)
+								if reqs[t] == nil {
+									reqs[t] = &client.EventsIPRequest{}
+								}
+								reqs[t].Entries = append(reqs[t].Entries, entry)
+								if e.beacons != nil {
+									e.beacons.Observe(entry.Timestamp, entry.SrcIP, entry.DstIP, entry.DstPort, entry.Protocol, entry.BytesIn+entry.BytesOut)
 								}
 							}
 
 							// Send events to the API
 							inglog := log.WithField("lastIngested", cur.NewestIngested())
-							if len(req.Entries) > 0 {
-								resp, err := asoclient.EventsIP(req)
-								if err != nil {
-									log.Errorf("sending dns events: %v", err)
-									continue
-								}
-								inglog.WithField("events", resp.Accepted).Info("telemetry sent")
-							} else {
+							if len(reqs) == 0 {
 								inglog.WithField("retrievedEvents", len(hits)).Info("no retrieved events in scope")
 							}
+							for t, req := range reqs {
+								c, entries := t.elasticClient(asoclient), req.Entries
+								batches = append(batches, &elasticBatch{t: t, n: len(entries), send: func(from int) (*client.EventsResponse, error) {
+									return c.EventsIP(e.ctx, &client.EventsIPRequest{Entries: entries[from:]})
+								}})
+							}
 
 						case client.EventTypeHTTP:
-							var entries []*client.HTTPEntry
+							entries := make(map[*tenant][]*client.HTTPEntry)
 							for n, h := range hits {
 								entry, err := h.DecodeHTTP(search)
 								if err != nil {
 									log.Debugf("failed to decode ip event: %v", err)
 									continue
 								}
+								eventsParsed.Inc("http", inputElastic)
+								if !e.rejects.check("http", entry.Validate(time.Now()), entry) {
+									continue
+								}
+								if e.ioc != nil {
+									e.ioc.CheckHTTP(entry)
+								}
 
-								if e.cfg.Log.Level == "debug" && n < 5 {
+								if e.config().Log.Level == "debug" && n < 5 {
 									log.Debugf("event: %+v", entry)
 								}
 
-								if _, ok := e.groups.IsHTTPQueryWhitelisted(entry.URL, entry.SrcIP); ok {
-									entries = append(entries, entry)
+								group, ok := e.groups.IsHTTPQueryWhitelisted(entry.URL, entry.SrcIP)
+								if !ok {
+									eventsFiltered.Inc("http", inputElastic, group)
+									continue
+								}
+								if !e.sampled("http", inputElastic, entry.SrcIP, entry.URL) {
+									continue
 								}
+								t := e.tenant(entry.SrcIP)
+								entries[t] = append(entries[t], entry)
 							}
 
 							// Send events to the API
 							inglog := log.WithField("lastIngested", cur.NewestIngested())
-							if len(entries) > 0 {
-								resp, err := asoclient.EventsHTTP(entries)
-								if err != nil {
-									log.Errorf("sending dns events: %v", err)
-									continue
-								}
-								inglog.WithField("events", resp.Accepted).Info("telemetry sent")
-							} else {
+							if len(entries) == 0 {
 								inglog.WithField("retrievedEvents", len(hits)).Info("no retrieved events in scope")
 							}
+							for t, entries := range entries {
+								c, entries := t.elasticClient(asoclient), entries
+								batches = append(batches, &elasticBatch{t: t, n: len(entries), send: func(from int) (*client.EventsResponse, error) {
+									return c.EventsHTTP(e.ctx, entries[from:])
+								}})
+							}
 
 						case client.EventTypeTLS:
-							var entries []*client.TLSEntry
+							entries := make(map[*tenant][]*client.TLSEntry)
 							for n, h := range hits {
 								entry, err := h.DecodeTLS(search)
 								if err != nil {
 									log.Debugf("failed to decode ip event: %v", err)
 									continue
 								}
+								eventsParsed.Inc("tls", inputElastic)
+								if !e.rejects.check("tls", entry.Validate(time.Now()), entry) {
+									continue
+								}
+								if e.ioc != nil {
+									e.ioc.CheckTLS(entry)
+								}
 
-								if e.cfg.Log.Level == "debug" && n < 5 {
+								if e.config().Log.Level == "debug" && n < 5 {
 									log.Debugf("event: %+v", entry)
 								}
 
-								if _, ok := e.groups.IsIPWhitelisted(entry.SrcIP, entry.DstIP); ok {
-									entries = append(entries, entry)
+								group, ok := e.groups.IsTLSWhitelisted(entry)
+								if !ok {
+									eventsFiltered.Inc("tls", inputElastic, group)
+									continue
 								}
+								t := e.tenant(entry.SrcIP)
+								entries[t] = append(entries[t], entry)
 							}
 
 							// Send events to the API
 							inglog := log.WithField("lastIngested", cur.NewestIngested())
-							if len(entries) > 0 {
-								resp, err := asoclient.EventsTLS(entries)
-								if err != nil {
-									log.Errorf("sending dns events: %v", err)
-									continue
-								}
-								inglog.WithField("events", resp.Accepted).Info("telemetry sent")
-							} else {
+							if len(entries) == 0 {
 								inglog.WithField("retrievedEvents", len(hits)).Info("no retrieved events in scope")
 							}
+							for t, entries := range entries {
+								c, entries := t.elasticClient(asoclient), entries
+								batches = append(batches, &elasticBatch{t: t, n: len(entries), send: func(from int) (*client.EventsResponse, error) {
+									return c.EventsTLS(e.ctx, entries[from:])
+								}})
+							}
 						}
 
-						// Save checkpoint
-						t := cur.NewestIngested()
-						if err := e.cfg.SaveTimestamp(checkpointFname, t); err != nil {
-							log.Errorf("error writing checkpoint: %v", err)
-						} else {
-							lastIngested = t
+						// Do not move the checkpoint if sending failed, events
+						// not sent yet are sent again by the next poll
+						checkpoint = cur.NewestIngested()
+						if pending = e.sendElastic(string(search.EventType), batches, log.WithField("lastIngested", checkpoint)); len(pending) > 0 {
+							break
 						}
+						saveCheckpoint(checkpoint)
 					}
 
 					if err := cur.Close(); err != nil {
@@ -395,12 +759,50 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 					}
 				}
 			}
-		}(searchIdx, c, search)
+		}(ctx, name, c, search)
 	}
 
 	return nil
 }
 
+// elasticBatch is a page of events fetched by elasticsearch search,
+// sent to a tenant. Events sent before a failure are not sent again.
+type elasticBatch struct {
+	t    *tenant
+	n    int // number of events
+	sent int // number of events sent
+	// send sends events starting from given index.
+	send func(from int) (*client.EventsResponse, error)
+}
+
+// sendElastic sends batches of events fetched from elasticsearch and returns
+// batches not sent completely. Chunks of a batch sent before a failure
+// are accepted by the Engine, so only the rest of the batch is kept.
+// Events of batches rejected as invalid are dropped.
+func (e *Executor) sendElastic(eventType string, batches []*elasticBatch, l *log.Entry) []*elasticBatch {
+	var failed []*elasticBatch
+	for _, b := range batches {
+		resp, err := b.send(b.sent)
+		b.t.recordSend(eventType, err)
+		if resp != nil {
+			countSent(eventType, b.t, resp)
+			e.rejects.engine(eventType, resp.Rejected)
+			b.sent += resp.Sent()
+		}
+		if err != nil {
+			b.t.withTenant(l).Errorf("sending %s events: %v", eventType, err)
+			if failedEventsAction(err, false) == dropEvents {
+				b.t.withTenant(l).Warnf("%d %s events rejected by the engine were dropped", b.n-b.sent, eventType)
+				continue
+			}
+			failed = append(failed, b)
+			continue
+		}
+		b.t.withTenant(l).WithField("events", resp.Accepted).Info("telemetry sent")
+	}
+	return failed
+}
+
 // Send sends dns events from given format file to engine.
 func (e *Executor) Send(file, fileFormat, fileType string) error {
 	if fileType == "all" {
@@ -433,137 +835,184 @@ func (e *Executor) sendOne(file, fileFormat, fileType string) error {
 	return errors.New("file type not supported")
 }
 
-// monitor monitors log files and send data to engine.
+// monitor monitors log files and send data to engine,
+// until the executor is stopped.
 func (e *Executor) monitor() {
-	for _, monitor := range e.cfg.Inputs.Monitors {
-		// skip empty items
-		if monitor.File == "" && monitor.Type == "" && monitor.Format == "" {
-			continue
-		}
+	for _, monitor := range e.config().Inputs.Monitors {
+		e.startMonitor(monitor)
+	}
+}
 
-		t, err := tail.TailFile(monitor.File, tail.Config{
-			Follow: true,
-			ReOpen: true,
-			Poll:   !e.cfg.Inputs.UseInotify,
-			Logger: log.StandardLogger(),
-		})
-		if err != nil {
-			log.Errorf("can't caputre log file %s: %s", monitor.File, err)
-			continue
+// startMonitor monitors log file until the executor is stopped
+// or the monitor is removed by reload.
+func (e *Executor) startMonitor(monitor config.Monitor) {
+	cfg := e.config()
+	// skip empty items
+	if monitor.File == "" && monitor.Type == "" && monitor.Format == "" {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(e.done)
+	e.mx.Lock()
+	e.monitors[monitor] = cancel
+	e.mx.Unlock()
+
+	t, err := tail.TailFile(monitor.File, tail.Config{
+		Follow: true,
+		ReOpen: true,
+		Poll:   !cfg.Inputs.UseInotify,
+		Logger: log.StandardLogger(),
+	})
+	if err != nil {
+		log.Errorf("can't caputre log file %s: %s", monitor.File, err)
+		e.mx.Lock()
+		e.monitorErrs[monitor.File] = err
+		e.mx.Unlock()
+		return
+	}
+	log.Infof("monitoring %s", monitor.File)
+	e.mx.Lock()
+	e.tails[monitor.File] = t
+	e.mx.Unlock()
+
+	// stopped tail closes lines channel
+	go func(t *tail.Tail) {
+		<-ctx.Done()
+		t.Stop()
+	}(t)
+
+	e.inputs.Add(1)
+	go func(monitor config.Monitor) {
+		defer e.inputs.Done()
+		var parser logs.Parser
+		switch monitor.Format {
+		case "bro":
+			parser = bro.NewParser()
+		case "suricata":
+			parser = suricata.NewParser()
+		case "msdns":
+			p := msdns.NewParser()
+			p.TimeFormat = cfg.Inputs.MSDNSTimeFormat
+			parser = p
+		case "syslog-named":
+			parser = syslognamed.NewParser()
 		}
-		log.Infof("monitoring %s", monitor.File)
-
-		go func(monitor config.Monitor) {
-			var parser logs.Parser
-			switch monitor.Format {
-			case "bro":
-				parser = bro.NewParser()
-			case "suricata":
-				parser = suricata.NewParser()
-			case "msdns":
-				p := msdns.NewParser()
-				p.TimeFormat = e.cfg.Inputs.MSDNSTimeFormat
-				parser = p
-			case "syslog-named":
-				parser = syslognamed.NewParser()
-			}
-
-			for line := range t.Lines {
-				switch monitor.Type {
-				case "ip":
-					if e.cfg.Engine.Analyze.IP {
-						ippacket, err := parser.ParseLineIP(line.Text)
-						if err != nil {
-							log.Errorf("file %s: %s", monitor.File, err)
-							continue
-						}
 
-						// some formats have metadata and it returns no error and no packet either
-						if ippacket == nil {
-							continue
-						}
+		for line := range t.Lines {
+			switch monitor.Type {
+			case "ip":
+				if cfg.Engine.Analyze.IP {
+					ippacket, err := parser.ParseLineIP(line.Text)
+					if err != nil {
+						log.Errorf("file %s: %s", monitor.File, err)
+						continue
+					}
 
-						if !e.shouldSendIPPacket(ippacket) {
-							continue
-						}
+					// some formats have metadata and it returns no error and no packet either
+					if ippacket == nil {
+						continue
+					}
 
-						e.mx.Lock()
-						e.ipbuf.Write(ippacket)
-						l := e.ipbuf.Len()
-						e.mx.Unlock()
-						if l >= e.cfg.IPEvents.BufferSize {
-							go e.sendIPPackets()
-						}
+					if !e.shouldSendIPPacket(ippacket, inputMonitor) {
+						continue
 					}
-				case "dns":
-					if e.cfg.Engine.Analyze.DNS {
-						dnspacket, err := parser.ParseLineDNS(line.Text)
-						if err != nil {
-							log.Errorf("file %s: %s", monitor.File, err)
-							continue
-						}
 
-						// some formats have metadata and it returns no error and no packet either
-						if dnspacket == nil {
-							continue
-						}
+					t := e.tenant(ippacket.SrcIP)
+					e.mx.Lock()
+					t.ipbuf.Write(ippacket)
+					l := t.ipbuf.Len()
+					e.mx.Unlock()
+					if l >= cfg.IPEvents.BufferSize {
+						e.sendInBackground(e.sendIPPackets, t)
+					}
+				}
+			case "dns":
+				if cfg.Engine.Analyze.DNS {
+					dnspacket, err := parser.ParseLineDNS(line.Text)
+					if err != nil {
+						log.Errorf("file %s: %s", monitor.File, err)
+						continue
+					}
 
-						if !e.shouldSendDNSPacket(dnspacket) {
-							continue
-						}
-						e.mx.Lock()
-						e.dnsbuf.Write(dnspacket)
-						l := e.dnsbuf.Len()
-						e.mx.Unlock()
-						if l >= e.cfg.DNSEvents.BufferSize {
-							// do not wait for sending packets
-							go e.sendDNSPackets()
-						}
+					// some formats have metadata and it returns no error and no packet either
+					if dnspacket == nil {
+						continue
 					}
-				case "http":
-					if e.cfg.Engine.Analyze.HTTP {
-						dnspacket, err := parser.ParseLineHTTP(line.Text)
-						if err != nil {
-							log.Errorf("file %s: %s", monitor.File, err)
-							continue
-						}
 
-						// some formats have metadata and it returns no error and no packet either
-						if dnspacket == nil {
-							continue
-						}
+					if !e.shouldSendDNSPacket(dnspacket, inputMonitor) {
+						continue
+					}
+					t := e.tenant(dnspacket.SrcIP)
+					e.mx.Lock()
+					t.dnsbuf.Write(dnspacket)
+					l := t.dnsbuf.Len()
+					e.mx.Unlock()
+					if l >= cfg.DNSEvents.BufferSize {
+						// do not wait for sending packets
+						e.sendInBackground(e.sendDNSPackets, t)
+					}
+				}
+			case "http":
+				if cfg.Engine.Analyze.HTTP {
+					dnspacket, err := parser.ParseLineHTTP(line.Text)
+					if err != nil {
+						log.Errorf("file %s: %s", monitor.File, err)
+						continue
+					}
 
-						if !e.shouldSendHTTPPacket(dnspacket) {
-							continue
-						}
-						e.mx.Lock()
-						e.httpbuf.Write(dnspacket)
-						l := e.httpbuf.Len()
-						e.mx.Unlock()
-						if l >= e.cfg.HTTPEvents.BufferSize {
-							// do not wait for sending packets
-							go e.sendDNSPackets()
-						}
+					// some formats have metadata and it returns no error and no packet either
+					if dnspacket == nil {
+						continue
+					}
+
+					if !e.shouldSendHTTPPacket(dnspacket, inputMonitor) {
+						continue
+					}
+					t := e.tenant(dnspacket.SrcIP)
+					e.mx.Lock()
+					t.httpbuf.Write(dnspacket)
+					l := t.httpbuf.Len()
+					e.mx.Unlock()
+					if l >= cfg.HTTPEvents.BufferSize {
+						// do not wait for sending packets
+						e.sendInBackground(e.sendHTTPPackets, t)
 					}
 				}
 			}
-		}(monitor)
-	}
+		}
+	}(monitor)
 }
 
 // init initialize executor.
 func (e *Executor) init() {
-	e.installSignalHandler()
-	if e.cfg.HasOutputs() {
+	cfg := e.config()
+	if cfg.Metrics.Enabled || cfg.Status.Enabled {
+		e.startHTTP()
+	}
+	if cfg.HasOutputs() {
 		e.startAlertPoller()
 	}
-	if e.cfg.HasInputs() {
+	if w := emailWriter(e.outputs); w != nil && w.DigestInterval() > 0 {
+		e.startEmailDigest(w)
+	}
+	if e.correlator != nil {
+		e.startIncidentExpiry()
+	}
+	if e.blocklist != nil {
+		e.startBlocklistExpiry()
+	}
+	if e.ioc != nil {
+		e.startIOCReload()
+	}
+	if cfg.HasInputs() {
 		e.startPacketSender()
+		e.startRejectWarnings()
 	}
 }
 
 func (e *Executor) processDNSReader() error {
-	if !e.cfg.Engine.Analyze.DNS {
+	cfg := e.config()
+	if !cfg.Engine.Analyze.DNS {
 		log.Warn("dns events processing disabled")
 		return nil
 	}
@@ -575,22 +1024,24 @@ func (e *Executor) processDNSReader() error {
 	log.Infof("found %d dns packets", len(dnspackets))
 
 	for _, dnspacket := range dnspackets {
-		if !e.shouldSendDNSPacket(dnspacket) {
+		if !e.shouldSendDNSPacket(dnspacket, inputFile) {
 			continue
 		}
 
-		e.dnsbuf.Write(dnspacket)
-		if e.dnsbuf.Len() >= e.cfg.DNSEvents.BufferSize {
-			if err := e.sendDNSPackets(); err != nil {
+		t := e.tenant(dnspacket.SrcIP)
+		t.dnsbuf.Write(dnspacket)
+		if t.dnsbuf.Len() >= cfg.DNSEvents.BufferSize {
+			if err := e.sendDNSPackets(t); err != nil {
 				return err
 			}
 		}
 	}
-	return e.sendDNSPackets()
+	return e.eachTenant(e.sendDNSPackets)
 }
 
 func (e *Executor) processIPReader() error {
-	if !e.cfg.Engine.Analyze.IP {
+	cfg := e.config()
+	if !cfg.Engine.Analyze.IP {
 		log.Warn("ip events processing disabled")
 		return nil
 	}
@@ -602,22 +1053,24 @@ func (e *Executor) processIPReader() error {
 	log.Infof("found %d ip packets", len(ippackets))
 
 	for _, ippacket := range ippackets {
-		if !e.shouldSendIPPacket(ippacket) {
+		if !e.shouldSendIPPacket(ippacket, inputFile) {
 			continue
 		}
 
-		e.ipbuf.Write(ippacket)
-		if e.ipbuf.Len() >= e.cfg.IPEvents.BufferSize {
-			if err := e.sendIPPackets(); err != nil {
+		t := e.tenant(ippacket.SrcIP)
+		t.ipbuf.Write(ippacket)
+		if t.ipbuf.Len() >= cfg.IPEvents.BufferSize {
+			if err := e.sendIPPackets(t); err != nil {
 				return err
 			}
 		}
 	}
-	return e.sendIPPackets()
+	return e.eachTenant(e.sendIPPackets)
 }
 
 func (e *Executor) processHTTPReader() error {
-	if !e.cfg.Engine.Analyze.HTTP {
+	cfg := e.config()
+	if !cfg.Engine.Analyze.HTTP {
 		log.Warn("http events processing disabled")
 		return nil
 	}
@@ -629,220 +1082,394 @@ func (e *Executor) processHTTPReader() error {
 	log.Infof("found %d http packets", len(httppackets))
 
 	for _, httppacket := range httppackets {
-		if !e.shouldSendHTTPPacket(httppacket) {
+		if !e.shouldSendHTTPPacket(httppacket, inputFile) {
 			continue
 		}
 
-		e.httpbuf.Write(httppacket)
-		if e.httpbuf.Len() >= e.cfg.HTTPEvents.BufferSize {
-			if err := e.sendHTTPPackets(); err != nil {
+		t := e.tenant(httppacket.SrcIP)
+		t.httpbuf.Write(httppacket)
+		if t.httpbuf.Len() >= cfg.HTTPEvents.BufferSize {
+			if err := e.sendHTTPPackets(t); err != nil {
 				return err
 			}
 		}
 	}
 
-	return e.sendHTTPPackets()
+	return e.eachTenant(e.sendHTTPPackets)
 }
 
 // startPacketSender periodcly send dns and ip packets to api.
 func (e *Executor) startPacketSender() {
-	if e.cfg.Engine.Analyze.DNS {
-		go func() {
-			for range time.NewTicker(e.cfg.DNSEvents.FlushInterval).C {
-				e.sendDNSPackets()
-			}
-		}()
+	cfg := e.config()
+	if cfg.Engine.Analyze.DNS {
+		e.every(cfg.DNSEvents.FlushInterval, func() {
+			e.eachTenant(e.sendDNSPackets)
+			e.setFlushed("dns")
+		})
 	}
 
-	if e.cfg.Engine.Analyze.IP {
-		go func() {
-			for range time.NewTicker(e.cfg.IPEvents.FlushInterval).C {
-				e.sendIPPackets()
-			}
-		}()
+	if cfg.Engine.Analyze.IP {
+		e.every(cfg.IPEvents.FlushInterval, func() {
+			e.eachTenant(e.sendIPPackets)
+			e.setFlushed("ip")
+		})
 	}
 
-	if e.cfg.Engine.Analyze.HTTP {
-		go func() {
-			for range time.NewTicker(e.cfg.HTTPEvents.FlushInterval).C {
-				e.sendHTTPPackets()
-			}
-		}()
+	if cfg.Engine.Analyze.HTTP {
+		e.every(cfg.HTTPEvents.FlushInterval, func() {
+			e.eachTenant(e.sendHTTPPackets)
+			e.setFlushed("http")
+		})
+	}
+}
+
+// Actions taken on events that failed to be sent to the Engine.
+const (
+	retryEvents = iota
+	spoolEvents
+	dropEvents
+)
+
+// failedEventsAction decides what to do with events that failed to be sent.
+// Events rejected as invalid are dropped, as they will never be accepted.
+// Events rejected because of the api key are spooled to the failed events
+// file if possible. Otherwise events are kept to retry with the next flush.
+func failedEventsAction(err error, canSpool bool) int {
+	switch {
+	case client.IsValidation(err):
+		return dropEvents
+	case client.IsAuth(err) && canSpool:
+		return spoolEvents
+	}
+	return retryEvents
+}
+
+// logEventsChunks logs results of events sent in more chunks.
+func logEventsChunks(kind string, resp *client.EventsResponse) {
+	if len(resp.Chunks) < 2 {
+		return
+	}
+	for n, chunk := range resp.Chunks {
+		log.Debugf("%s events chunk %d/%d: %d of %d events accepted, rejected: %v",
+			kind, n+1, len(resp.Chunks), chunk.Accepted, chunk.Received, chunk.Rejected)
 	}
 }
 
 // sendDNSPackets sends dns packets to api.
-func (e *Executor) sendDNSPackets() error {
+func (e *Executor) sendDNSPackets(t *tenant) error {
 	// retrive copy of packet and reset the buffer
 	e.mx.Lock()
-	packets := e.dnsbuf.Packets()
+	packets := t.dnsbuf.Packets()
 	e.mx.Unlock()
 
 	if len(packets) == 0 {
 		return nil
 	}
 
-	log.Infof("sending %d dns events for analysis", len(packets))
-	resp, err := e.c.EventsDNS(dnsPacketsToRequest(packets))
+	t.log.Infof("sending %d dns events for analysis", len(packets))
+	resp, err := t.c.EventsDNS(e.ctx, dnsPacketsToRequest(packets))
+	t.recordSend("dns", err)
 	if err != nil {
-		log.Errorf("sending of %d dns events for analysis failed: %s", len(packets), err)
+		t.log.Errorf("sending of %d dns events for analysis failed: %s", len(packets), err)
 
-		// write unsaved packets back to buffer
-		e.mx.Lock()
-		e.dnsbuf.Write(packets...)
-		e.mx.Unlock()
+		// chunks sent before the failure were accepted
+		if resp != nil {
+			countSent("dns", t, resp)
+			packets = packets[resp.Sent():]
+		}
+		switch failedEventsAction(err, e.dnsWriter != nil) {
+		case dropEvents:
+			t.log.Warnf("%d dns events rejected by the engine were dropped", len(packets))
+		case spoolEvents:
+			for i := range packets {
+				if err := e.dnsWriter.Write(packets[i]); err != nil {
+					t.log.Warnf("writing dns events to file failed: %s", err)
+					break
+				}
+			}
+		default:
+			// write unsaved packets back to buffer
+			e.mx.Lock()
+			t.dnsbuf.Write(packets...)
+			e.mx.Unlock()
+		}
 		return err
 	}
 
-	log.Infof("%d of %d total dns events were successfully sent for analysis", resp.Accepted, resp.Received)
+	logEventsChunks("dns", resp)
+	countSent("dns", t, resp)
+	e.rejects.engine("dns", resp.Rejected)
+	t.log.Infof("%d of %d total dns events were successfully sent for analysis", resp.Accepted, resp.Received)
 	return nil
 }
 
 // sendIPPackets sends ip packets to api.
-func (e *Executor) sendIPPackets() error {
+func (e *Executor) sendIPPackets(t *tenant) error {
 	// retrive copy of packet and reset the buffer
 	e.mx.Lock()
-	packets := e.ipbuf.Packets()
+	packets := t.ipbuf.Packets()
 	e.mx.Unlock()
 
 	if len(packets) == 0 {
 		return nil
 	}
 
-	log.Infof("sending %d ip events for analysis", len(packets))
-	resp, err := e.c.EventsIP(ipPacketsToRequest(packets))
+	t.log.Infof("sending %d ip events for analysis", len(packets))
+	resp, err := t.c.EventsIP(e.ctx, ipPacketsToRequest(packets))
+	t.recordSend("ip", err)
 	if err != nil {
-		log.Errorf("sending %d ip events for analysis failed: %s", len(packets), err)
+		t.log.Errorf("sending %d ip events for analysis failed: %s", len(packets), err)
 
-		// write unsaved packets back to buffer
-		e.mx.Lock()
-		e.ipbuf.Write(packets...)
-		e.mx.Unlock()
+		// chunks sent before the failure were accepted
+		if resp != nil {
+			countSent("ip", t, resp)
+			packets = packets[resp.Sent():]
+		}
+		switch failedEventsAction(err, e.ipWriter != nil) {
+		case dropEvents:
+			t.log.Warnf("%d ip events rejected by the engine were dropped", len(packets))
+		case spoolEvents:
+			for i := range packets {
+				if err := e.ipWriter.Write(packets[i]); err != nil {
+					t.log.Warnf("writing ip events to file failed: %s", err)
+					break
+				}
+			}
+		default:
+			// write unsaved packets back to buffer
+			e.mx.Lock()
+			t.ipbuf.Write(packets...)
+			e.mx.Unlock()
+		}
 		return err
 	}
 
-	log.Infof("%d of %d total ip events were successfully sent for analysis", resp.Accepted, resp.Received)
+	logEventsChunks("ip", resp)
+	countSent("ip", t, resp)
+	e.rejects.engine("ip", resp.Rejected)
+	t.log.Infof("%d of %d total ip events were successfully sent for analysis", resp.Accepted, resp.Received)
 	return nil
 }
 
 // sendHTTPPackets sends http packets to api.
-func (e *Executor) sendHTTPPackets() error {
+func (e *Executor) sendHTTPPackets(t *tenant) error {
 	// retrive copy of packet and reset the buffer
 	e.mx.Lock()
-	packets := e.httpbuf.Packets()
+	packets := t.httpbuf.Packets()
 	e.mx.Unlock()
 
 	if len(packets) == 0 {
 		return nil
 	}
 
-	log.Infof("sending %d http events for analysis", len(packets))
-	resp, err := e.c.EventsHTTP(packets)
+	t.log.Infof("sending %d http events for analysis", len(packets))
+	resp, err := t.c.EventsHTTP(e.ctx, packets)
+	t.recordSend("http", err)
 	if err != nil {
-		log.Errorf("sending %d http events for analysis failed: %s", len(packets), err)
+		t.log.Errorf("sending %d http events for analysis failed: %s", len(packets), err)
+
+		// chunks sent before the failure were accepted
+		if resp != nil {
+			countSent("http", t, resp)
+			packets = packets[resp.Sent():]
+		}
+
+		// http events are not captured by the sniffer, so they can't be spooled
+		if failedEventsAction(err, false) == dropEvents {
+			t.log.Warnf("%d http events rejected by the engine were dropped", len(packets))
+			return err
+		}
 
 		// write unsaved packets back to buffer
 		e.mx.Lock()
-		e.httpbuf.Write(packets...)
+		t.httpbuf.Write(packets...)
 		e.mx.Unlock()
 		return err
 	}
 
-	log.Infof("%d of %d total http events were successfully sent for analysis", resp.Accepted, resp.Received)
+	logEventsChunks("http", resp)
+	countSent("http", t, resp)
+	e.rejects.engine("http", resp.Rejected)
+	t.log.Infof("%d of %d total http events were successfully sent for analysis", resp.Accepted, resp.Received)
 	return nil
 }
 
 // do retrives packets from sniffer, filter it and send to api.
+// It returns when the executor is stopped.
 func (e *Executor) do() error {
-	for rawpacket := range e.sniffer.Packets() {
-		if e.cfg.Engine.Analyze.IP {
+	cfg := e.config()
+	packets := e.sniffer.Packets()
+	for {
+		var rawpacket gopacket.Packet
+		select {
+		case <-e.done.Done():
+			// closing the handle may block until the next packet is captured
+			if s, ok := e.sniffer.(interface{ Close() }); ok {
+				go s.Close()
+			}
+			return nil
+		case p, ok := <-packets:
+			if !ok {
+				return nil
+			}
+			rawpacket = p
+		}
+
+		if cfg.Engine.Analyze.IP {
 			ippacket := packet.NewIPPacket(rawpacket)
 			if ippacket == nil {
 				continue
 			}
 
-			ippacket.DetermineDirection(e.cfg.Inputs.Sniffer.HardwareAddr)
+			ippacket.DetermineDirection(cfg.Inputs.Sniffer.HardwareAddr)
 
-			if e.shouldSendIPPacket(ippacket) {
+			if e.shouldSendIPPacket(ippacket, inputSniffer) {
+				t := e.tenant(ippacket.SrcIP)
 				e.mx.Lock()
-				e.ipbuf.Write(ippacket)
-				l := e.ipbuf.Len()
+				t.ipbuf.Write(ippacket)
+				l := t.ipbuf.Len()
 				e.mx.Unlock()
-				if l >= e.cfg.IPEvents.BufferSize {
-					go e.sendIPPackets()
+				if l >= cfg.IPEvents.BufferSize {
+					e.sendInBackground(e.sendIPPackets, t)
 				}
 			}
 		}
 
-		if e.cfg.Engine.Analyze.DNS {
+		if cfg.Engine.Analyze.DNS {
+			if e.dnsHeuristics != nil || e.beacons != nil {
+				e.observeDNSResponse(rawpacket)
+			}
+
 			dnspacket := packet.NewDNSPacket(rawpacket)
 			if dnspacket == nil {
 				continue
 			}
 
-			if e.shouldSendDNSPacket(dnspacket) {
+			if e.shouldSendDNSPacket(dnspacket, inputSniffer) {
+				t := e.tenant(dnspacket.SrcIP)
 				e.mx.Lock()
-				e.dnsbuf.Write(dnspacket)
-				l := e.dnsbuf.Len()
+				t.dnsbuf.Write(dnspacket)
+				l := t.dnsbuf.Len()
 				e.mx.Unlock()
-				if l >= e.cfg.DNSEvents.BufferSize {
+				if l >= cfg.DNSEvents.BufferSize {
 					// do not wait for sending packets
-					go e.sendDNSPackets()
+					e.sendInBackground(e.sendDNSPackets, t)
 				}
 			}
 		}
 	}
-
-	// send what left in the buffer and
-	// wait for other gorutines to finish
-	e.sendDNSPackets()
-	e.sendIPPackets()
-	return nil
 }
 
-// shouldSendIPPacket testdns if ip packet should be send to channel
-func (e *Executor) shouldSendIPPacket(p *packet.IPPacket) bool {
+// shouldSendIPPacket testdns if ip packet read from input should be send to channel
+func (e *Executor) shouldSendIPPacket(p *packet.IPPacket, input string) bool {
+	eventsParsed.Inc("ip", input)
+	if entry := ipPacketToEntry(p); !e.rejects.check("ip", entry.Validate(time.Now()), entry) {
+		return false
+	}
+	// indicators are matched regardless of scope and sampling
+	if e.ioc != nil {
+		e.ioc.CheckIP(p.Timestamp, p.SrcIP, p.SrcPort, p.DstIP, p.DstPort, p.Protocol, p.Ja3)
+	}
 	if (p.Direction == packet.DirectionOut && utils.IsSpecialIP(p.DstIP)) ||
 		(p.Direction == packet.DirectionIn && utils.IsSpecialIP(p.SrcIP)) {
+		eventsFiltered.Inc("ip", input, groupSpecialIP)
 		return false
 	}
 	// no scope groups configured
-	if e.groups == nil {
-		return true
+	if e.groups != nil {
+		name, t := e.groups.IsIPWhitelisted(p.SrcIP, p.DstIP, p.DstPort, p.Protocol)
+		if !t {
+			log.Debugf("ip packet from %s to %s excluded by %s group", p.SrcIP, p.DstIP, name)
+			eventsFiltered.Inc("ip", input, name)
+			return false
+		}
+		if !e.sampled("ip", input, p.SrcIP, p.DstIP.String(), strconv.Itoa(p.DstPort), p.Protocol) {
+			return false
+		}
 	}
-	name, t := e.groups.IsIPWhitelisted(p.SrcIP, p.DstIP)
-	if !t {
-		log.Debugf("ip packet from %s to %s excluded by %s group", p.SrcIP, p.DstIP, name)
+	eventsBuffered.Inc("ip", input)
+	// replies are part of the connection started by the other side
+	if e.beacons != nil && p.Direction != packet.DirectionIn {
+		e.beacons.Observe(p.Timestamp, p.SrcIP, p.DstIP, p.DstPort, p.Protocol, p.BytesCount)
 	}
-	return t
+	return true
 }
 
-// shouldSendDNSPackets tests if dns packet should be send to channel
-func (e *Executor) shouldSendDNSPacket(p *packet.DNSPacket) bool {
-	// no scope groups configured
-	if e.groups == nil {
-		return true
+// observeDNSResponse adds in scope dns response to dns heuristics
+// and resolved addresses to beacon detector.
+func (e *Executor) observeDNSResponse(rawpacket gopacket.Packet) {
+	r := packet.NewDNSResponse(rawpacket)
+	if r == nil {
+		return
 	}
-
-	// do not consider to what server dns packets was sent, thus dst ip == nil
-	name, t := e.groups.IsDNSQueryWhitelisted(p.FQDN, p.SrcIP, nil)
-	if !t {
-		log.Debugf("dns query %s excluded by %s group", p, name)
+	// resolved domains of out of scope responses are needed as well,
+	// beacons to domains trusted by scope groups are not reported.
+	if e.beacons != nil && len(r.IPs) > 0 {
+		e.beacons.ObserveDNS(r.FQDN, r.IPs)
+	}
+	if e.dnsHeuristics == nil {
+		return
+	}
+	if e.groups != nil {
+		if _, ok := e.groups.IsDNSQueryWhitelisted(r.FQDN, r.ClientIP, nil); !ok {
+			return
+		}
 	}
-	return t
+	e.dnsHeuristics.ObserveResponse(r.Timestamp, r.ClientIP, r.FQDN, r.NXDomain)
 }
 
-func (e *Executor) shouldSendHTTPPacket(p *client.HTTPEntry) bool {
+// shouldSendDNSPackets tests if dns packet read from input should be send to channel
+func (e *Executor) shouldSendDNSPacket(p *packet.DNSPacket, input string) bool {
+	eventsParsed.Inc("dns", input)
+	if entry := dnsPacketToEntry(p); !e.rejects.check("dns", entry.Validate(time.Now()), entry) {
+		return false
+	}
+	if e.ioc != nil {
+		e.ioc.CheckDNS(p.Timestamp, p.SrcIP, p.FQDN, p.RecordType)
+	}
 	// no scope groups configured
-	if e.groups == nil {
-		return true
+	if e.groups != nil {
+		// do not consider to what server dns packets was sent, thus dst ip == nil
+		name, t := e.groups.IsDNSQueryWhitelisted(p.FQDN, p.SrcIP, nil)
+		if !t {
+			log.Debugf("dns query %s excluded by %s group", p, name)
+			eventsFiltered.Inc("dns", input, name)
+			return false
+		}
+		if !e.sampled("dns", input, p.SrcIP, strings.ToLower(p.FQDN)) {
+			return false
+		}
 	}
+	eventsBuffered.Inc("dns", input)
+	if e.dnsHeuristics != nil {
+		e.dnsHeuristics.ObserveQuery(p.Timestamp, p.SrcIP, p.FQDN, p.RecordType)
+	}
+	return true
+}
 
-	name, t := e.groups.IsHTTPQueryWhitelisted(p.URL, p.SrcIP)
-	if !t {
-		log.Debugf("http query from %s to %s excluded by %s group", p.SrcIP, p.URL, name)
+// shouldSendHTTPPacket tests if http event read from input should be send to channel
+func (e *Executor) shouldSendHTTPPacket(p *client.HTTPEntry, input string) bool {
+	eventsParsed.Inc("http", input)
+	if !e.rejects.check("http", p.Validate(time.Now()), p) {
+		return false
 	}
-	return t
+	if e.ioc != nil {
+		e.ioc.CheckHTTP(p)
+	}
+	// no scope groups configured
+	if e.groups != nil {
+		name, t := e.groups.IsHTTPQueryWhitelisted(p.URL, p.SrcIP)
+		if !t {
+			log.Debugf("http query from %s to %s excluded by %s group", p.SrcIP, p.URL, name)
+			eventsFiltered.Inc("http", input, name)
+			return false
+		}
+		if !e.sampled("http", input, p.SrcIP, p.URL) {
+			return false
+		}
+	}
+	eventsBuffered.Inc("http", input)
+	return true
 }
 
 // startAlertPoller periodcly checks for new alerts.
@@ -850,63 +1477,184 @@ func (e *Executor) startAlertPoller() {
 	log.Info("starting the polling mechanism to check for new alerts")
 	// event poller will return error on api call or writing to disk.
 	// In both cases log the error and try again in a moment.
+	for _, t := range e.tenants {
+		go func(t *tenant) {
+			for e.done.Err() == nil {
+				if err := t.poller.Do(e.done, e.config().Engine.Alerts.PollInterval); err != nil && e.done.Err() == nil {
+					t.log.Errorf("polling alerts failed: %s", err)
+					t.recordPoll(err)
+				}
+			}
+		}(t)
+	}
+}
+
+// startEmailDigest periodically sends digest of email alerts queued by w,
+// until the executor is stopped or the email output is reloaded.
+func (e *Executor) startEmailDigest(w *alerts.EmailWriter) {
+	ctx, cancel := context.WithCancel(e.done)
+	e.emailStop = cancel
+	e.everyUntil(ctx, w.DigestInterval(), func() {
+		if err := w.Flush(); err != nil {
+			log.Errorf("sending email digest failed: %s", err)
+		}
+	})
+}
+
+// startBlocklistExpiry periodically removes expired blocklist entries.
+func (e *Executor) startBlocklistExpiry() {
+	e.every(time.Minute, func() {
+		if err := e.blocklist.Expire(); err != nil {
+			log.Errorf("blocklist expiry failed: %s", err)
+		}
+	})
+}
+
+// startIncidentExpiry periodically closes idle incidents.
+func (e *Executor) startIncidentExpiry() {
+	e.every(time.Minute, func() {
+		if err := e.correlator.Expire(); err != nil {
+			log.Errorf("closing incidents failed: %s", err)
+		}
+	})
+}
+
+// startRejectWarnings periodically warns about rejected events.
+func (e *Executor) startRejectWarnings() {
+	interval := e.config().Engine.Rejects.WarnInterval
+	e.every(interval, func() {
+		e.rejects.flush(interval)
+	})
+}
+
+// startIOCReload periodically reloads indicator feeds.
+func (e *Executor) startIOCReload() {
+	e.every(e.config().IOC.ReloadInterval, func() {
+		if err := e.ioc.Reload(); err != nil {
+			log.Errorf("reloading ioc feeds failed: %s", err)
+		}
+	})
+}
+
+// every calls f periodically with interval until the executor is stopped.
+func (e *Executor) every(interval time.Duration, f func()) {
+	e.everyUntil(e.done, interval, f)
+}
+
+// everyUntil calls f periodically with interval until ctx is done.
+func (e *Executor) everyUntil(ctx context.Context, interval time.Duration, f func()) {
 	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
-			if err := e.alertsPoller.Do(e.cfg.Engine.Alerts.PollInterval); err != nil {
-				log.Errorf("polling alerts failed: %s", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f()
 			}
 		}
 	}()
 }
 
-// installSignalHandler install os.Interrupt handler for writing alerts
-// into file if there are some in the buffer. If the dns/ip writer is
-// not configured, signal handler is not installed.
-func (e *Executor) installSignalHandler() {
-	// Unless writer is set, then no handler is needed
-	if e.dnsWriter == nil && e.ipWriter == nil {
-		return
+// sendInBackground sends events of the tenant without waiting for it.
+func (e *Executor) sendInBackground(send func(*tenant) error, t *tenant) {
+	e.sends.Add(1)
+	go func() {
+		defer e.sends.Done()
+		send(t)
+	}()
+}
+
+// shutdown sends buffered events of all tenants after inputs are stopped.
+// Events not sent before e.ctx is canceled are written to failed events
+// files, if configured. Queued email alerts and digest are sent as well.
+func (e *Executor) shutdown() {
+	e.sends.Wait()
+	e.eachTenant(e.sendDNSPackets)
+	e.eachTenant(e.sendIPPackets)
+	e.eachTenant(e.sendHTTPPackets)
+	e.spoolBuffers()
+
+	// inputs are stopped, so no more alerts of local detectors are queued
+	if e.localAlerts != nil {
+		e.localAlerts.Close()
 	}
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-
-		dnspackets := e.dnsbuf.Packets()
-		if e.dnsWriter != nil && len(dnspackets) > 0 {
-			for i := range dnspackets {
-				if err := e.dnsWriter.Write(dnspackets[i]); err != nil {
+	// open incidents are closed before outputs
+	if e.correlator != nil {
+		if err := e.correlator.Close(); err != nil {
+			log.Errorf("closing incidents failed: %s", err)
+		}
+	}
+
+	// queued email and chat alerts are sent
+	e.mx.Lock()
+	outputs := e.outputs
+	e.mx.Unlock()
+	closeOutputs(outputs)
+	for _, w := range []*packet.Writer{e.dnsWriter, e.ipWriter} {
+		if w != nil {
+			w.Close()
+		}
+	}
+	log.Info("nfr stopped")
+}
+
+// spoolBuffers writes events left in buffers to failed events files.
+// Events without failed events file are lost.
+func (e *Executor) spoolBuffers() {
+	var dnspackets []*packet.DNSPacket
+	var ippackets []*packet.IPPacket
+	var httppackets int
+	e.mx.Lock()
+	for _, t := range e.tenants {
+		dnspackets = append(dnspackets, t.dnsbuf.Packets()...)
+		ippackets = append(ippackets, t.ipbuf.Packets()...)
+		httppackets += len(t.httpbuf.Packets())
+	}
+	e.mx.Unlock()
+
+	if len(dnspackets) > 0 {
+		n := 0
+		if e.dnsWriter != nil {
+			for ; n < len(dnspackets); n++ {
+				if err := e.dnsWriter.Write(dnspackets[n]); err != nil {
 					log.Warnf("writing dns events to file failed: %s", err)
 					break
 				}
 			}
-
-			log.Infof("%d dns events written to file", len(dnspackets))
+			log.Infof("%d dns events written to file", n)
+		}
+		if n < len(dnspackets) {
+			log.Warnf("%d dns events not sent were lost", len(dnspackets)-n)
 		}
+	}
 
-		ippackets := e.ipbuf.Packets()
-		if e.ipWriter != nil && len(ippackets) > 0 {
-			for i := range ippackets {
-				if err := e.ipWriter.Write(ippackets[i]); err != nil {
+	if len(ippackets) > 0 {
+		n := 0
+		if e.ipWriter != nil {
+			for ; n < len(ippackets); n++ {
+				if err := e.ipWriter.Write(ippackets[n]); err != nil {
 					log.Warnf("writing ip events to file failed: %s", err)
 					break
 				}
 			}
-
-			log.Infof("%d ip events written to file", len(ippackets))
+			log.Infof("%d ip events written to file", n)
+		}
+		if n < len(ippackets) {
+			log.Warnf("%d ip events not sent were lost", len(ippackets)-n)
 		}
+	}
 
-		os.Exit(1)
-	}()
+	if httppackets > 0 {
+		log.Warnf("%d http events not sent were lost", httppackets)
+	}
 }
 
-// createGroups creates groups for matching packets.
-func createGroups(cfg *config.Config) (*groups.Groups, error) {
-	log.Infof("loaded %d groups containing monitoring scope data", len(cfg.ScopeConfig.Groups))
-	if len(cfg.ScopeConfig.Groups) == 0 {
-		return nil, nil
-	}
+// NewGroups creates scope groups of the config for matching packets.
+func NewGroups(cfg *config.Config) (*groups.Groups, error) {
+	// groups are created even if empty, so groups can be added by reload
 	gr := groups.New()
 	for name, group := range cfg.ScopeConfig.Groups {
 		g := &groups.Group{
@@ -917,6 +1665,30 @@ func createGroups(cfg *config.Config) (*groups.Groups, error) {
 			DstIncludes:     []string{"0.0.0.0/0", "::/0"},
 			DstExcludes:     group.TrustedIps,
 			ExcludedDomains: group.TrustedDomains,
+			ExcludedURLs:    group.TrustedURLs,
+
+			ExcludedCertHashes: group.TrustedCerts,
+			ExcludedJA3:        group.TrustedJA3,
+
+			DstPortIncludes:  group.Ports,
+			DstPortExcludes:  group.TrustedPorts,
+			ProtocolIncludes: group.Protocols,
+			ProtocolExcludes: group.TrustedProtocols,
+		}
+		if group.Engine != nil {
+			g.Tenant = group.Engine.Tenant
+		}
+		// disabled analysis is sampling of no events
+		if len(group.Analyze) > 0 || len(group.SampleRate) > 0 {
+			g.SampleRates = make(map[string]float64)
+			for eventType, rate := range group.SampleRate {
+				g.SampleRates[eventType] = rate
+			}
+			for eventType, enabled := range group.Analyze {
+				if !enabled {
+					g.SampleRates[eventType] = 0
+				}
+			}
 		}
 		if err := gr.Add(g); err != nil {
 			return nil, err
@@ -938,7 +1710,7 @@ func (e *Executor) openFileParser(file, fileFomrat string) (err error) {
 		var p *msdns.Parser
 		p, err = msdns.NewFileParser(file)
 		if p != nil {
-			p.TimeFormat = e.cfg.Inputs.MSDNSTimeFormat
+			p.TimeFormat = e.config().Inputs.MSDNSTimeFormat
 		}
 		e.lr = p
 	case "syslog-named":
@@ -951,43 +1723,53 @@ func (e *Executor) openFileParser(file, fileFomrat string) (err error) {
 	return err
 }
 
+// ipPacketToEntry changes ip packet to client ip entry.
+func ipPacketToEntry(ippacket *packet.IPPacket) *client.IPEntry {
+	entry := &client.IPEntry{
+		Timestamp: ippacket.Timestamp,
+		SrcIP:     ippacket.SrcIP,
+		SrcPort:   ippacket.SrcPort,
+		DstIP:     ippacket.DstIP,
+		DstPort:   ippacket.DstPort,
+		Protocol:  ippacket.Protocol,
+		Ja3:       ippacket.Ja3,
+	}
+	switch ippacket.Direction {
+	case packet.DirectionIn:
+		entry.BytesIn = ippacket.BytesCount
+	case packet.DirectionOut:
+		entry.BytesOut = ippacket.BytesCount
+	default:
+		// If can't be determine the assumie it bytes out
+		entry.BytesOut = ippacket.BytesCount
+	}
+	return entry
+}
+
 // ipPacketsToRequest changes ip packets to client ip request.
 func ipPacketsToRequest(packets []*packet.IPPacket) *client.EventsIPRequest {
 	var req client.EventsIPRequest
 	for _, ippacket := range packets {
-		entry := &client.IPEntry{
-			Timestamp: ippacket.Timestamp,
-			SrcIP:     ippacket.SrcIP,
-			SrcPort:   ippacket.SrcPort,
-			DstIP:     ippacket.DstIP,
-			DstPort:   ippacket.DstPort,
-			Protocol:  ippacket.Protocol,
-			Ja3:       ippacket.Ja3,
-		}
-		switch ippacket.Direction {
-		case packet.DirectionIn:
-			entry.BytesIn = ippacket.BytesCount
-		case packet.DirectionOut:
-			entry.BytesOut = ippacket.BytesCount
-		default:
-			// If can't be determine the assumie it bytes out
-			entry.BytesOut = ippacket.BytesCount
-		}
-		req.Entries = append(req.Entries, entry)
+		req.Entries = append(req.Entries, ipPacketToEntry(ippacket))
 	}
 	return &req
 }
 
+// dnsPacketToEntry changes dns packet to client dns entry.
+func dnsPacketToEntry(dnspacket *packet.DNSPacket) *client.DNSEntry {
+	return &client.DNSEntry{
+		Timestamp: dnspacket.Timestamp,
+		SrcIP:     dnspacket.SrcIP,
+		Query:     dnspacket.FQDN,
+		QType:     dnspacket.RecordType,
+	}
+}
+
 // dnsPacketsToRequest changes dns packets to client dns request.
 func dnsPacketsToRequest(packets []*packet.DNSPacket) *client.EventsDNSRequest {
 	var req client.EventsDNSRequest
 	for _, dnspacket := range packets {
-		req.Entries = append(req.Entries, &client.DNSEntry{
-			Timestamp: dnspacket.Timestamp,
-			SrcIP:     dnspacket.SrcIP,
-			Query:     dnspacket.FQDN,
-			QType:     dnspacket.RecordType,
-		})
+		req.Entries = append(req.Entries, dnsPacketToEntry(dnspacket))
 	}
 	return &req
 }
@@ -0,0 +1,146 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// downClient fails as if AlphaSOC Engine is down.
+type downClient struct {
+	client.Client
+}
+
+func (c *downClient) EventsDNS(ctx context.Context, req *client.EventsDNSRequest) (*client.EventsDNSResponse, error) {
+	return nil, &client.Error{Kind: client.ErrorTransient, Message: "service unavailable"}
+}
+
+// newRawDNSPacket creates captured dns query packet.
+func newRawDNSPacket(t *testing.T, srcIP net.IP, query string) *packet.DNSPacket {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: srcIP, DstIP: net.IPv4(8, 8, 8, 8)}
+	udp := &layers.UDP{SrcPort: 53000, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+	dns := &layers.DNS{
+		ID:        1,
+		RD:        true,
+		Questions: []layers.DNSQuestion{{Name: []byte(query), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, dns); err != nil {
+		t.Fatal(err)
+	}
+	raw := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	raw.Metadata().CaptureInfo = gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(buf.Bytes()),
+		Length:        len(buf.Bytes()),
+	}
+	p := packet.NewDNSPacket(raw)
+	if p == nil {
+		t.Fatal("invalid dns packet")
+	}
+	return p
+}
+
+func TestShutdown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dns.pcap")
+	w, err := packet.NewWriter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headerSize := info.Size()
+
+	c := &dnsClient{}
+	e := &Executor{cfg: config.NewDefault(), dnsWriter: w}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	e.tenants = []*tenant{newTenant("", c)}
+	e.tenants[0].dnsbuf.Write(newRawDNSPacket(t, net.IPv4(10, 0, 0, 1), "a.com"))
+	e.sendInBackground(e.sendDNSPackets, e.tenants[0])
+	e.shutdown()
+	if len(c.queries) != 1 {
+		t.Fatalf("buffered events not sent on shutdown, got %v", c.queries)
+	}
+
+	// events not sent before shutdown timeout are spooled
+	e.dnsWriter, _ = packet.NewWriter(file)
+	e.tenants[0] = newTenant("", &downClient{})
+	e.tenants[0].dnsbuf.Write(newRawDNSPacket(t, net.IPv4(10, 0, 0, 1), "b.com"))
+	e.cancel()
+	e.shutdown()
+	if info, err := os.Stat(file); err != nil || info.Size() == headerSize {
+		t.Fatalf("events not written to failed events file: %v", err)
+	}
+}
+
+func TestSendElasticPartial(t *testing.T) {
+	e := &Executor{cfg: config.NewDefault()}
+	e.rejects, _ = newRejectStats(false, "", 0)
+	var sends []int
+	b := &elasticBatch{t: newTenant("", &downClient{}), n: 10, send: func(from int) (*client.EventsResponse, error) {
+		sends = append(sends, from)
+		resp := &client.EventsResponse{}
+		if len(sends) == 1 {
+			// the first chunk is accepted, the second one fails
+			resp.Chunks = []client.EventsChunk{{Entries: 4, Received: 4, Accepted: 4}}
+			return resp, &client.Error{Kind: client.ErrorTransient, Message: "service unavailable"}
+		}
+		resp.Chunks = []client.EventsChunk{{Entries: 10 - from, Received: 10 - from, Accepted: 10 - from}}
+		return resp, nil
+	}}
+
+	l := log.NewEntry(log.StandardLogger())
+	pending := e.sendElastic("dns", []*elasticBatch{b}, l)
+	if len(pending) != 1 || b.sent != 4 {
+		t.Fatalf("expected batch pending with 4 sent events, got %d pending, %d sent", len(pending), b.sent)
+	}
+	if pending = e.sendElastic("dns", pending, l); len(pending) != 0 {
+		t.Fatal("expected batch sent")
+	}
+	if len(sends) != 2 || sends[1] != 4 {
+		t.Fatalf("expected events sent again from 4, got %v", sends)
+	}
+}
+
+func TestSendKeepsEventsOnHTTPErrors(t *testing.T) {
+	for _, code := range []int{http.StatusNotFound, http.StatusProxyAuthRequired, http.StatusRequestEntityTooLarge} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		c := client.New(ts.URL, "test-key")
+		c.SetRetryPolicy(client.RetryPolicy{})
+
+		e := &Executor{cfg: config.NewDefault(), ctx: context.Background()}
+		e.tenants = []*tenant{newTenant("", c)}
+		e.tenants[0].dnsbuf.Write(newRawDNSPacket(t, net.IPv4(10, 0, 0, 1), "a.com"))
+		if err := e.sendDNSPackets(e.tenants[0]); err == nil {
+			t.Fatalf("%d: expected error", code)
+		}
+		ts.Close()
+		if n := e.tenants[0].dnsbuf.Len(); n != 1 {
+			t.Fatalf("%d: got %d buffered events; expected 1", code, n)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package executor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/metrics"
+	"github.com/alphasoc/nfr/sniffer"
+)
+
+// Inputs events are read from, used as metrics label.
+const (
+	inputSniffer = "sniffer"
+	inputMonitor = "monitor"
+	inputFile    = "file"
+	inputElastic = "elastic"
+)
+
+// groupSpecialIP is a filtered events label of ip events to or from
+// special (e.g. private, multicast) ip addresses.
+const groupSpecialIP = "<special-ip>"
+
+// Pipeline metrics. Tenant label of the default tenant is empty.
+var (
+	eventsParsed = metrics.NewCounterVec("nfr_events_parsed_total",
+		"Events read from inputs.", "type", "input")
+	eventsFiltered = metrics.NewCounterVec("nfr_events_filtered_total",
+		"Events out of scope, by the scope group excluding them.", "type", "input", "group")
+	eventsSampledOut = metrics.NewCounterVec("nfr_events_sampled_out_total",
+		"Events in scope dropped by sampling, by the scope group sampling them.", "type", "input", "group")
+	eventsBuffered = metrics.NewCounterVec("nfr_events_buffered_total",
+		"Events in scope queued for sending to AlphaSOC Engine.", "type", "input")
+	eventsSent = metrics.NewCounterVec("nfr_events_sent_total",
+		"Events sent to AlphaSOC Engine.", "type", "tenant")
+	eventsAccepted = metrics.NewCounterVec("nfr_events_accepted_total",
+		"Events accepted by AlphaSOC Engine.", "type", "tenant")
+
+	apiDuration = metrics.NewHistogramVec("nfr_api_request_duration_seconds",
+		"Duration of AlphaSOC API requests.", nil, "endpoint")
+	apiErrors = metrics.NewCounterVec("nfr_api_errors_total",
+		"Failed AlphaSOC API requests by error kind.", "endpoint", "kind")
+)
+
+// observeAPIRequest is a client observer collecting api metrics.
+func observeAPIRequest(path string, d time.Duration, err error) {
+	apiDuration.Observe(d.Seconds(), path)
+	if err != nil {
+		apiErrors.Inc(path, apiErrorKind(err))
+	}
+}
+
+// apiErrorKind returns metrics label of api error.
+func apiErrorKind(err error) string {
+	var e *client.Error
+	if errors.As(err, &e) {
+		return e.Kind.String()
+	}
+	return "canceled"
+}
+
+// countSent counts events sent to and accepted by the tenant.
+func countSent(eventType string, t *tenant, resp *client.EventsResponse) {
+	eventsSent.Add(float64(resp.Received), eventType, t.name)
+	eventsAccepted.Add(float64(resp.Accepted), eventType, t.name)
+}
+
+// setCheckpoint sets time of the newest event ingested by elasticsearch search.
+func (e *Executor) setCheckpoint(search string, t time.Time) {
+	e.mx.Lock()
+	e.checkpoints[search] = t
+	e.mx.Unlock()
+}
+
+// newMetrics creates registry of metrics reading executor state:
+// rejected events, buffers, sniffer stats, elasticsearch and monitor progress.
+func (e *Executor) newMetrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+
+	r.NewCounterFunc("nfr_events_rejected_total",
+		"Events rejected by local validation or AlphaSOC Engine.",
+		[]string{"type", "source", "reason"},
+		func(set func(float64, ...string)) {
+			for key, n := range e.rejects.counts() {
+				set(float64(n), key.Type, key.Source, key.Reason)
+			}
+		})
+
+	r.NewGaugeFunc("nfr_buffer_events",
+		"Events waiting in buffers to be sent to AlphaSOC Engine.",
+		[]string{"type", "tenant"},
+		func(set func(float64, ...string)) {
+			e.mx.Lock()
+			defer e.mx.Unlock()
+			for _, t := range e.tenants {
+				set(float64(t.dnsbuf.Len()), "dns", t.name)
+				set(float64(t.ipbuf.Len()), "ip", t.name)
+				set(float64(t.httpbuf.Len()), "http", t.name)
+			}
+		})
+
+	sniffed := func(stat func(sniffer.Stats) int) func(func(float64, ...string)) {
+		return func(set func(float64, ...string)) {
+			e.mx.Lock()
+			s, ok := e.sniffer.(interface{ Stats() (sniffer.Stats, error) })
+			e.mx.Unlock()
+			if !ok {
+				return
+			}
+			if stats, err := s.Stats(); err == nil {
+				set(float64(stat(stats)))
+			}
+		}
+	}
+	r.NewCounterFunc("nfr_sniffer_packets_received_total",
+		"Packets received by the network sniffer.", nil,
+		sniffed(func(s sniffer.Stats) int { return s.Received }))
+	r.NewCounterFunc("nfr_sniffer_packets_dropped_total",
+		"Packets dropped by the network sniffer, because of buffer overflow.", nil,
+		sniffed(func(s sniffer.Stats) int { return s.Dropped }))
+	r.NewCounterFunc("nfr_sniffer_packets_if_dropped_total",
+		"Packets dropped by the network interface.", nil,
+		sniffed(func(s sniffer.Stats) int { return s.IfDropped }))
+
+	r.NewGaugeFunc("nfr_elastic_search_lag_seconds",
+		"Time since the newest event ingested by elasticsearch search.",
+		[]string{"search"},
+		func(set func(float64, ...string)) {
+			e.mx.Lock()
+			defer e.mx.Unlock()
+			for search, t := range e.checkpoints {
+				set(time.Since(t).Seconds(), search)
+			}
+		})
+
+	r.NewGaugeFunc("nfr_monitor_file_offset_bytes",
+		"Read offset of monitored log files.",
+		[]string{"file"},
+		func(set func(float64, ...string)) {
+			e.mx.Lock()
+			defer e.mx.Unlock()
+			for file, t := range e.tails {
+				if offset, err := t.Tell(); err == nil {
+					set(float64(offset), file)
+				}
+			}
+		})
+
+	return r
+}
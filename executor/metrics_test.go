@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/metrics"
+	"github.com/alphasoc/nfr/packet"
+)
+
+func TestMetrics(t *testing.T) {
+	gr := groups.New()
+	if err := gr.Add(&groups.Group{
+		Name:            "metrics",
+		SrcIncludes:     []string{"10.0.0.0/8"},
+		ExcludedDomains: []string{"*.local"},
+		Tenant:          "metrics",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Executor{
+		cfg:         config.NewDefault(),
+		ctx:         context.Background(),
+		groups:      gr,
+		checkpoints: map[string]time.Time{"dns-000": time.Now().Add(-time.Minute)},
+	}
+	e.rejects, _ = newRejectStats(true, "", 0)
+	e.tenants = []*tenant{newTenant("", &dnsClient{}), newTenant("metrics", &dnsClient{})}
+	e.tenantsByName = map[string]*tenant{"": e.tenants[0], "metrics": e.tenants[1]}
+
+	const input = "metrics-test"
+	for _, p := range []*packet.DNSPacket{
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), FQDN: "a.com", RecordType: "A"},
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), FQDN: "b.com", RecordType: "A"},
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), FQDN: "host.local", RecordType: "A"},
+		{Timestamp: time.Now(), SrcIP: nil, FQDN: "c.com", RecordType: "A"},
+	} {
+		if e.shouldSendDNSPacket(p, input) {
+			e.tenant(p.SrcIP).dnsbuf.Write(p)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := e.newMetrics().Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.eachTenant(e.sendDNSPackets); err != nil {
+		t.Fatal(err)
+	}
+	if err := metrics.DefaultRegistry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		`nfr_events_parsed_total{type="dns",input="metrics-test"} 4`,
+		`nfr_events_filtered_total{type="dns",input="metrics-test",group="metrics"} 1`,
+		`nfr_events_buffered_total{type="dns",input="metrics-test"} 2`,
+		`nfr_events_rejected_total{type="dns",source="local",reason="invalid_ip"} 1`,
+		`nfr_buffer_events{type="dns",tenant="metrics"} 2`,
+		`nfr_events_sent_total{type="dns",tenant="metrics"} 2`,
+		`nfr_events_accepted_total{type="dns",tenant="metrics"} 2`,
+		`nfr_elastic_search_lag_seconds{search="dns-000"} 60`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("metrics without %s:\n%s", line, buf.String())
+		}
+	}
+}
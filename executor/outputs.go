@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/config"
+)
+
+// output is an alerts writer created from a section of outputs config.
+type output struct {
+	kind   string      // file, graylog, syslog, email or chat
+	config interface{} // config section the writer was created from
+	w      alerts.Writer
+}
+
+// newOutputs creates writers of configured outputs. Writers of old
+// outputs with unchanged config are reused, so reloading the config
+// doesn't reopen them.
+func newOutputs(cfg *config.Config, old []*output) ([]*output, error) {
+	var outputs, created []*output
+	reused := make(map[*output]bool)
+
+	add := func(kind string, c interface{}, create func() (alerts.Writer, error)) error {
+		for _, o := range old {
+			if o.kind == kind && !reused[o] && reflect.DeepEqual(o.config, c) {
+				reused[o] = true
+				outputs = append(outputs, o)
+				return nil
+			}
+		}
+		w, err := create()
+		if err != nil {
+			return err
+		}
+		o := &output{kind: kind, config: c, w: w}
+		created = append(created, o)
+		outputs = append(outputs, o)
+		return nil
+	}
+
+	err := newOutputWriters(cfg, add)
+	if err != nil {
+		closeOutputs(created)
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// newOutputWriters calls add for each configured output
+// with its config section and function creating the writer.
+func newOutputWriters(cfg *config.Config, add func(string, interface{}, func() (alerts.Writer, error)) error) error {
+	if cfg.Outputs.File != "" {
+		c := struct{ File, Format string }{cfg.Outputs.File, cfg.Outputs.Format}
+		err := add("file", c, func() (alerts.Writer, error) {
+			format := getFormatter(c.Format)
+			if format == nil {
+				return nil, fmt.Errorf("invalid output format: %s", c.Format)
+			}
+			return alerts.NewFileWriter(c.File, format)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Outputs.Graylog.URI != "" {
+		c := cfg.Outputs.Graylog
+		err := add("graylog", c, func() (alerts.Writer, error) {
+			return alerts.NewGraylogWriter(c.URI, c.Level)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Outputs.Syslog.IP != "" {
+		c := cfg.Outputs.Syslog
+		err := add("syslog", c, func() (alerts.Writer, error) {
+			addr := net.JoinHostPort(c.IP, strconv.FormatInt(int64(c.Port), 10))
+			format := getFormatter(c.Format)
+			if format == nil {
+				return nil, fmt.Errorf("invalid syslog format: %s", c.Format)
+			}
+			return alerts.NewSyslogWriter(c.Proto, addr, format)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Outputs.Email.Enabled {
+		email := cfg.Outputs.Email
+		err := add("email", email, func() (alerts.Writer, error) {
+			return alerts.NewEmailWriter(alerts.EmailConfig{
+				Host:              email.Host,
+				Port:              email.Port,
+				Username:          email.Username,
+				Password:          email.Password,
+				StartTLS:          email.StartTLS,
+				From:              email.From,
+				To:                email.To,
+				Subject:           email.Subject,
+				ImmediateSeverity: email.ImmediateSeverity,
+				DigestInterval:    email.DigestInterval,
+				HTMLTemplate:      email.HTMLTemplate,
+				TextTemplate:      email.TextTemplate,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range cfg.Outputs.Chat {
+		ch := ch
+		err := add("chat", ch, func() (alerts.Writer, error) {
+			return alerts.NewChatWriter(alerts.ChatConfig{
+				Name:        ch.Name,
+				Type:        ch.Type,
+				WebhookURL:  ch.WebhookURL,
+				Channel:     ch.Channel,
+				Username:    ch.Username,
+				Card:        ch.Card,
+				MinSeverity: ch.MinSeverity,
+				RateLimit:   ch.MessagesPerMinute(),
+				Burst:       ch.Burst,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputWriters returns writers of outputs.
+func outputWriters(outputs []*output) []alerts.Writer {
+	writers := make([]alerts.Writer, len(outputs))
+	for i, o := range outputs {
+		writers[i] = o.w
+	}
+	return writers
+}
+
+// emailWriter returns writer of email output, if configured.
+func emailWriter(outputs []*output) *alerts.EmailWriter {
+	for _, o := range outputs {
+		if w, ok := o.w.(*alerts.EmailWriter); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// closeOutputs closes writers of outputs holding connections.
+// Queued email digest is sent before.
+func closeOutputs(outputs []*output) {
+	for _, o := range outputs {
+		if w, ok := o.w.(*alerts.EmailWriter); ok && w.DigestInterval() > 0 {
+			if err := w.Flush(); err != nil {
+				log.Errorf("sending email digest failed: %s", err)
+			}
+		}
+		if c, ok := o.w.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Warnf("closing %s output failed: %s", o.kind, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Sources of rejected events.
+const (
+	rejectedLocally  = "local"
+	rejectedByEngine = "engine"
+)
+
+// rejectKey identifies counter of rejected events.
+type rejectKey struct {
+	Source string
+	Type   string
+	Reason string
+}
+
+// rejectRecord is a line of the reject log.
+type rejectRecord struct {
+	Timestamp time.Time   `json:"ts"`
+	Source    string      `json:"source"`
+	Type      string      `json:"type"`
+	Reason    string      `json:"reason"`
+	Count     int         `json:"count,omitempty"`
+	Entry     interface{} `json:"entry,omitempty"`
+}
+
+// rejectStats counts events rejected by pre-send validation and by the Engine.
+// Rejections are summarized in a warning by flush, and samples of offending
+// entries are written to the reject log, if configured.
+type rejectStats struct {
+	validate bool
+	samples  int
+
+	mx      sync.Mutex
+	total   map[rejectKey]int
+	pending map[rejectKey]int
+	sampled map[rejectKey]int
+	logf    *os.File
+	now     func() time.Time
+}
+
+func newRejectStats(validate bool, logFile string, samples int) (*rejectStats, error) {
+	s := &rejectStats{
+		validate: validate,
+		samples:  samples,
+		total:    make(map[rejectKey]int),
+		pending:  make(map[rejectKey]int),
+		sampled:  make(map[rejectKey]int),
+		now:      time.Now,
+	}
+	if logFile != "" {
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("can't open reject log: %s", err)
+		}
+		s.logf = f
+	}
+	return s, nil
+}
+
+// check counts entry rejected by pre-send validation with the reason.
+// It returns true if the entry should be sent, i.e. reason is empty
+// or validation is disabled.
+func (s *rejectStats) check(eventType, reason string, entry interface{}) bool {
+	if !s.validate || reason == "" {
+		return true
+	}
+	s.add(rejectKey{rejectedLocally, eventType, reason}, 1, entry)
+	return false
+}
+
+// engine counts events rejected by the Engine.
+func (s *rejectStats) engine(eventType string, rejected map[string]int) {
+	for reason, n := range rejected {
+		if n > 0 {
+			s.add(rejectKey{rejectedByEngine, eventType, reason}, n, nil)
+		}
+	}
+}
+
+// counts returns copy of total counters.
+func (s *rejectStats) counts() map[rejectKey]int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	counts := make(map[rejectKey]int, len(s.total))
+	for key, n := range s.total {
+		counts[key] = n
+	}
+	return counts
+}
+
+func (s *rejectStats) add(key rejectKey, n int, entry interface{}) {
+	now := s.now()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.total[key] += n
+	s.pending[key] += n
+
+	if s.logf != nil && s.sampled[key] < s.samples {
+		s.sampled[key]++
+		record := rejectRecord{now, key.Source, key.Type, key.Reason, 0, entry}
+		if entry == nil {
+			record.Count = n
+		}
+		if err := json.NewEncoder(s.logf).Encode(&record); err != nil {
+			log.Warnf("writing reject log failed: %s", err)
+		}
+	}
+}
+
+// flush warns about events rejected since the last flush
+// and resets samples limit of the reject log.
+func (s *rejectStats) flush(interval time.Duration) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if len(s.pending) > 0 {
+		log.Warnf("events rejected in the last %s: %s", interval, formatRejects(s.pending))
+	}
+	s.pending = make(map[rejectKey]int)
+	s.sampled = make(map[rejectKey]int)
+}
+
+// formatRejects formats counters sorted by type, source and reason,
+// e.g. "dns invalid_ip 3 (local), ip bad_timestamp 10 (engine)".
+func formatRejects(counts map[rejectKey]int) string {
+	keys := make([]rejectKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Reason < b.Reason
+	})
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s %s %d (%s)", key.Type, key.Reason, counts[key], key.Source)
+	}
+	return strings.Join(parts, ", ")
+}
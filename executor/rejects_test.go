@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+func TestRejectStats(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "rejects.log")
+	s, err := newRejectStats(true, logFile, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.check("dns", "", &client.DNSEntry{Query: "alphasoc.com"}) {
+		t.Fatal("valid entry must be sent")
+	}
+	for i := 0; i < 3; i++ {
+		if s.check("dns", client.RejectIP, &client.DNSEntry{Query: "alphasoc.com"}) {
+			t.Fatal("invalid entry must not be sent")
+		}
+	}
+	s.engine("ip", map[string]int{"bad_timestamp": 5, "other": 0})
+
+	counts := s.counts()
+	if n := counts[rejectKey{rejectedLocally, "dns", client.RejectIP}]; n != 3 {
+		t.Fatalf("invalid local rejects count %d", n)
+	}
+	if n := counts[rejectKey{rejectedByEngine, "ip", "bad_timestamp"}]; n != 5 {
+		t.Fatalf("invalid engine rejects count %d", n)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("unexpected counters %v", counts)
+	}
+	if got, expected := formatRejects(s.pending), "dns invalid_ip 3 (local), ip bad_timestamp 5 (engine)"; got != expected {
+		t.Fatalf("invalid warning - got %q; expected %q", got, expected)
+	}
+
+	s.flush(0)
+	if len(s.pending) != 0 || len(s.counts()) != 2 {
+		t.Fatal("flush must reset pending counters only")
+	}
+
+	f, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []rejectRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r rejectRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	// 2 samples of local rejects and 1 of engine rejects
+	if len(records) != 3 || records[0].Entry == nil || records[2].Count != 5 {
+		t.Fatalf("invalid reject log %+v", records)
+	}
+}
+
+func TestRejectStatsValidationDisabled(t *testing.T) {
+	s, err := newRejectStats(false, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.check("dns", client.RejectIP, &client.DNSEntry{}) || len(s.counts()) != 0 {
+		t.Fatal("entries must not be validated when validation is disabled")
+	}
+}
@@ -0,0 +1,321 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/elastic"
+)
+
+// search is a running elasticsearch search.
+type search struct {
+	name   string
+	conn   elastic.Config // connection settings, without searches
+	config elastic.SearchConfig
+	cancel context.CancelFunc
+}
+
+func newSearch(name string, cfg *elastic.Config, s *elastic.SearchConfig, cancel context.CancelFunc) *search {
+	conn := *cfg
+	conn.Searches = nil
+	return &search{name: name, conn: conn, config: *s, cancel: cancel}
+}
+
+// is returns true if the search runs with given config.
+func (s *search) is(cfg *elastic.Config, search *elastic.SearchConfig) bool {
+	conn := *cfg
+	conn.Searches = nil
+	return reflect.DeepEqual(s.conn, conn) && reflect.DeepEqual(&s.config, search)
+}
+
+// startReload reloads the config on SIGHUP and, if watching is enabled,
+// when the config or scope file is changed, until the executor is stopped.
+func (e *Executor) startReload() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	cfg := e.config()
+	watch := cfg.Reload.Watch && cfg.Filename() != ""
+	if watch {
+		log.Infof("watching %s for changes", cfg.Filename())
+	}
+
+	go func() {
+		defer signal.Stop(hup)
+		var changes <-chan time.Time
+		if watch {
+			ticker := time.NewTicker(cfg.Reload.Interval)
+			defer ticker.Stop()
+			changes = ticker.C
+		}
+
+		modified := e.configModTimes()
+		for {
+			select {
+			case <-e.done.Done():
+				return
+			case <-hup:
+				log.Info("SIGHUP received, reloading config")
+			case <-changes:
+				if reflect.DeepEqual(e.configModTimes(), modified) {
+					continue
+				}
+				log.Info("config changed, reloading")
+			}
+			modified = e.configModTimes()
+			if err := e.reload(); err != nil {
+				log.Errorf("reloading config failed, keeping the running one: %s", err)
+			}
+		}
+	}()
+}
+
+// configModTimes returns modification times of the config and scope files,
+// including fragments.
+func (e *Executor) configModTimes() map[string]time.Time {
+	e.mx.Lock()
+	files := e.configFiles
+	e.mx.Unlock()
+
+	times := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			times[file] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// reload reads the config and scope files, including fragments, again
+// and applies changes of scope groups, monitored files, elasticsearch
+// searches and outputs. Unchanged inputs and outputs keep running. Changes of other settings are logged, as
+// they require restart. The running config is kept if the new one is invalid,
+// or it changes tenants of scope groups.
+func (e *Executor) reload() error {
+	filename := e.config().Filename()
+	if filename == "" {
+		return errors.New("config was not read from file")
+	}
+	cfg, err := config.New(filename)
+	if err != nil {
+		return err
+	}
+	return e.apply(cfg)
+}
+
+// apply applies reloadable settings of the new config. The running
+// config is not modified, but replaced with a copy with reloaded settings.
+func (e *Executor) apply(cfg *config.Config) error {
+	running := e.config()
+
+	// events buffered for a tenant would be lost
+	if !reflect.DeepEqual(running.Tenants(), cfg.Tenants()) {
+		return errors.New("tenants of scope groups changed, restart is required")
+	}
+
+	groups, err := NewGroups(cfg)
+	if err != nil {
+		return err
+	}
+
+	// the alerts pipeline is created only when outputs are enabled
+	reloadOutputs := e.outputsWriter != nil && cfg.HasOutputs()
+	var outputs []*output
+	if reloadOutputs {
+		if outputs, err = newOutputs(cfg, e.outputs); err != nil {
+			return err
+		}
+	}
+
+	for _, section := range restartRequired(running, cfg) {
+		log.Warnf("changes of %s settings require restart", section)
+	}
+
+	next := *running
+	next.Scope = cfg.Scope
+	next.ScopeConfig = cfg.ScopeConfig
+	next.Inputs.Monitors = cfg.Inputs.Monitors
+	next.Inputs.Elastic = cfg.Inputs.Elastic
+	if reloadOutputs {
+		next.Outputs = cfg.Outputs
+		next.Outputs.Incidents = running.Outputs.Incidents
+	}
+	e.cfgMx.Lock()
+	e.cfg = &next
+	e.cfgMx.Unlock()
+
+	e.mx.Lock()
+	e.configFiles = cfg.Files()
+	e.mx.Unlock()
+
+	e.groups.Replace(groups)
+	log.Infof("loaded %d groups containing monitoring scope data", len(cfg.ScopeConfig.Groups))
+	if next.Engine.Analyze.DNS || next.Engine.Analyze.IP {
+		e.reloadMonitors(next.Inputs.Monitors)
+	}
+	e.reloadSearches(next.Inputs.Elastic)
+	if reloadOutputs {
+		e.reloadOutputs(outputs)
+	}
+
+	log.Info("config reloaded")
+	return nil
+}
+
+// reloadMonitors stops monitors removed from the config and starts
+// the new ones. Monitors of files that couldn't be opened are restarted.
+func (e *Executor) reloadMonitors(monitors []config.Monitor) {
+	keep := make(map[config.Monitor]bool, len(monitors))
+	for _, monitor := range monitors {
+		keep[monitor] = true
+	}
+
+	e.mx.Lock()
+	for monitor, cancel := range e.monitors {
+		_, failed := e.monitorErrs[monitor.File]
+		if keep[monitor] && !failed {
+			continue
+		}
+		cancel()
+		delete(e.monitors, monitor)
+		delete(e.tails, monitor.File)
+		delete(e.monitorErrs, monitor.File)
+		if !keep[monitor] {
+			log.Infof("stopped monitoring %s", monitor.File)
+		}
+	}
+	running := make(map[config.Monitor]bool, len(e.monitors))
+	for monitor := range e.monitors {
+		running[monitor] = true
+	}
+	e.mx.Unlock()
+
+	for _, monitor := range monitors {
+		if !running[monitor] {
+			e.startMonitor(monitor)
+		}
+	}
+}
+
+// reloadSearches stops elasticsearch searches removed from the config
+// and starts the new ones.
+func (e *Executor) reloadSearches(cfg elastic.Config) {
+	var searches []*elastic.SearchConfig
+	if cfg.Enabled {
+		searches = cfg.Searches
+	}
+
+	e.mx.Lock()
+	keep := make(map[*search]bool)
+	var start []*elastic.SearchConfig
+	for _, sc := range searches {
+		found := false
+		for _, s := range e.searches {
+			if !keep[s] && s.is(&cfg, sc) {
+				keep[s], found = true, true
+				break
+			}
+		}
+		if !found {
+			start = append(start, sc)
+		}
+	}
+	running := e.searches[:0]
+	for _, s := range e.searches {
+		if keep[s] {
+			running = append(running, s)
+			continue
+		}
+		s.cancel()
+		log.Infof("stopped elasticsearch search %s", s.name)
+	}
+	e.searches = running
+	e.mx.Unlock()
+
+	if len(start) > 0 {
+		if err := e.startElastic(&cfg, start); err != nil {
+			log.Errorf("starting elasticsearch searches failed: %s", err)
+		}
+	}
+}
+
+// removeSearch removes status of elasticsearch search removed by reload.
+func (e *Executor) removeSearch(name string) {
+	e.mx.Lock()
+	delete(e.checkpoints, name)
+	delete(e.searchErrs, name)
+	e.mx.Unlock()
+}
+
+// reloadOutputs replaces outputs alerts are written to,
+// and closes outputs not used anymore.
+func (e *Executor) reloadOutputs(outputs []*output) {
+	e.mx.Lock()
+	old := e.outputs
+	e.outputs = outputs
+	e.mx.Unlock()
+	e.outputsWriter.Set(outputWriters(outputs)...)
+
+	used := make(map[*output]bool, len(outputs))
+	for _, o := range outputs {
+		used[o] = true
+	}
+	var removed []*output
+	for _, o := range old {
+		if !used[o] {
+			removed = append(removed, o)
+		}
+	}
+
+	// the digest is sent by the email writer being closed
+	if w := emailWriter(outputs); w != emailWriter(old) {
+		if e.emailStop != nil {
+			e.emailStop()
+			e.emailStop = nil
+		}
+		if w != nil && w.DigestInterval() > 0 {
+			e.startEmailDigest(w)
+		}
+	}
+	closeOutputs(removed)
+}
+
+// restartRequired returns config sections changed in the new config,
+// which are not reloaded.
+func restartRequired(old, cfg *config.Config) []string {
+	var sections []string
+	for _, section := range []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"engine", old.Engine, cfg.Engine},
+		{"inputs.sniffer", old.Inputs.Sniffer, cfg.Inputs.Sniffer},
+		{"inputs.msdns_time_format", old.Inputs.MSDNSTimeFormat, cfg.Inputs.MSDNSTimeFormat},
+		{"inputs.use_inotify", old.Inputs.UseInotify, cfg.Inputs.UseInotify},
+		{"outputs.enabled", old.HasOutputs(), cfg.HasOutputs()},
+		{"outputs.incidents", old.Outputs.Incidents, cfg.Outputs.Incidents},
+		{"response", old.Response, cfg.Response},
+		{"ioc", old.IOC, cfg.IOC},
+		{"heuristics", old.Heuristics, cfg.Heuristics},
+		{"log", old.Log, cfg.Log},
+		{"metrics", old.Metrics, cfg.Metrics},
+		{"status", old.Status, cfg.Status},
+		{"reload", old.Reload, cfg.Reload},
+		{"data", old.Data, cfg.Data},
+		{"dns_events", old.DNSEvents, cfg.DNSEvents},
+		{"ip_events", old.IPEvents, cfg.IPEvents},
+		{"http_events", old.HTTPEvents, cfg.HTTPEvents},
+	} {
+		if !reflect.DeepEqual(section.old, section.new) {
+			sections = append(sections, section.name)
+		}
+	}
+	return sections
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alphasoc/nfr/config"
+)
+
+// writeConfig writes config monitoring file of dns events in bro format,
+// with alerts written to output file and scope groups in scope file.
+func writeConfig(t *testing.T, dir, monitor, output, scope string) string {
+	file := filepath.Join(dir, "config.yml")
+	content := fmt.Sprintf(`
+inputs:
+  monitor:
+  - file: %s
+    type: dns
+    format: bro
+outputs:
+  enabled: true
+  file: %s
+data:
+  file: %s
+  dir: %s
+scope:
+  file: %s
+`, monitor, output, filepath.Join(dir, "nfr.data"), dir, filepath.Join(dir, "scope.yml"))
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scope.yml"), []byte(scope), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	scope := `
+groups:
+  private:
+    in_scope: [10.0.0.0/8]
+`
+	file := writeConfig(t, dir, filepath.Join(dir, "a.log"), filepath.Join(dir, "alerts.json"), scope)
+	cfg, err := config.New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(&dnsClient{}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.done = ctx
+	e.monitor()
+	output := e.outputs[0]
+
+	// monitor, scope and output changed
+	scope = `
+groups:
+  private:
+    in_scope: [192.168.0.0/16]
+`
+	writeConfig(t, dir, filepath.Join(dir, "b.log"), filepath.Join(dir, "alerts.json"), scope)
+	if err := e.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.monitors[config.Monitor{File: filepath.Join(dir, "b.log"), Type: "dns", Format: "bro"}]; !ok || len(e.monitors) != 1 {
+		t.Fatalf("monitors not reloaded: %v", e.monitors)
+	}
+	if _, ok := e.groups.IsDNSQueryWhitelisted("a.com", net.IPv4(10, 0, 0, 1), nil); ok {
+		t.Fatal("scope groups not reloaded")
+	}
+	if len(e.outputs) != 1 || e.outputs[0] != output {
+		t.Fatal("unchanged output not reused")
+	}
+	if e.config() == cfg || cfg.Inputs.Monitors[0].File != filepath.Join(dir, "a.log") {
+		t.Fatal("running config modified instead of replaced")
+	}
+	if e.config().Inputs.Monitors[0].File != filepath.Join(dir, "b.log") {
+		t.Fatalf("config not reloaded: %v", e.config().Inputs.Monitors)
+	}
+
+	// invalid config keeps the running one
+	if err := os.WriteFile(file, []byte("inputs: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.reload(); err == nil {
+		t.Fatal("expected error of invalid config")
+	}
+
+	// tenants can't be changed without restart
+	scope = `
+groups:
+  private:
+    in_scope: [192.168.0.0/16]
+    engine:
+      api_key: test
+`
+	writeConfig(t, dir, filepath.Join(dir, "b.log"), filepath.Join(dir, "other.json"), scope)
+	if err := e.reload(); err == nil {
+		t.Fatal("expected error of changed tenants")
+	}
+	if e.outputs[0] != output || len(e.monitors) != 1 {
+		t.Fatal("running config changed by rejected reload")
+	}
+}
@@ -0,0 +1,36 @@
+package executor
+
+import (
+	"hash/fnv"
+	"net"
+)
+
+// sampled returns true if event of a type from src ip is kept by sampling
+// of scope groups. Events are identified by src ip and key parts, e.g. dst ip
+// and port, so the same events are always kept. Events of types which analysis
+// is disabled by a group are counted as filtered by the group.
+func (e *Executor) sampled(eventType, input string, srcIP net.IP, key ...string) bool {
+	group, rate := e.groups.SampleRate(eventType, srcIP)
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		eventsFiltered.Inc(eventType, input, group)
+		return false
+	case sampleHash(srcIP, key) < rate:
+		return true
+	}
+	eventsSampledOut.Inc(eventType, input, group)
+	return false
+}
+
+// sampleHash maps src ip and key parts uniformly to [0, 1).
+func sampleHash(srcIP net.IP, key []string) float64 {
+	h := fnv.New64a()
+	h.Write(srcIP.To16())
+	for _, k := range key {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+	}
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
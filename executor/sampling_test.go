@@ -0,0 +1,120 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/ioc"
+	"github.com/alphasoc/nfr/metrics"
+	"github.com/alphasoc/nfr/packet"
+)
+
+func TestSampling(t *testing.T) {
+	gr := groups.New()
+	for _, group := range []*groups.Group{
+		{Name: "servers", SrcIncludes: []string{"10.0.0.0/16"}, SampleRates: map[string]float64{"ip": 0.1}},
+		{Name: "guest", SrcIncludes: []string{"10.1.0.0/16"}, SampleRates: map[string]float64{"ip": 0, "http": 0}},
+	} {
+		if err := gr.Add(group); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Executor{cfg: config.NewDefault(), ctx: context.Background(), groups: gr}
+	e.rejects, _ = newRejectStats(true, "", 0)
+
+	const (
+		input = "sampling-test"
+		n     = 10000
+	)
+	kept := 0
+	for i := 0; i < n; i++ {
+		p := &packet.IPPacket{
+			Timestamp: time.Now(),
+			SrcIP:     net.IPv4(10, 0, byte(i>>8), byte(i)),
+			DstIP:     net.IPv4(8, 8, 8, 8),
+			DstPort:   443,
+			Protocol:  "tcp",
+		}
+		if e.shouldSendIPPacket(p, input) {
+			kept++
+			// sampling is deterministic
+			if !e.shouldSendIPPacket(p, input) {
+				t.Fatalf("packet from %s kept only once", p.SrcIP)
+			}
+		}
+	}
+	if math.Abs(float64(kept)/n-0.1) > 0.02 {
+		t.Errorf("invalid fraction of kept packets - got %d of %d; expected about 10%%", kept, n)
+	}
+
+	// analysis disabled by group
+	p := &packet.IPPacket{Timestamp: time.Now(), SrcIP: net.IPv4(10, 1, 0, 1), DstIP: net.IPv4(8, 8, 8, 8), DstPort: 443, Protocol: "tcp"}
+	if e.shouldSendIPPacket(p, input) {
+		t.Fatal("ip packet of group with disabled ip analysis sent")
+	}
+	dns := &packet.DNSPacket{Timestamp: time.Now(), SrcIP: net.IPv4(10, 1, 0, 1), FQDN: "a.com", RecordType: "A"}
+	if !e.shouldSendDNSPacket(dns, input) {
+		t.Fatal("dns packet of group with enabled dns analysis not sent")
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.DefaultRegistry.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		fmt.Sprintf(`nfr_events_sampled_out_total{type="ip",input="sampling-test",group="servers"} %d`, n-kept),
+		`nfr_events_filtered_total{type="ip",input="sampling-test",group="guest"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("metrics without %s:\n%s", line, buf.String())
+		}
+	}
+}
+
+// alertsWriter records written alerts.
+type alertsWriter struct {
+	events []*alerts.Event
+}
+
+func (w *alertsWriter) Write(event *alerts.Event) error {
+	w.events = append(w.events, event)
+	return nil
+}
+
+func TestIOCSampledOut(t *testing.T) {
+	feed := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(feed, []byte("8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gr := groups.New()
+	if err := gr.Add(&groups.Group{Name: "guest", SrcIncludes: []string{"10.1.0.0/16"}, SampleRates: map[string]float64{"ip": 0}}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioc.NewDetector(ioc.Config{Feeds: []ioc.FeedConfig{{File: feed}}}, gr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &alertsWriter{}
+	d.SetWriter(w)
+
+	e := &Executor{cfg: config.NewDefault(), ctx: context.Background(), groups: gr, ioc: d}
+	e.rejects, _ = newRejectStats(true, "", 0)
+	p := &packet.IPPacket{Timestamp: time.Now(), SrcIP: net.IPv4(10, 1, 0, 1), DstIP: net.IPv4(8, 8, 8, 8), DstPort: 443, Protocol: "tcp"}
+	if e.shouldSendIPPacket(p, "ioc-test") {
+		t.Fatal("ip packet of group with disabled ip analysis sent")
+	}
+	if len(w.events) != 1 {
+		t.Fatalf("got %d ioc alerts of sampled out packet; expected 1", len(w.events))
+	}
+}
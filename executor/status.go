@@ -0,0 +1,260 @@
+package executor
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/metrics"
+	"github.com/alphasoc/nfr/status"
+)
+
+// startHTTP serves metrics and status endpoints.
+// Endpoints with the same listen address share the listener.
+func (e *Executor) startHTTP() {
+	cfg := e.config()
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if cfg.Metrics.Enabled {
+		mux(cfg.Metrics.Listen).Handle(cfg.Metrics.Path, metrics.Handler(e.metrics))
+		log.Infof("serving metrics on %s%s", cfg.Metrics.Listen, cfg.Metrics.Path)
+	}
+	if cfg.Status.Enabled {
+		status.Register(mux(cfg.Status.Listen), e.Status)
+		log.Infof("serving status on %s", cfg.Status.Listen)
+		e.checkKeys()
+	}
+
+	for addr, m := range muxes {
+		l, err := status.Listen(addr)
+		if err != nil {
+			log.Errorf("can't listen on %s: %s", addr, err)
+			continue
+		}
+		go func(addr string, m *http.ServeMux) {
+			if err := http.Serve(l, m); err != nil {
+				log.Errorf("http server on %s failed: %s", addr, err)
+			}
+		}(addr, m)
+	}
+}
+
+// checkKeys checks api keys of all tenants in background,
+// so the status is known before any events are sent.
+func (e *Executor) checkKeys() {
+	for _, t := range e.tenants {
+		go func(t *tenant) {
+			_, err := t.c.AccountStatus(e.ctx)
+			t.recordKey(err)
+		}(t)
+	}
+}
+
+// setFlushed records time the packet sender flushed buffers of event type.
+func (e *Executor) setFlushed(eventType string) {
+	e.mx.Lock()
+	e.flushed[eventType] = time.Now()
+	e.mx.Unlock()
+}
+
+// setSearchError sets error of the last elasticsearch search run.
+func (e *Executor) setSearchError(search string, err error) {
+	e.mx.Lock()
+	if err != nil {
+		e.searchErrs[search] = err
+	} else {
+		delete(e.searchErrs, search)
+	}
+	e.mx.Unlock()
+}
+
+// flushTimeout returns time after which packet sender of events
+// flushed with interval is considered stuck. It allows for retries
+// of requests to AlphaSOC Engine.
+func (e *Executor) flushTimeout(interval time.Duration) time.Duration {
+	cfg := e.config()
+	retry := &cfg.Engine.Retry
+	return 3*interval + time.Duration(retry.MaxRetries+1)*(cfg.Engine.Timeout+retry.MaxInterval)
+}
+
+// Status returns status report of the executor.
+func (e *Executor) Status() *status.Report {
+	cfg := e.config()
+	now := time.Now()
+	r := &status.Report{Time: now, Started: e.started, Live: true}
+	check := func(name string, state status.State, format string, args ...interface{}) {
+		r.Checks = append(r.Checks, status.Check{Name: name, State: state, Message: fmt.Sprintf(format, args...)})
+	}
+	since := func(t time.Time) time.Duration {
+		return now.Sub(t).Round(time.Second)
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+
+	// packet sender is started for analyzed event types of inputs
+	if cfg.HasInputs() {
+		for _, sender := range []struct {
+			eventType string
+			enabled   bool
+			interval  time.Duration
+		}{
+			{"dns", cfg.Engine.Analyze.DNS, cfg.DNSEvents.FlushInterval},
+			{"ip", cfg.Engine.Analyze.IP, cfg.IPEvents.FlushInterval},
+			{"http", cfg.Engine.Analyze.HTTP, cfg.HTTPEvents.FlushInterval},
+		} {
+			if !sender.enabled {
+				continue
+			}
+			last, ok := e.flushed[sender.eventType]
+			if !ok {
+				last = e.started
+			}
+			switch {
+			case now.Sub(last) > e.flushTimeout(sender.interval):
+				r.Live = false
+				check("flush/"+sender.eventType, status.Critical, "%s events not flushed for %s", sender.eventType, since(last))
+			case !ok:
+				check("flush/"+sender.eventType, status.OK, "%s events not flushed yet", sender.eventType)
+			default:
+				check("flush/"+sender.eventType, status.OK, "%s events flushed %s ago", sender.eventType, since(last))
+			}
+		}
+	}
+
+	for _, t := range e.tenants {
+		ts := t.status()
+		r.Tenants = append(r.Tenants, ts)
+		name := func(base string) string {
+			if t.name == "" {
+				return base
+			}
+			return base + "/" + t.name
+		}
+
+		switch {
+		case ts.KeyValid == nil:
+			check(name("api_key"), status.Warning, "api key not verified yet")
+		case *ts.KeyValid:
+			check(name("api_key"), status.OK, "api key valid")
+		default:
+			check(name("api_key"), status.Critical, "api key rejected: %s", ts.KeyError)
+		}
+
+		eventTypes := make([]string, 0, len(ts.LastSend)+len(ts.SendError))
+		for eventType := range ts.LastSend {
+			eventTypes = append(eventTypes, eventType)
+		}
+		for eventType := range ts.SendError {
+			if _, ok := ts.LastSend[eventType]; !ok {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+		sort.Strings(eventTypes)
+		for _, eventType := range eventTypes {
+			if err, ok := ts.SendError[eventType]; ok {
+				check(name("send/"+eventType), status.Warning, "sending %s events failed: %s", eventType, err)
+			} else {
+				check(name("send/"+eventType), status.OK, "%s events sent %s ago", eventType, since(ts.LastSend[eventType]))
+			}
+		}
+
+		if t.poller != nil {
+			switch {
+			case ts.PollError != "":
+				check(name("alerts"), status.Warning, "polling alerts failed: %s", ts.PollError)
+			case ts.LastPoll.IsZero():
+				check(name("alerts"), status.OK, "alerts not polled yet")
+			default:
+				check(name("alerts"), status.OK, "alerts polled %s ago", since(ts.LastPoll))
+			}
+		}
+	}
+
+	if cfg.Inputs.Sniffer.Enabled && (cfg.Engine.Analyze.DNS || cfg.Engine.Analyze.IP) {
+		r.Sniffer = &status.Sniffer{Interface: cfg.Inputs.Sniffer.Interface, Open: e.sniffer != nil}
+		if r.Sniffer.Open {
+			check("sniffer", status.OK, "capturing on %s", r.Sniffer.Interface)
+		} else {
+			check("sniffer", status.Critical, "sniffer on %s not open", r.Sniffer.Interface)
+		}
+	}
+
+	for _, monitor := range cfg.Inputs.Monitors {
+		if monitor.File == "" {
+			continue
+		}
+		m := status.Monitor{File: monitor.File, Type: monitor.Type, Format: monitor.Format}
+		if t, ok := e.tails[monitor.File]; ok {
+			m.Open = true
+			m.Offset, _ = t.Tell()
+			check("monitor:"+monitor.File, status.OK, "read %d bytes", m.Offset)
+		} else if err, ok := e.monitorErrs[monitor.File]; ok {
+			m.Error = err.Error()
+			check("monitor:"+monitor.File, status.Critical, "can't open: %s", err)
+		} else {
+			check("monitor:"+monitor.File, status.Warning, "not monitored yet")
+		}
+		r.Monitors = append(r.Monitors, m)
+	}
+
+	searches := make([]string, 0, len(e.checkpoints))
+	for search := range e.checkpoints {
+		searches = append(searches, search)
+	}
+	sort.Strings(searches)
+	for _, search := range searches {
+		s := status.Search{Name: search, Checkpoint: e.checkpoints[search]}
+		if err, ok := e.searchErrs[search]; ok {
+			s.Error = err.Error()
+			check("elastic/"+search, status.Warning, "search failed: %s", err)
+		} else {
+			check("elastic/"+search, status.OK, "checkpoint %s ago", since(s.Checkpoint))
+		}
+		r.Searches = append(r.Searches, s)
+	}
+
+	r.Ready = r.State() != status.Critical
+	return r
+}
+
+// status returns status of the tenant requests.
+func (t *tenant) status() status.Tenant {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	s := status.Tenant{
+		Name:      t.name,
+		LastSend:  make(map[string]time.Time, len(t.sent)),
+		SendError: make(map[string]string, len(t.sendErr)),
+	}
+	for eventType, sent := range t.sent {
+		s.LastSend[eventType] = sent
+	}
+	for eventType, err := range t.sendErr {
+		s.SendError[eventType] = err.Error()
+	}
+	if t.poller != nil {
+		s.LastPoll = t.poller.LastPoll()
+		if t.pollErr != nil && t.pollErrAt.After(s.LastPoll) {
+			s.PollError = t.pollErr.Error()
+		}
+	}
+
+	if t.keyUsed || !s.LastPoll.IsZero() {
+		valid := t.keyErr == nil
+		s.KeyValid = &valid
+	}
+	if t.keyErr != nil {
+		s.KeyError = t.keyErr.Error()
+	}
+	return s
+}
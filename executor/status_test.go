@@ -0,0 +1,69 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/packet"
+	"github.com/alphasoc/nfr/status"
+)
+
+// authClient rejects api key.
+type authClient struct {
+	client.Client
+}
+
+func (c *authClient) EventsDNS(ctx context.Context, req *client.EventsDNSRequest) (*client.EventsDNSResponse, error) {
+	return nil, &client.Error{Kind: client.ErrorAuth, Message: "invalid api key"}
+}
+
+func TestStatus(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.Inputs.Monitors = []config.Monitor{{File: "/var/log/dns.log", Type: "dns", Format: "bro"}}
+	e := &Executor{
+		cfg:         cfg,
+		ctx:         context.Background(),
+		started:     time.Now(),
+		flushed:     make(map[string]time.Time),
+		monitorErrs: make(map[string]error),
+		searchErrs:  make(map[string]error),
+	}
+	e.tenants = []*tenant{newTenant("", &dnsClient{}), newTenant("acme", &authClient{})}
+	e.tenantsByName = map[string]*tenant{"": e.tenants[0], "acme": e.tenants[1]}
+
+	for _, t := range e.tenants {
+		t.dnsbuf.Write(&packet.DNSPacket{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), FQDN: "a.com"})
+	}
+	e.eachTenant(e.sendDNSPackets)
+
+	r := e.Status()
+	states := make(map[string]status.State)
+	for _, c := range r.Checks {
+		states[c.Name] = c.State
+	}
+	for name, state := range map[string]status.State{
+		"flush/dns":                status.OK,
+		"api_key":                  status.OK,
+		"send/dns":                 status.OK,
+		"api_key/acme":             status.Critical,
+		"send/dns/acme":            status.Warning,
+		"monitor:/var/log/dns.log": status.Warning,
+	} {
+		if states[name] != state {
+			t.Errorf("invalid %s check state - got %s; expected %s", name, states[name], state)
+		}
+	}
+	if !r.Live || r.Ready {
+		t.Fatalf("invalid report live %t, ready %t", r.Live, r.Ready)
+	}
+
+	// stuck packet sender
+	e.started = time.Now().Add(-24 * time.Hour)
+	if r := e.Status(); r.Live {
+		t.Fatal("executor with stuck packet sender reported as live")
+	}
+}
@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/packet"
+)
+
+// tenant keeps client, event buffers and alerts poller of a single
+// AlphaSOC Engine account. The default tenant uses engine configuration,
+// other tenants are defined by scope groups.
+type tenant struct {
+	name   string
+	c      client.Client
+	poller *alerts.Poller
+	log    *log.Entry
+
+	dnsbuf  *packet.DNSPacketBuffer
+	ipbuf   *packet.IPPacketBuffer
+	httpbuf *packet.HTTPPacketBuffer
+
+	// status of the tenant requests, guarded by mx.
+	mx        sync.Mutex
+	keyErr    error
+	keyUsed   bool
+	sent      map[string]time.Time
+	sendErr   map[string]error
+	pollErr   error
+	pollErrAt time.Time
+}
+
+func newTenant(name string, c client.Client) *tenant {
+	t := &tenant{
+		name:    name,
+		c:       c,
+		dnsbuf:  packet.NewDNSPacketBuffer(),
+		ipbuf:   packet.NewIPPacketBuffer(),
+		httpbuf: packet.NewHTTPPacketBuffer(),
+		sent:    make(map[string]time.Time),
+		sendErr: make(map[string]error),
+	}
+	t.log = t.withTenant(log.NewEntry(log.StandardLogger()))
+	return t
+}
+
+// withTenant adds tenant field to the logger, unless it's the default tenant.
+func (t *tenant) withTenant(l *log.Entry) *log.Entry {
+	if t.name == "" {
+		return l
+	}
+	return l.WithField("tenant", t.name)
+}
+
+// recordKey records result of request made with the tenant api key.
+// Only auth errors make the key invalid.
+func (t *tenant) recordKey(err error) {
+	if err != nil && !client.IsAuth(err) {
+		return
+	}
+	t.mx.Lock()
+	t.keyErr, t.keyUsed = err, true
+	t.mx.Unlock()
+}
+
+// recordSend records result of sending events of given type.
+func (t *tenant) recordSend(eventType string, err error) {
+	t.recordKey(err)
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if err != nil {
+		t.sendErr[eventType] = err
+		return
+	}
+	t.sent[eventType] = time.Now()
+	delete(t.sendErr, eventType)
+}
+
+// recordPoll records error of alerts polling.
+func (t *tenant) recordPoll(err error) {
+	t.recordKey(err)
+	t.mx.Lock()
+	t.pollErr, t.pollErrAt = err, time.Now()
+	t.mx.Unlock()
+}
+
+// followFile returns file with follow id of the tenant alerts.
+func (t *tenant) followFile(dataFile string) string {
+	if t.name == "" {
+		return dataFile
+	}
+	return dataFile + "." + t.name
+}
+
+// tenant returns the tenant events from src ip are sent to,
+// based on scope group the ip belongs to.
+func (e *Executor) tenant(srcIP net.IP) *tenant {
+	if t, ok := e.tenantsByName[e.groups.TenantBySrcIP(srcIP)]; ok {
+		return t
+	}
+	return e.tenants[0]
+}
+
+// elasticClient returns client sending the tenant events fetched
+// from elasticsearch, where c is the search's default tenant client.
+func (t *tenant) elasticClient(c client.Client) client.Client {
+	if t.name == "" {
+		return c
+	}
+	return t.c
+}
+
+// eachTenant calls send for all tenants and returns the first error.
+func (e *Executor) eachTenant(send func(*tenant) error) error {
+	var err error
+	for _, t := range e.tenants {
+		if terr := send(t); terr != nil && err == nil {
+			err = terr
+		}
+	}
+	return err
+}
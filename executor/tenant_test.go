@@ -0,0 +1,75 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/packet"
+)
+
+// dnsClient records queries of sent dns events.
+type dnsClient struct {
+	client.Client
+	queries []string
+}
+
+func (c *dnsClient) EventsDNS(ctx context.Context, req *client.EventsDNSRequest) (*client.EventsDNSResponse, error) {
+	for _, entry := range req.Entries {
+		c.queries = append(c.queries, entry.Query)
+	}
+	return &client.EventsDNSResponse{Received: len(req.Entries), Accepted: len(req.Entries)}, nil
+}
+
+func TestTenantRouting(t *testing.T) {
+	gr := groups.New()
+	for _, g := range []*groups.Group{
+		{Name: "default", SrcIncludes: []string{"10.0.0.0/8"}},
+		{Name: "acme", SrcIncludes: []string{"10.1.0.0/16"}, Tenant: "acme"},
+	} {
+		if err := gr.Add(g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	def, acme := &dnsClient{}, &dnsClient{}
+	e := &Executor{
+		cfg:    config.NewDefault(),
+		ctx:    context.Background(),
+		groups: gr,
+	}
+	e.rejects, _ = newRejectStats(false, "", 0)
+	e.tenants = []*tenant{newTenant("", def), newTenant("acme", acme)}
+	e.tenantsByName = map[string]*tenant{"": e.tenants[0], "acme": e.tenants[1]}
+
+	for _, p := range []*packet.DNSPacket{
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1), FQDN: "a.com"},
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 1, 0, 1), FQDN: "b.com"},
+		{Timestamp: time.Now(), SrcIP: net.IPv4(10, 1, 0, 2), FQDN: "c.com"},
+	} {
+		e.tenant(p.SrcIP).dnsbuf.Write(p)
+	}
+	if err := e.eachTenant(e.sendDNSPackets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(def.queries) != 1 || def.queries[0] != "a.com" {
+		t.Fatalf("invalid default tenant events %v", def.queries)
+	}
+	if len(acme.queries) != 2 {
+		t.Fatalf("invalid acme tenant events %v", acme.queries)
+	}
+}
+
+func TestTenantFollowFile(t *testing.T) {
+	if f := newTenant("", nil).followFile("/run/nfr.data"); f != "/run/nfr.data" {
+		t.Fatalf("invalid default tenant follow file %s", f)
+	}
+	if f := newTenant("acme", nil).followFile("/run/nfr.data"); f != "/run/nfr.data.acme" {
+		t.Fatalf("invalid tenant follow file %s", f)
+	}
+}
@@ -3,8 +3,11 @@ package groups
 import (
 	"net"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/matchers"
 )
 
@@ -23,18 +26,52 @@ type Group struct {
 	DstIncludes []string
 	DstExcludes []string
 
-	// only used for dns query whitelist
+	// destination port or port range (e.g. 8000-8080 or 123/udp) and
+	// protocol, only used for ip whitelist. If includes are set, then
+	// events to other ports or of other protocols are excluded.
+	DstPortIncludes  []string
+	DstPortExcludes  []string
+	ProtocolIncludes []string
+	ProtocolExcludes []string
+
+	// only used for dns query whitelist, and for tls whitelist
+	// of server name and certificate subject
 	ExcludedDomains []string
+
+	// only used for http whitelist, url patterns in format
+	// [scheme://]host[:port][/path], e.g. windowsupdate.com/msdownload/
+	ExcludedURLs []string
+
+	// only used for tls whitelist, sha1 fingerprints of server
+	// certificates and ja3 or ja3s hashes
+	ExcludedCertHashes []string
+	ExcludedJA3        []string
+
+	// Tenant is a name of AlphaSOC Engine account the group events
+	// are sent to. Empty tenant is the default account.
+	Tenant string
+
+	// SampleRates are fractions of events in scope, by event type (dns, ip
+	// or http), that are analyzed. Rate 0 disables analysis of the type,
+	// all events of types without rate are analyzed.
+	SampleRates map[string]float64
 }
 
 // matcher type for single group
 type matcher struct {
 	dm *matchers.Domain
 	nm *matchers.Network
+	um *matchers.URL
+
+	certs map[string]bool
+	ja3   map[string]bool
 }
 
 // Groups is a set of group definition used for whitelisting ip and dns traffic.
+// It is safe for concurrent use.
 type Groups struct {
+	mx sync.RWMutex
+
 	ms map[string]matcher
 
 	gs map[string]*Group
@@ -59,16 +96,46 @@ func (g *Groups) Add(group *Group) error {
 	if err != nil {
 		return err
 	}
+	if err := nm.SetPorts(group.DstPortIncludes, group.DstPortExcludes); err != nil {
+		return err
+	}
+	nm.SetProtocols(group.ProtocolIncludes, group.ProtocolExcludes)
 
-	g.ms[group.Name] = matcher{dm, nm}
+	um, err := matchers.NewURL(group.ExcludedURLs)
+	if err != nil {
+		return err
+	}
+
+	g.mx.Lock()
+	g.ms[group.Name] = matcher{dm, nm, um, hashSet(group.ExcludedCertHashes), hashSet(group.ExcludedJA3)}
 	g.gs[group.Name] = group
+	g.mx.Unlock()
 	return nil
 }
 
+// Replace replaces groups with groups of other at once, so the
+// whitelisting never sees a mix of old and new groups.
+func (g *Groups) Replace(other *Groups) {
+	other.mx.RLock()
+	ms, gs := other.ms, other.gs
+	other.mx.RUnlock()
+
+	g.mx.Lock()
+	g.ms, g.gs = ms, gs
+	g.mx.Unlock()
+}
+
 // IsIPWhitelisted returns true if ip packet doesn't match any of a groups.
-func (g *Groups) IsIPWhitelisted(srcIP, dstIP net.IP) (string, bool) {
+// Destination port and protocol are matched as well, 0 and empty if unknown.
+func (g *Groups) IsIPWhitelisted(srcIP, dstIP net.IP, dstPort int, proto string) (string, bool) {
+	if g == nil {
+		return "<no-whitelist>", true
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
 	// if there is no groups, then every query is whitelisted
-	if g == nil || len(g.ms) == 0 {
+	if len(g.ms) == 0 {
 		return "<no-whitelist>", true
 	}
 
@@ -80,7 +147,7 @@ func (g *Groups) IsIPWhitelisted(srcIP, dstIP net.IP) (string, bool) {
 	// being not excluded from others groups.
 	ok := false
 	for name, matcher := range g.ms {
-		matched, excluded := matcher.nm.Match(srcIP, dstIP)
+		matched, excluded := matcher.nm.MatchFlow(srcIP, dstIP, dstPort, proto)
 		if !matched {
 			continue
 		}
@@ -95,8 +162,14 @@ func (g *Groups) IsIPWhitelisted(srcIP, dstIP net.IP) (string, bool) {
 
 // IsDNSQueryWhitelisted returns true if dns query doesn't match any of groups.
 func (g *Groups) IsDNSQueryWhitelisted(domain string, srcIP, dstIP net.IP) (string, bool) {
+	if g == nil {
+		return "<no-whitelist>", true
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
 	// if there is no group, then every query is whitelisted
-	if g == nil || len(g.ms) == 0 {
+	if len(g.ms) == 0 {
 		return "<no-whitelist>", true
 	}
 
@@ -141,8 +214,14 @@ func (g *Groups) IsDNSQueryWhitelisted(domain string, srcIP, dstIP net.IP) (stri
 
 // IsHTTPQueryWhitelisted returns true if dns query doesn't match any of groups.
 func (g *Groups) IsHTTPQueryWhitelisted(url string, srcIP net.IP) (string, bool) {
+	if g == nil {
+		return "<no-whitelist>", true
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
 	// if there is no group, then every query is whitelisted
-	if g == nil || len(g.ms) == 0 {
+	if len(g.ms) == 0 {
 		return "<no-whitelist>", true
 	}
 
@@ -150,10 +229,7 @@ func (g *Groups) IsHTTPQueryWhitelisted(url string, srcIP net.IP) (string, bool)
 		return "<no-data>", false
 	}
 
-	var domain string
-	if p := httpRegexp.FindStringSubmatch(url); p != nil {
-		domain = strings.ToLower(p[2])
-	}
+	domain := URLDomain(url)
 
 	// ip must be included in at least 1 matcher, while
 	// being not excluded from others groups.
@@ -172,10 +248,13 @@ func (g *Groups) IsHTTPQueryWhitelisted(url string, srcIP net.IP) (string, bool)
 			return name, false
 		}
 
-		// ip is matched, now check if domain is not excluded
+		// ip is matched, now check if domain and url are not excluded
 		if domain != "" && matcher.dm.Match(domain) {
 			return name, false
 		}
+		if matcher.um.Match(url) {
+			return name, false
+		}
 
 		// in case of success do not break, because the ip/domain
 		// could be on other lists.
@@ -185,8 +264,158 @@ func (g *Groups) IsHTTPQueryWhitelisted(url string, srcIP net.IP) (string, bool)
 	return "", ok
 }
 
+// IsTLSWhitelisted returns true if tls session doesn't match any of groups.
+// Session is excluded by server name or certificate subject common name in
+// groups excluded domains, or by certificate or ja3/ja3s hash.
+func (g *Groups) IsTLSWhitelisted(entry *client.TLSEntry) (string, bool) {
+	if g == nil {
+		return "<no-whitelist>", true
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	// if there is no group, then every session is whitelisted
+	if len(g.ms) == 0 {
+		return "<no-whitelist>", true
+	}
+
+	if entry.SrcIP == nil || entry.DstIP == nil {
+		return "<no-data>", false
+	}
+
+	session := newTLSSession(entry)
+	ok := false
+	for name, matcher := range g.ms {
+		// tls is always over tcp
+		matched, excluded := matcher.nm.MatchFlow(entry.SrcIP, entry.DstIP, int(entry.DstPort), "tcp")
+		if !matched {
+			continue
+		}
+		if excluded {
+			return name, false
+		}
+
+		// ip is matched, now check if session is not excluded
+		if matcher.excludesTLS(session) {
+			return name, false
+		}
+
+		ok = true
+	}
+
+	return "", ok
+}
+
+// tlsSession keeps normalized names and hashes of tls session.
+type tlsSession struct {
+	serverName, commonName string
+	certHash, ja3, ja3s    string
+}
+
+func newTLSSession(entry *client.TLSEntry) tlsSession {
+	return tlsSession{
+		serverName: strings.ToLower(strings.TrimSuffix(entry.ServerName, ".")),
+		commonName: strings.ToLower(entry.CommonName()),
+		certHash:   normalizeHash(entry.CertHash),
+		ja3:        normalizeHash(entry.JA3),
+		ja3s:       normalizeHash(entry.JA3s),
+	}
+}
+
+// excludesTLS returns true if the session server name or certificate subject
+// is in excluded domains, or its certificate or ja3/ja3s hash is excluded.
+func (m *matcher) excludesTLS(s tlsSession) bool {
+	return m.dm.Match(s.serverName) || m.dm.Match(s.commonName) ||
+		(s.certHash != "" && m.certs[s.certHash]) ||
+		(s.ja3 != "" && m.ja3[s.ja3]) ||
+		(s.ja3s != "" && m.ja3[s.ja3s])
+}
+
+// normalizeHash returns lowercased hex hash with no colons,
+// e.g. 9f:2c:... is 9f2c...
+func normalizeHash(hash string) string {
+	return strings.ToLower(strings.ReplaceAll(hash, ":", ""))
+}
+
+// hashSet returns set of normalized hashes.
+func hashSet(hashes []string) map[string]bool {
+	set := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		set[normalizeHash(hash)] = true
+	}
+	return set
+}
+
+// URLDomain returns lowercased domain of http url.
+func URLDomain(url string) string {
+	if p := httpRegexp.FindStringSubmatch(url); p != nil {
+		return strings.ToLower(p[2])
+	}
+	return ""
+}
+
+// Match explains how an event matched a group.
+type Match struct {
+	Group string
+	// SrcIncluded is true if source ip is in the group included networks,
+	// SrcExcluded if it's in the excluded ones as well.
+	SrcIncluded bool
+	SrcExcluded bool
+	// DstExcluded is true if destination ip is trusted by the group.
+	DstExcluded bool
+	// PortExcluded is true if destination port or protocol is trusted
+	// by the group, or it's not in the group included ones.
+	PortExcluded bool
+	// DomainExcluded is true if domain is trusted by the group.
+	DomainExcluded bool
+	// URLExcluded is true if url is trusted by the group.
+	URLExcluded bool
+	// TLSExcluded is true if tls session is trusted by the group
+	// by server name, certificate subject or hash, or ja3/ja3s hash.
+	TLSExcluded bool
+}
+
+// Explain matches src ip, and dst ip, dst port and protocol, domain, url and
+// tls session if set, against each group. Matches are sorted by group name.
+func (g *Groups) Explain(srcIP, dstIP net.IP, dstPort int, proto, domain, url string, tls *client.TLSEntry) []Match {
+	if g == nil {
+		return nil
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	names := make([]string, 0, len(g.ms))
+	for name := range g.ms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	matches := make([]Match, len(names))
+	for i, name := range names {
+		m := g.ms[name]
+		matches[i].Group = name
+		matches[i].SrcIncluded, matches[i].SrcExcluded = m.nm.MatchSrcIP(srcIP)
+		if dstIP != nil {
+			_, matches[i].DstExcluded = m.nm.MatchDstIP(dstIP)
+		}
+		if dstPort != 0 || proto != "" {
+			matches[i].PortExcluded = m.nm.ExcludesPort(dstPort, proto)
+		}
+		if domain != "" {
+			matches[i].DomainExcluded = m.dm.Match(strings.ToLower(domain))
+		}
+		matches[i].URLExcluded = m.um.Match(url)
+		if tls != nil {
+			matches[i].TLSExcluded = m.excludesTLS(newTLSSession(tls))
+		}
+	}
+	return matches
+}
+
 // FindGroupsBySrcIP finds first group src ip belongs to.
 func (g *Groups) FindGroupsBySrcIP(srcIP net.IP) (groups []*Group) {
+	g.mx.RLock()
+	defer g.mx.RUnlock()
 	for name, matcher := range g.ms {
 		if matched, excluded := matcher.nm.MatchSrcIP(srcIP); matched && !excluded {
 			groups = append(groups, g.gs[name])
@@ -194,3 +423,55 @@ func (g *Groups) FindGroupsBySrcIP(srcIP net.IP) (groups []*Group) {
 	}
 	return
 }
+
+// SampleRate returns the fraction of events of a type from src ip that
+// are analyzed, and the group setting it. If the ip belongs to more groups,
+// then the lowest rate is returned, so analysis disabled by any group
+// is not enabled by other one. Rate 1 and empty group are returned
+// if no group samples the events.
+func (g *Groups) SampleRate(eventType string, srcIP net.IP) (string, float64) {
+	if g == nil || srcIP == nil {
+		return "", 1
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	group, rate := "", 1.0
+	for name, matcher := range g.ms {
+		r, ok := g.gs[name].SampleRates[eventType]
+		if !ok || r > rate || (r == rate && group != "" && name > group) {
+			continue
+		}
+		if matched, excluded := matcher.nm.MatchSrcIP(srcIP); matched && !excluded {
+			group, rate = name, r
+		}
+	}
+	return group, rate
+}
+
+// TenantBySrcIP returns tenant of events with given src ip. If the ip
+// belongs to more groups with a tenant, then the tenant of the group
+// with the first name in alphabetical order is returned, so events
+// of an ip are always routed to the same tenant.
+func (g *Groups) TenantBySrcIP(srcIP net.IP) string {
+	if g == nil || srcIP == nil {
+		return ""
+	}
+	g.mx.RLock()
+	defer g.mx.RUnlock()
+
+	var names []string
+	for name, matcher := range g.ms {
+		if g.gs[name].Tenant == "" {
+			continue
+		}
+		if matched, excluded := matcher.nm.MatchSrcIP(srcIP); matched && !excluded {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return g.gs[names[0]].Tenant
+}
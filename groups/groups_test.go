@@ -3,6 +3,8 @@ package groups
 import (
 	"net"
 	"testing"
+
+	"github.com/alphasoc/nfr/client"
 )
 
 func TestIsDNSQueryWhitelisted(t *testing.T) {
@@ -186,13 +188,91 @@ func TestIsIPWhitelisted(t *testing.T) {
 			}
 		}
 		for i := range tt.srcIps {
-			if _, b := g.IsIPWhitelisted(tt.srcIps[i], tt.dstIps[i]); b != tt.expected[i] {
+			if _, b := g.IsIPWhitelisted(tt.srcIps[i], tt.dstIps[i], 0, ""); b != tt.expected[i] {
 				t.Fatalf("IsIPWhitelisted(%s, %s) got %t; expected %t", tt.srcIps[i], tt.dstIps[i], b, tt.expected[i])
 			}
 		}
 	}
 }
 
+func TestIsIPWhitelistedPorts(t *testing.T) {
+	g := New()
+	for _, group := range []*Group{
+		{
+			Name:            "private",
+			SrcIncludes:     []string{"10.0.0.0/8"},
+			DstPortExcludes: []string{"123/udp", "161-162/udp"},
+		},
+		{
+			Name:             "guest",
+			SrcIncludes:      []string{"10.1.0.0/16"},
+			DstPortIncludes:  []string{"53", "80", "443"},
+			ProtocolIncludes: []string{"tcp", "udp"},
+		},
+	} {
+		if err := g.Add(group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		src      net.IP
+		port     int
+		proto    string
+		expected bool
+	}{
+		{net.IPv4(10, 0, 0, 1), 22, "tcp", true},
+		{net.IPv4(10, 0, 0, 1), 123, "udp", false},
+		{net.IPv4(10, 0, 0, 1), 123, "tcp", true},
+		{net.IPv4(10, 0, 0, 1), 162, "udp", false},
+		{net.IPv4(10, 1, 0, 1), 443, "tcp", true},
+		{net.IPv4(10, 1, 0, 1), 22, "tcp", false},
+		{net.IPv4(10, 1, 0, 1), 0, "icmp", false},
+		// excluded by other group
+		{net.IPv4(10, 1, 0, 1), 123, "udp", false},
+	} {
+		if _, ok := g.IsIPWhitelisted(tt.src, net.IPv4(8, 8, 8, 8), tt.port, tt.proto); ok != tt.expected {
+			t.Errorf("IsIPWhitelisted(%s, 8.8.8.8, %d, %s) got %t; expected %t", tt.src, tt.port, tt.proto, ok, tt.expected)
+		}
+	}
+}
+
+func TestIsTLSWhitelisted(t *testing.T) {
+	g := New()
+	if err := g.Add(&Group{
+		Name:               "private",
+		SrcIncludes:        []string{"10.0.0.0/8"},
+		DstIncludes:        []string{"0.0.0.0/0"},
+		DstExcludes:        []string{"10.0.0.0/8"},
+		ExcludedDomains:    []string{"*.corp.example.com"},
+		ExcludedCertHashes: []string{"2F:D4:E1:C6:7A:2D:28:FC:ED:84:9E:E1:BB:76:E7:39:1B:93:EB:12"},
+		ExcludedJA3:        []string{"e7d705a3286e19ea42f587b344ee6865"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	src, dst := net.IPv4(10, 0, 0, 1), net.IPv4(8, 8, 8, 8)
+	for _, tt := range []struct {
+		name     string
+		entry    client.TLSEntry
+		expected bool
+	}{
+		{"in scope", client.TLSEntry{SrcIP: src, DstIP: dst, ServerName: "example.com", Subject: "CN=example.com,O=Example"}, true},
+		{"trusted dst ip", client.TLSEntry{SrcIP: src, DstIP: net.IPv4(10, 0, 0, 2)}, false},
+		{"no dst ip", client.TLSEntry{SrcIP: src}, false},
+		{"trusted server name", client.TLSEntry{SrcIP: src, DstIP: dst, ServerName: "Agent.Corp.Example.com"}, false},
+		{"trusted subject", client.TLSEntry{SrcIP: src, DstIP: dst, Subject: "O=Example, CN=agent.corp.example.com"}, false},
+		{"trusted cert", client.TLSEntry{SrcIP: src, DstIP: dst, CertHash: "2fd4e1c67a2d28fced849ee1bb76e7391b93eb12"}, false},
+		{"trusted ja3", client.TLSEntry{SrcIP: src, DstIP: dst, JA3: "E7D705A3286E19EA42F587B344EE6865"}, false},
+		{"trusted ja3s", client.TLSEntry{SrcIP: src, DstIP: dst, JA3s: "e7d705a3286e19ea42f587b344ee6865"}, false},
+		{"out of scope", client.TLSEntry{SrcIP: net.IPv4(11, 0, 0, 1), DstIP: dst}, false},
+	} {
+		if _, ok := g.IsTLSWhitelisted(&tt.entry); ok != tt.expected {
+			t.Errorf("%s: IsTLSWhitelisted got %t; expected %t", tt.name, ok, tt.expected)
+		}
+	}
+}
+
 func TestIsHTTPQueryWhitelisted(t *testing.T) {
 	var testsGroups = []struct {
 		name   string
@@ -220,6 +300,19 @@ func TestIsHTTPQueryWhitelisted(t *testing.T) {
 			[]net.IP{net.IPv4(10, 0, 0, 0), net.IPv4(10, 0, 0, 0), net.IPv4(10, 1, 0, 0), net.IPv4(10, 1, 0, 0)},
 			[]bool{false, true, true, false},
 		},
+		{
+			"exclude url",
+			[]*Group{
+				{
+					Name:         "private network",
+					SrcIncludes:  []string{"10.0.0.0/16"},
+					ExcludedURLs: []string{"*.windowsupdate.com/msdownload/", "https://example.com/*.js"},
+				},
+			},
+			[]string{"http://download.windowsupdate.com/msdownload/update/x.cab", "http://download.windowsupdate.com/other", "https://example.com/a/b.js", "http://example.com/a/b.js"},
+			[]net.IP{net.IPv4(10, 0, 0, 0), net.IPv4(10, 0, 0, 0), net.IPv4(10, 0, 0, 0), net.IPv4(10, 0, 0, 0)},
+			[]bool{false, true, false, true},
+		},
 	}
 
 	for _, tt := range testsGroups {
@@ -248,3 +341,118 @@ func TestEmptyGroup(t *testing.T) {
 		t.Fatalf("no groups must whitelist domain")
 	}
 }
+
+func TestTenantBySrcIP(t *testing.T) {
+	g := New()
+	for _, group := range []*Group{
+		{Name: "default", SrcIncludes: []string{"10.0.0.0/8"}},
+		{Name: "b", SrcIncludes: []string{"10.1.0.0/16"}, Tenant: "beta"},
+		{Name: "a", SrcIncludes: []string{"10.1.2.0/24"}, Tenant: "alpha"},
+		{Name: "c", SrcIncludes: []string{"10.2.0.0/16"}, SrcExcludes: []string{"10.2.3.0/24"}, Tenant: "gamma"},
+	} {
+		if err := g.Add(group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		ip     net.IP
+		tenant string
+	}{
+		{net.IPv4(10, 0, 0, 1), ""},
+		{net.IPv4(10, 1, 0, 1), "beta"},
+		{net.IPv4(10, 1, 2, 1), "alpha"},
+		{net.IPv4(10, 2, 0, 1), "gamma"},
+		{net.IPv4(10, 2, 3, 1), ""},
+		{net.IPv4(11, 0, 0, 1), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if tenant := g.TenantBySrcIP(tt.ip); tenant != tt.tenant {
+			t.Errorf("TenantBySrcIP(%s) = %q; expected %q", tt.ip, tenant, tt.tenant)
+		}
+	}
+
+	var empty *Groups
+	if tenant := empty.TenantBySrcIP(net.IPv4(10, 1, 0, 1)); tenant != "" {
+		t.Errorf("nil groups TenantBySrcIP = %q; expected empty tenant", tenant)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	g := New()
+	if err := g.Add(&Group{Name: "a", SrcIncludes: []string{"10.0.0.0/8"}, DstIncludes: []string{"0.0.0.0/0"}}); err != nil {
+		t.Fatal(err)
+	}
+	other := New()
+	if err := other.Add(&Group{Name: "b", SrcIncludes: []string{"192.168.0.0/16"}, DstIncludes: []string{"0.0.0.0/0"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	g.Replace(other)
+	if _, ok := g.IsIPWhitelisted(net.IPv4(10, 0, 0, 1), net.IPv4(8, 8, 8, 8), 0, ""); ok {
+		t.Fatal("ip of replaced group whitelisted")
+	}
+	if _, ok := g.IsIPWhitelisted(net.IPv4(192, 168, 0, 1), net.IPv4(8, 8, 8, 8), 0, ""); !ok {
+		t.Fatal("ip of new group not whitelisted")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	g := New()
+	for _, group := range []*Group{
+		{Name: "b", SrcIncludes: []string{"10.0.0.0/8"}, SrcExcludes: []string{"10.0.0.1"}},
+		{Name: "a", SrcIncludes: []string{"10.0.0.0/8"}, DstExcludes: []string{"8.8.8.8"}, ExcludedDomains: []string{"*.lan"}, ExcludedURLs: []string{"host.lan/index.html"},
+			ExcludedJA3: []string{"e7d705a3286e19ea42f587b344ee6865"}},
+	} {
+		if err := g.Add(group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches := g.Explain(net.IPv4(10, 0, 0, 1), net.IPv4(8, 8, 8, 8), 0, "", "Host.LAN", "http://host.lan/index.html",
+		&client.TLSEntry{JA3: "e7d705a3286e19ea42f587b344ee6865"})
+	expected := []Match{
+		{Group: "a", SrcIncluded: true, DstExcluded: true, DomainExcluded: true, URLExcluded: true, TLSExcluded: true},
+		{Group: "b", SrcIncluded: true, SrcExcluded: true},
+	}
+	if len(matches) != len(expected) {
+		t.Fatalf("got %d matches; expected %d", len(matches), len(expected))
+	}
+	for i := range expected {
+		if matches[i] != expected[i] {
+			t.Errorf("invalid match - got %+v; expected %+v", matches[i], expected[i])
+		}
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	g := New()
+	for _, group := range []*Group{
+		{Name: "private", SrcIncludes: []string{"10.0.0.0/8"}, SampleRates: map[string]float64{"ip": 0.5}},
+		{Name: "servers", SrcIncludes: []string{"10.2.0.0/16"}, SampleRates: map[string]float64{"ip": 0.1}},
+		{Name: "guest", SrcIncludes: []string{"10.1.0.0/16"}, SampleRates: map[string]float64{"ip": 0, "http": 0}},
+	} {
+		if err := g.Add(group); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		eventType string
+		src       net.IP
+		group     string
+		rate      float64
+	}{
+		{"dns", net.IPv4(10, 1, 0, 1), "", 1},
+		{"ip", net.IPv4(10, 0, 0, 1), "private", 0.5},
+		{"ip", net.IPv4(10, 2, 0, 1), "servers", 0.1},
+		{"ip", net.IPv4(10, 1, 0, 1), "guest", 0},
+		{"ip", net.IPv4(192, 168, 0, 1), "", 1},
+	} {
+		group, rate := g.SampleRate(tt.eventType, tt.src)
+		if group != tt.group || rate != tt.rate {
+			t.Errorf("SampleRate(%s, %s) got %s, %g; expected %s, %g", tt.eventType, tt.src, group, rate, tt.group, tt.rate)
+		}
+	}
+}
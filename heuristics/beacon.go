@@ -0,0 +1,340 @@
+package heuristics
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/groups"
+)
+
+// ThreatBeaconing is a threat ID of alerts raised by beacon detector.
+const ThreatBeaconing = "local_beaconing"
+
+// maxBeaconEvents is a number of the most recent connections kept per flow.
+const maxBeaconEvents = 64
+
+// BeaconConfig keeps beacon detector windows and thresholds.
+type BeaconConfig struct {
+	// Sliding window of connections evaluated per flow.
+	Window time.Duration
+
+	// Packets of a flow closer than this are coalesced into one connection.
+	Coalesce time.Duration
+
+	// Minimum number of connections within window and minimum median
+	// interval between them before flow is evaluated.
+	MinEvents   int
+	MinInterval time.Duration
+
+	// Maximum jitter (median absolute deviation of intervals relative to
+	// the median interval) and minimum beaconing score (0-1) of an alert.
+	MaxJitter float64
+	MinScore  float64
+
+	// Maximum number of tracked flows.
+	MaxFlows int
+
+	// Severity of raised alerts.
+	Severity int
+}
+
+// connection is a burst of packets of the flow.
+type connection struct {
+	start time.Time
+	last  time.Time
+	bytes int
+}
+
+// flow keeps recent connections from source to destination.
+type flow struct {
+	srcIP   net.IP
+	dstIP   net.IP
+	dstPort int
+	proto   string
+	domain  string
+	conns   []connection
+	alerted time.Time
+}
+
+// BeaconResult describes beaconing scores of a flow.
+type BeaconResult struct {
+	Events      int
+	Interval    time.Duration
+	Jitter      float64
+	Periodicity float64
+	Regularity  float64
+	Score       float64
+}
+
+// BeaconDetector looks for periodic connections from a source
+// to destination and raises alerts on likely beaconing.
+type BeaconDetector struct {
+	cfg    BeaconConfig
+	groups *groups.Groups
+	writer alerts.Writer
+
+	mx      sync.Mutex
+	flows   map[string]*flow
+	domains map[string]string // ip -> domain from dns answers
+}
+
+// NewBeaconDetector creates new beacon detector. Destinations
+// trusted by scope groups are never reported.
+func NewBeaconDetector(cfg BeaconConfig, groups *groups.Groups) (*BeaconDetector, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("beacon window must be positive")
+	}
+	if cfg.MinEvents < 3 {
+		return nil, fmt.Errorf("beacon min events must be at least 3")
+	}
+	if cfg.MaxFlows <= 0 {
+		cfg.MaxFlows = 100000
+	}
+	return &BeaconDetector{
+		cfg:     cfg,
+		groups:  groups,
+		flows:   make(map[string]*flow),
+		domains: make(map[string]string),
+	}, nil
+}
+
+// SetWriter sets writer of alerts raised by detector.
+func (d *BeaconDetector) SetWriter(w alerts.Writer) {
+	d.writer = w
+}
+
+// ObserveDNS remembers domain the addresses were resolved from,
+// so flows to the addresses are keyed by the domain.
+func (d *BeaconDetector) ObserveDNS(domain string, ips []net.IP) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	for _, ip := range ips {
+		if len(d.domains) >= d.cfg.MaxFlows {
+			// drop all mappings rather than tracking their age
+			d.domains = make(map[string]string)
+		}
+		d.domains[ip.String()] = domain
+	}
+}
+
+// Observe adds packet or connection of given size to the flow
+// from source to destination and evaluates the flow.
+func (d *BeaconDetector) Observe(ts time.Time, srcIP net.IP, dstIP net.IP, dstPort int, proto string, bytes int) {
+	if srcIP == nil || dstIP == nil {
+		return
+	}
+
+	d.mx.Lock()
+	domain := d.domains[dstIP.String()]
+	dst := net.JoinHostPort(dstIP.String(), strconv.Itoa(dstPort))
+	if domain != "" {
+		dst = net.JoinHostPort(domain, strconv.Itoa(dstPort))
+	}
+	key := srcIP.String() + "|" + proto + "|" + dst
+
+	f, ok := d.flows[key]
+	if !ok {
+		if len(d.flows) >= d.cfg.MaxFlows {
+			d.expire(ts)
+		}
+		if len(d.flows) >= d.cfg.MaxFlows {
+			d.mx.Unlock()
+			return
+		}
+		f = &flow{srcIP: srcIP, dstIP: dstIP, dstPort: dstPort, proto: proto, domain: domain}
+		d.flows[key] = f
+	}
+
+	if n := len(f.conns); n > 0 && ts.Sub(f.conns[n-1].last) < d.cfg.Coalesce {
+		f.conns[n-1].last = ts
+		f.conns[n-1].bytes += bytes
+		d.mx.Unlock()
+		return
+	}
+
+	// a new connection starts, so evaluate the previous, already complete
+	// connections. The flow is reported at most once per window.
+	var result *BeaconResult
+	if ts.Sub(f.alerted) > d.cfg.Window {
+		result = d.evaluate(f, ts)
+		if result != nil {
+			f.alerted = ts
+		}
+	}
+	f.conns = append(f.conns, connection{start: ts, last: ts, bytes: bytes})
+	if len(f.conns) > maxBeaconEvents {
+		f.conns = f.conns[len(f.conns)-maxBeaconEvents:]
+	}
+	d.mx.Unlock()
+
+	if result != nil {
+		d.emit(f, result, ts)
+	}
+}
+
+// Len returns number of tracked flows.
+func (d *BeaconDetector) Len() int {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	return len(d.flows)
+}
+
+// expire removes flows without connections within window.
+func (d *BeaconDetector) expire(now time.Time) {
+	for key, f := range d.flows {
+		if now.Sub(f.conns[len(f.conns)-1].last) > d.cfg.Window {
+			delete(d.flows, key)
+		}
+	}
+}
+
+// evaluate returns beaconing result if the flow connections
+// within window are likely beaconing.
+func (d *BeaconDetector) evaluate(f *flow, now time.Time) *BeaconResult {
+	var conns []connection
+	for _, c := range f.conns {
+		if now.Sub(c.start) <= d.cfg.Window {
+			conns = append(conns, c)
+		}
+	}
+	if len(conns) < d.cfg.MinEvents {
+		return nil
+	}
+
+	r := beaconScore(conns, d.cfg.MaxJitter)
+	if r.Interval < d.cfg.MinInterval || r.Jitter > d.cfg.MaxJitter || r.Score < d.cfg.MinScore {
+		return nil
+	}
+	return r
+}
+
+// beaconScore computes beaconing scores of connections sorted by time.
+// Periodicity is a ratio of intervals within tolerance of the median interval.
+func beaconScore(conns []connection, tolerance float64) *BeaconResult {
+	intervals := make([]float64, len(conns)-1)
+	for i := 1; i < len(conns); i++ {
+		intervals[i-1] = conns[i].start.Sub(conns[i-1].start).Seconds()
+	}
+	sizes := make([]float64, len(conns))
+	for i := range conns {
+		sizes[i] = float64(conns[i].bytes)
+	}
+
+	r := &BeaconResult{Events: len(conns)}
+	m := median(intervals)
+	if m <= 0 {
+		return r
+	}
+	r.Interval = time.Duration(m * float64(time.Second))
+
+	deviations := make([]float64, len(intervals))
+	within := 0
+	for i, v := range intervals {
+		deviations[i] = math.Abs(v - m)
+		if deviations[i] <= tolerance*m {
+			within++
+		}
+	}
+	r.Jitter = median(deviations) / m
+	r.Periodicity = float64(within) / float64(len(intervals))
+
+	if mean, sd := meanStddev(sizes); mean > 0 {
+		r.Regularity = math.Max(0, 1-sd/mean)
+	}
+	r.Score = (2*r.Periodicity + r.Regularity) / 3
+	return r
+}
+
+// emit writes alert to writers unless destination is trusted by scope groups.
+func (d *BeaconDetector) emit(f *flow, r *BeaconResult, ts time.Time) {
+	var groups []alerts.Group
+	if d.groups != nil {
+		if name, ok := d.groups.IsIPWhitelisted(f.srcIP, f.dstIP, f.dstPort, f.proto); !ok {
+			log.Debugf("beaconing from %s to %s excluded by %s group", f.srcIP, f.dstIP, name)
+			return
+		}
+		if f.domain != "" {
+			if name, ok := d.groups.IsDNSQueryWhitelisted(f.domain, f.srcIP, nil); !ok {
+				log.Debugf("beaconing from %s to %s excluded by %s group", f.srcIP, f.domain, name)
+				return
+			}
+		}
+		for _, g := range d.groups.FindGroupsBySrcIP(f.srcIP) {
+			groups = append(groups, alerts.Group{Label: g.Name, Description: g.Label})
+		}
+	}
+
+	dst := f.dstIP.String()
+	if f.domain != "" {
+		dst = f.domain
+	}
+	reasons := []string{
+		fmt.Sprintf("%d connections every %s", r.Events, r.Interval.Round(time.Second)),
+		fmt.Sprintf("jitter %.2f", r.Jitter),
+		fmt.Sprintf("periodicity %.2f", r.Periodicity),
+		fmt.Sprintf("byte size regularity %.2f", r.Regularity),
+		fmt.Sprintf("score %.2f", r.Score),
+	}
+
+	ev := &alerts.Event{
+		EventType: "ip",
+		Severity:  d.cfg.Severity,
+		Threats: map[string]alerts.Threat{
+			ThreatBeaconing: {
+				Severity:    d.cfg.Severity,
+				Description: "Possible beaconing to " + dst + ": " + strings.Join(reasons, ", "),
+			},
+		},
+		Flags:  []string{"local_heuristics"},
+		Labels: reasons,
+		Groups: groups,
+	}
+	ev.Timestamp = ts
+	ev.SrcIP = f.srcIP
+	ev.DestIP = f.dstIP
+	ev.DestPort = uint16(f.dstPort)
+	ev.Proto = f.proto
+
+	if d.writer == nil {
+		return
+	}
+	if err := d.writer.Write(ev); err != nil {
+		log.Errorf("writing beaconing alert failed: %s", err)
+	}
+}
+
+func median(v []float64) float64 {
+	if len(v) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+func meanStddev(v []float64) (mean, sd float64) {
+	if len(v) == 0 {
+		return 0, 0
+	}
+	for _, x := range v {
+		mean += x
+	}
+	mean /= float64(len(v))
+	for _, x := range v {
+		sd += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sd / float64(len(v)))
+}
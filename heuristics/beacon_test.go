@@ -0,0 +1,105 @@
+package heuristics
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/groups"
+)
+
+func testBeaconConfig() BeaconConfig {
+	return BeaconConfig{
+		Window:      6 * time.Hour,
+		Coalesce:    5 * time.Second,
+		MinEvents:   8,
+		MinInterval: 10 * time.Second,
+		MaxJitter:   0.1,
+		MinScore:    0.8,
+		Severity:    3,
+	}
+}
+
+func TestBeaconDetector(t *testing.T) {
+	d, err := NewBeaconDetector(testBeaconConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWriter{}
+	d.SetWriter(w)
+
+	src, c2, web := net.IPv4(10, 0, 0, 1), net.IPv4(1, 2, 3, 4), net.IPv4(5, 6, 7, 8)
+	d.ObserveDNS("c2.example.com.", []net.IP{c2})
+
+	ts := time.Unix(1536242944, 0)
+	jitter := []time.Duration{0, 2, -1, 3, -2, 1, 0, -3, 2, 1}
+	for i, j := range jitter {
+		// beacon every minute with small jitter, each beacon has two packets
+		at := ts.Add(time.Duration(i)*time.Minute + j*time.Second)
+		d.Observe(at, src, c2, 443, "tcp", 300)
+		d.Observe(at.Add(time.Second), src, c2, 443, "tcp", 200)
+
+		// irregular browsing
+		d.Observe(ts.Add(time.Duration(i*i*i)*time.Second*7), src, web, 443, "tcp", 1000*(i+1))
+	}
+
+	if len(w.events) != 1 {
+		t.Fatalf("invalid number of alerts - got %d; expected %d", len(w.events), 1)
+	}
+	ev := w.events[0]
+	threat, ok := ev.Threats[ThreatBeaconing]
+	if !ok || !ev.DestIP.Equal(c2) || ev.DestPort != 443 || ev.Query != "" {
+		t.Fatalf("invalid alert %+v", ev)
+	}
+	if !strings.Contains(threat.Description, "Possible beaconing to c2.example.com") ||
+		!strings.Contains(threat.Description, "8 connections every 59s") {
+		t.Fatalf("invalid alert description %q", threat.Description)
+	}
+}
+
+func TestBeaconDetectorTrusted(t *testing.T) {
+	g := groups.New()
+	if err := g.Add(&groups.Group{
+		Name:            "default",
+		SrcIncludes:     []string{"10.0.0.0/8"},
+		ExcludedDomains: []string{"*.windowsupdate.com"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewBeaconDetector(testBeaconConfig(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWriter{}
+	d.SetWriter(w)
+
+	src, dst := net.IPv4(10, 0, 0, 1), net.IPv4(1, 2, 3, 4)
+	d.ObserveDNS("update.windowsupdate.com", []net.IP{dst})
+	ts := time.Unix(1536242944, 0)
+	for i := 0; i < 10; i++ {
+		d.Observe(ts.Add(time.Duration(i)*time.Minute), src, dst, 443, "tcp", 300)
+	}
+	if len(w.events) != 0 {
+		t.Fatal("beaconing to trusted domain must not be reported")
+	}
+}
+
+func TestBeaconScore(t *testing.T) {
+	ts := time.Unix(1536242944, 0)
+	var conns []connection
+	for i := 0; i < 10; i++ {
+		conns = append(conns, connection{start: ts.Add(time.Duration(i) * 30 * time.Second), bytes: 100})
+	}
+	// one missed beacon
+	conns = append(conns, connection{start: ts.Add(330 * time.Second), bytes: 100})
+
+	r := beaconScore(conns, 0.1)
+	if r.Interval != 30*time.Second || r.Jitter != 0 || r.Regularity != 1 {
+		t.Fatalf("invalid beacon result %+v", r)
+	}
+	if r.Periodicity != 0.9 {
+		t.Fatalf("invalid periodicity - got %f; expected %f", r.Periodicity, 0.9)
+	}
+}
@@ -0,0 +1,313 @@
+// Package heuristics implements local detection of suspicious network
+// activity, used when the Engine is unreachable or for air-gapped sites.
+package heuristics
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/groups"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Threat IDs of alerts raised by dns heuristics.
+const (
+	ThreatDNSTunneling = "local_dns_tunneling"
+	ThreatDGA          = "local_dga"
+)
+
+// maxSubdomains limits number of unique subdomains tracked per domain.
+const maxSubdomains = 4096
+
+// DNSConfig keeps dns heuristics windows and thresholds.
+type DNSConfig struct {
+	// Statistics are evaluated and reset in windows of this length.
+	Window time.Duration
+
+	// Minimum number of queries from source to domain within
+	// a window before tunneling heuristics are evaluated.
+	MinQueries int
+
+	// Tunneling thresholds for queries from source to registered domain:
+	// average shannon entropy of subdomain labels, number of unique subdomains,
+	// average query length and ratio of TXT and NULL queries.
+	Entropy     float64
+	Subdomains  int
+	QueryLength int
+	TXTRatio    float64
+
+	// Number of crossed tunneling thresholds required to raise an alert.
+	MinSignals int
+
+	// DGA thresholds for responses to a source: minimum number of responses,
+	// ratio of NXDOMAIN responses and number of distinct NXDOMAIN domains.
+	MinResponses    int
+	NXDomainRatio   float64
+	NXDomainDomains int
+
+	// Severity of raised alerts.
+	Severity int
+}
+
+// domainStats keeps statistics of queries from source to registered domain.
+type domainStats struct {
+	queries    int
+	txt        int
+	length     int
+	entropy    float64
+	subdomains map[string]bool
+	lastQuery  string
+	lastType   string
+	alerted    bool
+}
+
+// sourceStats keeps statistics of responses to a source.
+type sourceStats struct {
+	responses int
+	nxdomain  int
+	nxdomains map[string]bool
+	entropy   float64
+	lastQuery string
+	alerted   bool
+}
+
+// DNSDetector tracks dns statistics per source and registered domain
+// and raises alerts on dns tunneling and domain generation algorithms.
+type DNSDetector struct {
+	cfg    DNSConfig
+	groups *groups.Groups
+	writer alerts.Writer
+
+	mx      sync.Mutex
+	start   time.Time
+	domains map[string]*domainStats
+	sources map[string]*sourceStats
+	now     func() time.Time
+}
+
+// NewDNSDetector creates new dns heuristics detector.
+func NewDNSDetector(cfg DNSConfig, groups *groups.Groups) (*DNSDetector, error) {
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("dns heuristics window must be positive")
+	}
+	if cfg.MinSignals <= 0 {
+		cfg.MinSignals = 1
+	}
+	return &DNSDetector{
+		cfg:     cfg,
+		groups:  groups,
+		domains: make(map[string]*domainStats),
+		sources: make(map[string]*sourceStats),
+		now:     time.Now,
+	}, nil
+}
+
+// SetWriter sets writer of alerts raised by detector.
+func (d *DNSDetector) SetWriter(w alerts.Writer) {
+	d.writer = w
+}
+
+// ObserveQuery adds dns query to statistics.
+func (d *DNSDetector) ObserveQuery(ts time.Time, srcIP net.IP, query, qtype string) {
+	query = strings.ToLower(strings.TrimSuffix(query, "."))
+	domain, subdomain := splitDomain(query)
+	if domain == "" || srcIP == nil {
+		return
+	}
+
+	d.mx.Lock()
+	d.rotate()
+	key := srcIP.String() + "|" + domain
+	s, ok := d.domains[key]
+	if !ok {
+		s = &domainStats{subdomains: make(map[string]bool)}
+		d.domains[key] = s
+	}
+
+	s.queries++
+	s.length += len(query)
+	s.entropy += entropy(strings.Replace(subdomain, ".", "", -1))
+	if qtype == "TXT" || qtype == "NULL" {
+		s.txt++
+	}
+	if subdomain != "" && len(s.subdomains) < maxSubdomains {
+		s.subdomains[subdomain] = true
+	}
+	s.lastQuery, s.lastType = query, qtype
+
+	var reasons []string
+	if !s.alerted && s.queries >= d.cfg.MinQueries {
+		reasons = d.tunnelingReasons(s)
+		if len(reasons) >= d.cfg.MinSignals {
+			s.alerted = true
+		} else {
+			reasons = nil
+		}
+	}
+	d.mx.Unlock()
+
+	if len(reasons) > 0 {
+		d.emit(ThreatDNSTunneling, "Possible DNS tunneling to "+domain, reasons, ts, srcIP, domain, qtype)
+	}
+}
+
+// ObserveResponse adds dns response to statistics.
+func (d *DNSDetector) ObserveResponse(ts time.Time, clientIP net.IP, query string, nxdomain bool) {
+	query = strings.ToLower(strings.TrimSuffix(query, "."))
+	domain, _ := splitDomain(query)
+	if domain == "" || clientIP == nil {
+		return
+	}
+
+	d.mx.Lock()
+	d.rotate()
+	key := clientIP.String()
+	s, ok := d.sources[key]
+	if !ok {
+		s = &sourceStats{nxdomains: make(map[string]bool)}
+		d.sources[key] = s
+	}
+
+	s.responses++
+	if nxdomain {
+		s.nxdomain++
+		if !s.nxdomains[domain] && len(s.nxdomains) < maxSubdomains {
+			s.nxdomains[domain] = true
+			s.entropy += entropy(strings.SplitN(domain, ".", 2)[0])
+		}
+		s.lastQuery = query
+	}
+
+	var reasons []string
+	if !s.alerted && s.responses >= d.cfg.MinResponses {
+		reasons = d.dgaReasons(s)
+		if len(reasons) > 0 {
+			s.alerted = true
+		}
+	}
+	lastQuery := s.lastQuery
+	d.mx.Unlock()
+
+	if len(reasons) > 0 {
+		d.emit(ThreatDGA, "Possible domain generation algorithm activity", reasons, ts, clientIP, lastQuery, "")
+	}
+}
+
+// tunnelingReasons returns descriptions of crossed tunneling thresholds.
+func (d *DNSDetector) tunnelingReasons(s *domainStats) []string {
+	var reasons []string
+	if avg := s.entropy / float64(s.queries); d.cfg.Entropy > 0 && avg >= d.cfg.Entropy {
+		reasons = append(reasons, fmt.Sprintf("average subdomain entropy %.2f >= %.2f", avg, d.cfg.Entropy))
+	}
+	if n := len(s.subdomains); d.cfg.Subdomains > 0 && n >= d.cfg.Subdomains {
+		reasons = append(reasons, fmt.Sprintf("%d unique subdomains >= %d", n, d.cfg.Subdomains))
+	}
+	if avg := s.length / s.queries; d.cfg.QueryLength > 0 && avg >= d.cfg.QueryLength {
+		reasons = append(reasons, fmt.Sprintf("average query length %d >= %d", avg, d.cfg.QueryLength))
+	}
+	if ratio := float64(s.txt) / float64(s.queries); d.cfg.TXTRatio > 0 && ratio >= d.cfg.TXTRatio {
+		reasons = append(reasons, fmt.Sprintf("TXT/NULL query ratio %.2f >= %.2f", ratio, d.cfg.TXTRatio))
+	}
+	return reasons
+}
+
+// dgaReasons returns descriptions of crossed dga thresholds. Both nxdomain
+// ratio and number of distinct nxdomain domains must be crossed.
+func (d *DNSDetector) dgaReasons(s *sourceStats) []string {
+	ratio := float64(s.nxdomain) / float64(s.responses)
+	if d.cfg.NXDomainRatio <= 0 || ratio < d.cfg.NXDomainRatio ||
+		len(s.nxdomains) < d.cfg.NXDomainDomains {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("NXDOMAIN ratio %.2f >= %.2f", ratio, d.cfg.NXDomainRatio),
+		fmt.Sprintf("%d distinct NXDOMAIN domains >= %d", len(s.nxdomains), d.cfg.NXDomainDomains),
+		fmt.Sprintf("average NXDOMAIN label entropy %.2f", s.entropy/float64(len(s.nxdomains))),
+	}
+}
+
+// rotate resets statistics if the current window has passed. Windows
+// follow the wall clock, not timestamps of events, which go back
+// when older logs are read.
+func (d *DNSDetector) rotate() {
+	now := d.now()
+	if d.start.IsZero() {
+		d.start = now
+		return
+	}
+	if now.Sub(d.start) < d.cfg.Window {
+		return
+	}
+	d.start = now
+	d.domains = make(map[string]*domainStats)
+	d.sources = make(map[string]*sourceStats)
+}
+
+// emit writes alert to writers.
+func (d *DNSDetector) emit(threat, title string, reasons []string, ts time.Time, srcIP net.IP, query, qtype string) {
+	ev := &alerts.Event{
+		EventType: "dns",
+		Severity:  d.cfg.Severity,
+		Threats: map[string]alerts.Threat{
+			threat: {
+				Severity:    d.cfg.Severity,
+				Description: title + ": " + strings.Join(reasons, ", "),
+			},
+		},
+		Flags:  []string{"local_heuristics"},
+		Labels: reasons,
+	}
+	ev.Timestamp = ts
+	ev.SrcIP = srcIP
+	ev.Query = query
+	ev.QueryType = qtype
+
+	if d.groups != nil {
+		for _, g := range d.groups.FindGroupsBySrcIP(srcIP) {
+			ev.Groups = append(ev.Groups, alerts.Group{Label: g.Name, Description: g.Label})
+		}
+	}
+
+	if d.writer == nil {
+		return
+	}
+	if err := d.writer.Write(ev); err != nil {
+		log.Errorf("writing dns heuristics alert failed: %s", err)
+	}
+}
+
+// splitDomain splits query into registered domain and subdomain part.
+func splitDomain(query string) (domain, subdomain string) {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(query)
+	if err != nil {
+		return "", ""
+	}
+	subdomain = strings.TrimSuffix(strings.TrimSuffix(query, domain), ".")
+	return domain, subdomain
+}
+
+// entropy returns shannon entropy of string in bits per character.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var h float64
+	n := float64(len(s))
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
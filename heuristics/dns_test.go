@@ -0,0 +1,129 @@
+package heuristics
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+)
+
+type testWriter struct {
+	events []*alerts.Event
+}
+
+func (w *testWriter) Write(event *alerts.Event) error {
+	w.events = append(w.events, event)
+	return nil
+}
+
+func testConfig() DNSConfig {
+	return DNSConfig{
+		Window:          10 * time.Minute,
+		MinQueries:      20,
+		Entropy:         3.5,
+		Subdomains:      20,
+		QueryLength:     50,
+		TXTRatio:        0.5,
+		MinSignals:      2,
+		MinResponses:    20,
+		NXDomainRatio:   0.5,
+		NXDomainDomains: 10,
+		Severity:        3,
+	}
+}
+
+func newTestDetector(t *testing.T) (*DNSDetector, *testWriter) {
+	d, err := NewDNSDetector(testConfig(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWriter{}
+	d.SetWriter(w)
+	return d, w
+}
+
+func TestDNSTunneling(t *testing.T) {
+	d, w := newTestDetector(t)
+	src := net.IPv4(10, 0, 0, 1)
+	ts := time.Unix(1536242944, 0)
+
+	// regular traffic to cdn must not raise alert
+	for i := 0; i < 100; i++ {
+		d.ObserveQuery(ts, src, fmt.Sprintf("img%d.cdn.example.com", i), "A")
+	}
+	if len(w.events) != 0 {
+		t.Fatalf("unexpected alert %s", w.events[0].Threats[ThreatDNSTunneling].Description)
+	}
+
+	for i := 0; i < 100; i++ {
+		sub := fmt.Sprintf("%x%x", i*7919+104729, int64(i)*982451653*2654435761)
+		d.ObserveQuery(ts, src, sub+".tunnel.co.uk.", "TXT")
+	}
+	if len(w.events) != 1 {
+		t.Fatalf("invalid number of alerts - got %d; expected %d", len(w.events), 1)
+	}
+
+	ev := w.events[0]
+	threat, ok := ev.Threats[ThreatDNSTunneling]
+	if !ok || ev.Query != "tunnel.co.uk" || ev.Severity != 3 {
+		t.Fatalf("invalid alert %+v", ev)
+	}
+	if !strings.Contains(threat.Description, "unique subdomains") ||
+		!strings.Contains(threat.Description, "TXT/NULL query ratio 1.00") {
+		t.Fatalf("invalid alert reasons %q", threat.Description)
+	}
+}
+
+func TestDGA(t *testing.T) {
+	d, w := newTestDetector(t)
+	src := net.IPv4(10, 0, 0, 1)
+	ts := time.Unix(1536242944, 0)
+
+	for i := 0; i < 30; i++ {
+		d.ObserveResponse(ts, src, fmt.Sprintf("q%xz%x.com", i*7919, i*104729), i%3 != 0)
+	}
+	if len(w.events) != 1 {
+		t.Fatalf("invalid number of alerts - got %d; expected %d", len(w.events), 1)
+	}
+	if _, ok := w.events[0].Threats[ThreatDGA]; !ok || len(w.events[0].Labels) != 3 {
+		t.Fatalf("invalid alert %+v", w.events[0])
+	}
+
+	// statistics are reset in new window, even if events are older
+	now := d.start.Add(time.Hour)
+	d.now = func() time.Time { return now }
+	d.ObserveResponse(ts.Add(-time.Hour), src, "a.com", true)
+	if len(d.sources) != 1 || d.sources[src.String()].responses != 1 {
+		t.Fatal("statistics not reset in new window")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	for _, tt := range []struct {
+		s string
+		h float64
+	}{
+		{"", 0},
+		{"aaaa", 0},
+		{"ab", 1},
+		{"abcd", 2},
+	} {
+		if h := entropy(tt.s); math.Abs(h-tt.h) > 1e-9 {
+			t.Fatalf("invalid entropy of %q - got %f; expected %f", tt.s, h, tt.h)
+		}
+	}
+}
+
+func TestSplitDomain(t *testing.T) {
+	domain, sub := splitDomain("a.b.example.co.uk")
+	if domain != "example.co.uk" || sub != "a.b" {
+		t.Fatalf("invalid split - got %s, %s", domain, sub)
+	}
+	if domain, _ := splitDomain("co.uk"); domain != "" {
+		t.Fatalf("public suffix must not be registered domain - got %s", domain)
+	}
+}
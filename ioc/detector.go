@@ -0,0 +1,411 @@
+package ioc
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/matchers"
+)
+
+// Default threat ID and severity of local indicator matches.
+const (
+	DefaultThreat   = "local_ioc"
+	DefaultSeverity = 5
+)
+
+// maxSeen limits number of remembered matches used for suppression.
+const maxSeen = 65536
+
+// Config is a detector configuration.
+type Config struct {
+	Feeds []FeedConfig
+	// Suppress repeated alerts for the same source and indicator.
+	Suppress time.Duration
+}
+
+// set keeps indicators of a single feed.
+type set struct {
+	feed     FeedConfig
+	domains  *matchers.Domain
+	networks []*net.IPNet
+	urls     map[string]bool
+	ja3      map[string]bool
+	size     int
+}
+
+// Detector matches dns, ip, http and tls events against indicator
+// feeds and writes alerts for matched events.
+type Detector struct {
+	cfg    Config
+	groups *groups.Groups
+	writer alerts.Writer
+
+	mx   sync.RWMutex
+	sets []*set
+
+	smx  sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// NewDetector creates detector and loads indicators from feeds.
+func NewDetector(cfg Config, groups *groups.Groups) (*Detector, error) {
+	for i := range cfg.Feeds {
+		feed := &cfg.Feeds[i]
+		switch feed.Format {
+		case "":
+			feed.Format = FormatPlain
+		case FormatPlain, FormatCSV, FormatMISP, FormatSTIX:
+		default:
+			return nil, fmt.Errorf("unsupported feed format %s", feed.Format)
+		}
+		if feed.Name == "" {
+			feed.Name = filepath.Base(feed.File)
+		}
+		if feed.Threat == "" {
+			feed.Threat = DefaultThreat
+		}
+		if feed.Severity == 0 {
+			feed.Severity = DefaultSeverity
+		}
+	}
+
+	d := &Detector{
+		cfg:    cfg,
+		groups: groups,
+		sets:   make([]*set, len(cfg.Feeds)),
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetWriter sets writer of alerts raised by detector. Detector is called
+// on sniffer and monitor goroutines, so the writer shouldn't block them,
+// e.g. alerts.QueueWriter.
+func (d *Detector) SetWriter(w alerts.Writer) {
+	d.writer = w
+}
+
+// Reload reloads indicators from all feeds. If a feed can't be loaded
+// then previously loaded indicators of the feed are kept.
+func (d *Detector) Reload() error {
+	sets := make([]*set, len(d.cfg.Feeds))
+	var errs []string
+	for i, feed := range d.cfg.Feeds {
+		s, err := loadSet(feed)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("feed %s: %s", feed.Name, err))
+			d.mx.RLock()
+			sets[i] = d.sets[i]
+			d.mx.RUnlock()
+			continue
+		}
+		log.Infof("loaded %d indicators from %s feed", s.size, feed.Name)
+		sets[i] = s
+	}
+
+	d.mx.Lock()
+	d.sets = sets
+	d.mx.Unlock()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Len returns number of loaded indicators.
+func (d *Detector) Len() int {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	n := 0
+	for _, s := range d.sets {
+		if s != nil {
+			n += s.size
+		}
+	}
+	return n
+}
+
+func loadSet(feed FeedConfig) (*set, error) {
+	indicators, err := LoadFeed(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &set{
+		feed: feed,
+		urls: make(map[string]bool),
+		ja3:  make(map[string]bool),
+		size: len(indicators),
+	}
+	var domains []string
+	for _, i := range indicators {
+		switch i.Type {
+		case TypeDomain:
+			domains = append(domains, i.Value)
+		case TypeCIDR:
+			_, ipnet, _ := net.ParseCIDR(i.Value)
+			s.networks = append(s.networks, ipnet)
+		case TypeURL:
+			s.urls[i.Value] = true
+		case TypeJA3:
+			s.ja3[i.Value] = true
+		}
+	}
+	if s.domains, err = matchers.NewDomain(domains); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// match returns first feed for which fn returns true.
+func (d *Detector) match(fn func(*set) bool) *set {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+	for _, s := range d.sets {
+		if s != nil && fn(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *Detector) matchDomain(domain string) *set {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if domain == "" {
+		return nil
+	}
+	return d.match(func(s *set) bool { return s.domains.Match(domain) })
+}
+
+func (d *Detector) matchIP(ip net.IP) *set {
+	if ip == nil {
+		return nil
+	}
+	return d.match(func(s *set) bool {
+		for _, n := range s.networks {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (d *Detector) matchJA3(ja3 string) *set {
+	ja3 = strings.ToLower(ja3)
+	if ja3 == "" {
+		return nil
+	}
+	return d.match(func(s *set) bool { return s.ja3[ja3] })
+}
+
+func (d *Detector) matchURL(rawurl string) *set {
+	u, ok := normalizeURL(rawurl)
+	if !ok {
+		return nil
+	}
+	noquery := u
+	if n := strings.IndexByte(u, '?'); n >= 0 {
+		noquery = u[:n]
+	}
+	return d.match(func(s *set) bool { return s.urls[u] || s.urls[noquery] })
+}
+
+// CheckDNS checks dns query against indicators.
+func (d *Detector) CheckDNS(ts time.Time, srcIP net.IP, query, qtype string) {
+	s := d.matchDomain(query)
+	if s == nil {
+		return
+	}
+	ev := d.event(s, "dns", query)
+	ev.Timestamp = ts
+	ev.SrcIP = srcIP
+	ev.Query = query
+	ev.QueryType = qtype
+	d.emit(ev, query)
+}
+
+// CheckIP checks ip traffic and ja3 fingerprint against indicators.
+func (d *Detector) CheckIP(ts time.Time, srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, proto, ja3 string) {
+	var indicator string
+	s := d.matchIP(dstIP)
+	if s != nil {
+		indicator = dstIP.String()
+	} else if s = d.matchIP(srcIP); s != nil {
+		indicator = srcIP.String()
+	} else if s = d.matchJA3(ja3); s != nil {
+		indicator = strings.ToLower(ja3)
+	} else {
+		return
+	}
+
+	ev := d.event(s, "ip", indicator)
+	ev.Timestamp = ts
+	ev.SrcIP = srcIP
+	ev.SrcPort = uint16(srcPort)
+	ev.DestIP = dstIP
+	ev.DestPort = uint16(dstPort)
+	ev.Proto = proto
+	ev.Ja3 = ja3
+	d.emit(ev, indicator)
+}
+
+// CheckHTTP checks url and its host against indicators.
+func (d *Detector) CheckHTTP(entry *client.HTTPEntry) {
+	var indicator string
+	s := d.matchURL(entry.URL)
+	if s != nil {
+		indicator = entry.URL
+	} else if u, err := url.Parse(entry.URL); err == nil && u.Hostname() != "" {
+		indicator = u.Hostname()
+		if ip := net.ParseIP(indicator); ip != nil {
+			s = d.matchIP(ip)
+		} else {
+			s = d.matchDomain(indicator)
+		}
+	}
+	if s == nil {
+		return
+	}
+
+	ev := d.event(s, "http", indicator)
+	ev.Timestamp = entry.Timestamp
+	ev.SrcIP = entry.SrcIP
+	ev.SrcPort = entry.SrcPort
+	ev.URL = entry.URL
+	ev.Method = entry.Method
+	ev.UserAgent = entry.UserAgent
+	ev.Referrer = entry.Referrer
+	d.emit(ev, indicator)
+}
+
+// CheckTLS checks tls destination, certificate subject and
+// ja3/ja3s fingerprints against indicators.
+func (d *Detector) CheckTLS(entry *client.TLSEntry) {
+	var indicator string
+	cn := entry.CommonName()
+	s := d.matchIP(entry.DstIP)
+	if s != nil {
+		indicator = entry.DstIP.String()
+	} else if s = d.matchDomain(cn); s != nil {
+		indicator = cn
+	} else if s = d.matchJA3(entry.JA3); s != nil {
+		indicator = strings.ToLower(entry.JA3)
+	} else if s = d.matchJA3(entry.JA3s); s != nil {
+		indicator = strings.ToLower(entry.JA3s)
+	} else {
+		return
+	}
+
+	ev := d.event(s, "tls", indicator)
+	ev.Timestamp = entry.Timestamp
+	ev.SrcIP = entry.SrcIP
+	ev.SrcPort = entry.SrcPort
+	ev.DestIP = entry.DstIP
+	ev.DestPort = entry.DstPort
+	ev.Ja3 = entry.JA3
+	d.emit(ev, indicator)
+}
+
+// event creates alert event for indicator matched in feed.
+func (d *Detector) event(s *set, eventType, indicator string) *alerts.Event {
+	return &alerts.Event{
+		EventType: eventType,
+		Severity:  s.feed.Severity,
+		Threats: map[string]alerts.Threat{
+			s.feed.Threat: {
+				Severity:    s.feed.Severity,
+				Description: fmt.Sprintf("Indicator %s listed in %s feed", indicator, s.feed.Name),
+			},
+		},
+		Flags: []string{"local_ioc"},
+	}
+}
+
+// emit writes event to writers unless the same source
+// matched the same indicator recently.
+func (d *Detector) emit(ev *alerts.Event, indicator string) {
+	if ev.Timestamp.IsZero() {
+		ev.Timestamp = d.now()
+	}
+	if !d.shouldEmit(ev.SrcIP.String() + "|" + indicator) {
+		return
+	}
+
+	if d.groups != nil {
+		for _, g := range d.groups.FindGroupsBySrcIP(ev.SrcIP) {
+			ev.Groups = append(ev.Groups, alerts.Group{Label: g.Name, Description: g.Label})
+		}
+	}
+
+	if d.writer == nil {
+		return
+	}
+	if err := d.writer.Write(ev); err != nil {
+		log.Errorf("writing local ioc alert failed: %s", err)
+	}
+}
+
+func (d *Detector) shouldEmit(key string) bool {
+	if d.cfg.Suppress <= 0 {
+		return true
+	}
+
+	now := d.now()
+	d.smx.Lock()
+	defer d.smx.Unlock()
+
+	if t, ok := d.seen[key]; ok && now.Sub(t) < d.cfg.Suppress {
+		return false
+	}
+	if len(d.seen) >= maxSeen {
+		for k, t := range d.seen {
+			if now.Sub(t) >= d.cfg.Suppress {
+				delete(d.seen, k)
+			}
+		}
+	}
+	d.seen[key] = now
+	return true
+}
+
+// normalizeURL lowercases scheme and host, removes default port
+// and fragment. It returns false for urls without scheme or host.
+func normalizeURL(rawurl string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", false
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), true
+}
@@ -0,0 +1,112 @@
+package ioc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+)
+
+type testWriter struct {
+	events []*alerts.Event
+}
+
+func (w *testWriter) Write(event *alerts.Event) error {
+	w.events = append(w.events, event)
+	return nil
+}
+
+func newTestDetector(t *testing.T, content string, suppress time.Duration) (*Detector, *testWriter, string) {
+	dir, err := ioutil.TempDir("", "nfr-ioc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "feed.txt")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewDetector(Config{
+		Feeds:    []FeedConfig{{Name: "test", File: file}},
+		Suppress: suppress,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &testWriter{}
+	d.SetWriter(w)
+	return d, w, file
+}
+
+func TestDetector(t *testing.T) {
+	d, w, file := newTestDetector(t, `*.evil.com
+1.2.3.0/24
+http://bad.org/malware.exe
+e7d705a3286e19ea42f587b344ee6865
+`, 0)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	src := net.IPv4(10, 0, 0, 1)
+	ts := time.Unix(1536242944, 0)
+
+	d.CheckDNS(ts, src, "www.evil.com.", "A")
+	d.CheckDNS(ts, src, "good.com", "A")
+	d.CheckIP(ts, src, 5000, net.IPv4(1, 2, 3, 4), 443, "tcp", "")
+	d.CheckIP(ts, src, 5000, net.IPv4(8, 8, 8, 8), 443, "tcp", "E7D705A3286E19EA42F587B344EE6865")
+	d.CheckIP(ts, src, 5000, net.IPv4(8, 8, 8, 8), 53, "udp", "")
+	d.CheckHTTP(&client.HTTPEntry{Timestamp: ts, SrcIP: src, URL: "HTTP://bad.org:80/malware.exe?x=1"})
+	d.CheckHTTP(&client.HTTPEntry{Timestamp: ts, SrcIP: src, URL: "http://cdn.evil.com/index.html"})
+	d.CheckTLS(&client.TLSEntry{Timestamp: ts, SrcIP: src, Subject: "O=Org, CN=api.evil.com"})
+
+	expected := []string{"dns", "ip", "ip", "http", "http", "tls"}
+	if len(w.events) != len(expected) {
+		t.Fatalf("invalid number of alerts - got %d; expected %d", len(w.events), len(expected))
+	}
+	for i, ev := range w.events {
+		if ev.EventType != expected[i] {
+			t.Fatalf("invalid alert %d event type - got %s; expected %s", i, ev.EventType, expected[i])
+		}
+		if threat, ok := ev.Threats[DefaultThreat]; !ok || ev.Severity != DefaultSeverity || threat.Description == "" {
+			t.Fatalf("invalid alert %d %+v", i, ev)
+		}
+	}
+	if d := w.events[0].Threats[DefaultThreat].Description; d != "Indicator www.evil.com. listed in test feed" {
+		t.Fatalf("invalid threat description %q", d)
+	}
+}
+
+func TestDetectorSuppressAndReload(t *testing.T) {
+	d, w, file := newTestDetector(t, "evil.com\n", time.Hour)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	src := net.IPv4(10, 0, 0, 1)
+	d.CheckDNS(time.Now(), src, "evil.com", "A")
+	d.CheckDNS(time.Now(), src, "evil.com", "A")
+	if len(w.events) != 1 {
+		t.Fatalf("repeated match not suppressed - got %d alerts", len(w.events))
+	}
+
+	if err := ioutil.WriteFile(file, []byte("evil.com\nbad.org\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 2 {
+		t.Fatalf("invalid number of indicators after reload - got %d; expected %d", d.Len(), 2)
+	}
+
+	// keep old indicators if feed can't be loaded
+	os.Remove(file)
+	if err := d.Reload(); err == nil {
+		t.Fatal("expected reload error")
+	}
+	if d.Len() != 2 {
+		t.Fatalf("indicators lost after failed reload - got %d", d.Len())
+	}
+}
@@ -0,0 +1,351 @@
+// Package ioc matches network telemetry against local indicators of compromise.
+package ioc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alphasoc/nfr/utils"
+)
+
+// Supported feed formats.
+const (
+	FormatPlain = "plain"
+	FormatCSV   = "csv"
+	FormatMISP  = "misp"
+	FormatSTIX  = "stix"
+)
+
+// Indicator types.
+const (
+	TypeDomain = "domain"
+	TypeCIDR   = "cidr"
+	TypeURL    = "url"
+	TypeJA3    = "ja3"
+)
+
+// Indicator is a single indicator of compromise.
+type Indicator struct {
+	Type  string
+	Value string
+}
+
+// FeedConfig describes single indicators feed file.
+type FeedConfig struct {
+	// Name of the feed, used in alert description.
+	Name string
+	// File with indicators.
+	File string
+	// Format of the file: plain, csv, misp or stix.
+	Format string
+	// Type of indicators in plain and csv files without type column.
+	// Type is detected from indicator value if empty.
+	Type string
+	// Threat ID and severity of alerts raised by the feed.
+	Threat   string
+	Severity int
+}
+
+// LoadFeed reads indicators from the feed file.
+func LoadFeed(cfg FeedConfig) ([]Indicator, error) {
+	f, err := os.Open(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch cfg.Format {
+	case FormatPlain, "":
+		return parsePlain(f, cfg.Type)
+	case FormatCSV:
+		return parseCSV(f, cfg.Type)
+	case FormatMISP:
+		return parseMISP(f)
+	case FormatSTIX:
+		return parseSTIX(f, time.Now())
+	}
+	return nil, fmt.Errorf("unsupported feed format %s", cfg.Format)
+}
+
+var ja3Regexp = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// newIndicator normalizes indicator value and checks it has valid type.
+// If typ is empty then type is detected from the value.
+func newIndicator(typ, value string) (Indicator, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Indicator{}, false
+	}
+
+	if typ == "" {
+		switch {
+		case net.ParseIP(value) != nil || strings.Contains(value, "/") && !strings.Contains(value, "://"):
+			typ = TypeCIDR
+		case strings.Contains(value, "://"):
+			typ = TypeURL
+		case ja3Regexp.MatchString(value):
+			typ = TypeJA3
+		default:
+			typ = TypeDomain
+		}
+	}
+
+	switch typ {
+	case TypeDomain:
+		value = strings.ToLower(strings.TrimSuffix(value, "."))
+		if !utils.IsDomainName(strings.TrimPrefix(value, "*.")) {
+			return Indicator{}, false
+		}
+	case TypeCIDR:
+		if ip := net.ParseIP(value); ip != nil {
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return Indicator{}, false
+		}
+		value = ipnet.String()
+	case TypeURL:
+		u, ok := normalizeURL(value)
+		if !ok {
+			return Indicator{}, false
+		}
+		value = u
+	case TypeJA3:
+		if !ja3Regexp.MatchString(value) {
+			return Indicator{}, false
+		}
+		value = strings.ToLower(value)
+	default:
+		return Indicator{}, false
+	}
+	return Indicator{Type: typ, Value: value}, true
+}
+
+// parsePlain parses file with one indicator per line.
+// Empty lines and lines starting with # are skipped.
+func parsePlain(r io.Reader, typ string) ([]Indicator, error) {
+	var indicators []Indicator
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i, ok := newIndicator(typ, line); ok {
+			indicators = append(indicators, i)
+		}
+	}
+	return indicators, scanner.Err()
+}
+
+// parseCSV parses csv file. If the first row is a header with indicator,
+// value or ioc column, then the column is used, otherwise the first column.
+// The type column, if present, defines indicator type.
+func parseCSV(r io.Reader, typ string) ([]Indicator, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	valueCol, typeCol := 0, -1
+	header := false
+	for n, name := range records[0] {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "indicator", "value", "ioc":
+			valueCol, header = n, true
+		case "type":
+			typeCol, header = n, true
+		}
+	}
+	if header {
+		records = records[1:]
+	}
+
+	var indicators []Indicator
+	for _, record := range records {
+		if valueCol >= len(record) {
+			continue
+		}
+		t := typ
+		if typeCol >= 0 && typeCol < len(record) {
+			// skip indicators of unsupported types
+			if t = indicatorType(record[typeCol]); t == "" {
+				continue
+			}
+		}
+		if i, ok := newIndicator(t, record[valueCol]); ok {
+			indicators = append(indicators, i)
+		}
+	}
+	return indicators, nil
+}
+
+// indicatorType maps type names used by feeds to indicator type.
+func indicatorType(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "domain", "hostname", "fqdn", "domain-name":
+		return TypeDomain
+	case "ip", "cidr", "ip-dst", "ip-src", "ipv4-addr", "ipv6-addr":
+		return TypeCIDR
+	case "url", "link", "uri":
+		return TypeURL
+	case "ja3", "ja3-fingerprint-md5":
+		return TypeJA3
+	}
+	return ""
+}
+
+type mispAttribute struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type mispEvent struct {
+	Attribute []mispAttribute `json:"Attribute"`
+	Object    []struct {
+		Attribute []mispAttribute `json:"Attribute"`
+	} `json:"Object"`
+}
+
+// parseMISP parses MISP event export. Single event, list of events
+// and attribute search results are supported.
+func parseMISP(r io.Reader) ([]Indicator, error) {
+	var doc struct {
+		Event     *mispEvent      `json:"Event"`
+		Response  json.RawMessage `json:"response"`
+		Attribute []mispAttribute `json:"Attribute"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid misp json: %s", err)
+	}
+
+	var attrs []mispAttribute
+	addEvent := func(ev *mispEvent) {
+		attrs = append(attrs, ev.Attribute...)
+		for _, obj := range ev.Object {
+			attrs = append(attrs, obj.Attribute...)
+		}
+	}
+
+	if doc.Event != nil {
+		addEvent(doc.Event)
+	}
+	attrs = append(attrs, doc.Attribute...)
+	if len(doc.Response) > 0 {
+		var events []struct {
+			Event mispEvent `json:"Event"`
+		}
+		var search struct {
+			Attribute []mispAttribute `json:"Attribute"`
+		}
+		if err := json.Unmarshal(doc.Response, &events); err == nil {
+			for i := range events {
+				addEvent(&events[i].Event)
+			}
+		} else if err := json.Unmarshal(doc.Response, &search); err == nil {
+			attrs = append(attrs, search.Attribute...)
+		} else {
+			return nil, fmt.Errorf("invalid misp response: %s", err)
+		}
+	}
+
+	var indicators []Indicator
+	for _, attr := range attrs {
+		// composite attributes like domain|ip or ip-dst|port
+		types := strings.Split(attr.Type, "|")
+		values := strings.Split(attr.Value, "|")
+		for n := range types {
+			if n >= len(values) {
+				break
+			}
+			t := indicatorType(types[n])
+			if t == "" {
+				continue
+			}
+			if i, ok := newIndicator(t, values[n]); ok {
+				indicators = append(indicators, i)
+			}
+		}
+	}
+	return indicators, nil
+}
+
+// stixComparison matches comparison expressions in stix patterns,
+// for example domain-name:value = 'evil.com'.
+var stixComparison = regexp.MustCompile(`([a-z0-9-]+):([A-Za-z0-9_.'-]+)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// parseSTIX parses STIX 2.1 bundle. Indicators with stix patterns
+// are used, revoked and expired indicators are skipped.
+func parseSTIX(r io.Reader, now time.Time) ([]Indicator, error) {
+	var bundle struct {
+		Type    string `json:"type"`
+		Objects []struct {
+			Type        string    `json:"type"`
+			Pattern     string    `json:"pattern"`
+			PatternType string    `json:"pattern_type"`
+			Revoked     bool      `json:"revoked"`
+			ValidUntil  time.Time `json:"valid_until"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("invalid stix json: %s", err)
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("stix document is not a bundle")
+	}
+
+	var indicators []Indicator
+	for _, obj := range bundle.Objects {
+		if obj.Type != "indicator" || obj.Revoked ||
+			(obj.PatternType != "" && obj.PatternType != "stix") ||
+			(!obj.ValidUntil.IsZero() && obj.ValidUntil.Before(now)) {
+			continue
+		}
+
+		for _, m := range stixComparison.FindAllStringSubmatch(obj.Pattern, -1) {
+			object, property := m[1], m[2]
+			value := strings.Replace(m[3], `\'`, "'", -1)
+
+			var t string
+			switch {
+			case strings.Contains(strings.ToLower(property), "ja3"):
+				t = TypeJA3
+			case property != "value":
+				continue
+			case object == "domain-name":
+				t = TypeDomain
+			case object == "ipv4-addr" || object == "ipv6-addr":
+				t = TypeCIDR
+			case object == "url":
+				t = TypeURL
+			default:
+				continue
+			}
+			if i, ok := newIndicator(t, value); ok {
+				indicators = append(indicators, i)
+			}
+		}
+	}
+	return indicators, nil
+}
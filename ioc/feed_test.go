@@ -0,0 +1,106 @@
+package ioc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func indicatorsString(indicators []Indicator) string {
+	var s []string
+	for _, i := range indicators {
+		s = append(s, i.Type+":"+i.Value)
+	}
+	return strings.Join(s, ",")
+}
+
+func TestParsePlain(t *testing.T) {
+	indicators, err := parsePlain(strings.NewReader(`# comment
+Evil.com.
+*.bad.org
+1.2.3.4
+10.0.0.0/8
+https://Evil.com:443/path?q=1#frag
+e7d705a3286e19ea42f587b344ee6865
+
+not a domain
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "domain:evil.com,domain:*.bad.org,cidr:1.2.3.4/32,cidr:10.0.0.0/8," +
+		"url:https://evil.com/path?q=1,ja3:e7d705a3286e19ea42f587b344ee6865"
+	if got := indicatorsString(indicators); got != expected {
+		t.Fatalf("invalid indicators\ngot      %s\nexpected %s", got, expected)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	indicators, err := parseCSV(strings.NewReader(`id,type,indicator
+1,domain,evil.com
+2,ip-dst,1.2.3.4
+3,unknown,x
+`), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indicatorsString(indicators); got != "domain:evil.com,cidr:1.2.3.4/32" {
+		t.Fatalf("invalid indicators %s", got)
+	}
+
+	indicators, err = parseCSV(strings.NewReader("evil.com,2020-01-01\nbad.org,2020-01-01\n"), TypeDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := indicatorsString(indicators); got != "domain:evil.com,domain:bad.org" {
+		t.Fatalf("invalid indicators %s", got)
+	}
+}
+
+func TestParseMISP(t *testing.T) {
+	indicators, err := parseMISP(strings.NewReader(`{"response": [{"Event": {
+		"Attribute": [
+			{"type": "domain", "value": "evil.com"},
+			{"type": "ip-dst|port", "value": "1.2.3.4|443"},
+			{"type": "md5", "value": "e7d705a3286e19ea42f587b344ee6865"}
+		],
+		"Object": [{"Attribute": [
+			{"type": "url", "value": "http://bad.org/x"},
+			{"type": "ja3-fingerprint-md5", "value": "e7d705a3286e19ea42f587b344ee6865"}
+		]}]
+	}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "domain:evil.com,cidr:1.2.3.4/32,url:http://bad.org/x,ja3:e7d705a3286e19ea42f587b344ee6865"
+	if got := indicatorsString(indicators); got != expected {
+		t.Fatalf("invalid indicators\ngot      %s\nexpected %s", got, expected)
+	}
+}
+
+func TestParseSTIX(t *testing.T) {
+	indicators, err := parseSTIX(strings.NewReader(`{"type": "bundle", "objects": [
+		{"type": "indicator", "pattern_type": "stix",
+		 "pattern": "[domain-name:value = 'evil.com'] OR [ipv4-addr:value = '1.2.3.0/24']"},
+		{"type": "indicator", "pattern": "[url:value = 'http://bad.org/x']"},
+		{"type": "indicator", "pattern": "[network-traffic:extensions.'tls-ext'.ja3 = 'e7d705a3286e19ea42f587b344ee6865']"},
+		{"type": "indicator", "pattern": "[domain-name:value = 'revoked.com']", "revoked": true},
+		{"type": "indicator", "pattern": "[domain-name:value = 'expired.com']", "valid_until": "2019-01-01T00:00:00Z"},
+		{"type": "indicator", "pattern_type": "sigma", "pattern": "[domain-name:value = 'sigma.com']"},
+		{"type": "malware", "name": "x"}
+	]}`), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "domain:evil.com,cidr:1.2.3.0/24,url:http://bad.org/x,ja3:e7d705a3286e19ea42f587b344ee6865"
+	if got := indicatorsString(indicators); got != expected {
+		t.Fatalf("invalid indicators\ngot      %s\nexpected %s", got, expected)
+	}
+
+	if _, err := parseSTIX(strings.NewReader(`{"type": "indicator"}`), time.Now()); err == nil {
+		t.Fatal("expected not a bundle error")
+	}
+}
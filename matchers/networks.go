@@ -3,6 +3,8 @@ package matchers
 import (
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
 // Network matches network based on src and dst IP.
@@ -15,6 +17,48 @@ type Network struct {
 	dstIncludes    []*net.IPNet
 	dstExcludes    []*net.IPNet
 	dstExcludesIps map[string]bool // compare ip as string
+
+	// destination ports and protocols, any if includes are empty
+	portIncludes  []PortRange
+	portExcludes  []PortRange
+	protoIncludes map[string]bool
+	protoExcludes map[string]bool
+}
+
+// PortRange is a range of destination ports, optionally of a protocol.
+type PortRange struct {
+	From, To int
+	// Protocol of the ports, any if empty.
+	Protocol string
+}
+
+// ParsePortRange parses port range in format port[-port][/protocol],
+// e.g. 53, 8000-8080 or 123/udp.
+func ParsePortRange(s string) (PortRange, error) {
+	var r PortRange
+	ports, proto, hasProto := strings.Cut(s, "/")
+	if hasProto && proto == "" {
+		return r, fmt.Errorf("%s has empty protocol", s)
+	}
+	r.Protocol = strings.ToLower(proto)
+	from, to, isRange := strings.Cut(ports, "-")
+
+	var err error
+	if r.From, err = strconv.Atoi(from); err != nil || r.From < 0 || r.From > 65535 {
+		return r, fmt.Errorf("%s is not port or port range", s)
+	}
+	r.To = r.From
+	if isRange {
+		if r.To, err = strconv.Atoi(to); err != nil || r.To < r.From || r.To > 65535 {
+			return r, fmt.Errorf("%s is not port or port range", s)
+		}
+	}
+	return r, nil
+}
+
+// Contains returns true if the port of the protocol is in the range.
+func (r PortRange) Contains(port int, proto string) bool {
+	return port >= r.From && port <= r.To && (r.Protocol == "" || r.Protocol == proto)
 }
 
 // NewNetwork creates Network matcher for given includes and excludes netowrks.
@@ -87,6 +131,45 @@ func NewNetwork(srcIncludes, srcExcludes, dstIncludes, dstExcludes []string) (*N
 	return m, nil
 }
 
+// SetPorts sets destination ports, or port ranges, events are matched to.
+// If includes are set, then events to other ports are excluded.
+func (m *Network) SetPorts(includes, excludes []string) error {
+	m.portIncludes, m.portExcludes = nil, nil
+	for _, s := range includes {
+		r, err := ParsePortRange(s)
+		if err != nil {
+			return err
+		}
+		m.portIncludes = append(m.portIncludes, r)
+	}
+	for _, s := range excludes {
+		r, err := ParsePortRange(s)
+		if err != nil {
+			return err
+		}
+		m.portExcludes = append(m.portExcludes, r)
+	}
+	return nil
+}
+
+// SetProtocols sets protocols events are matched to. If includes are set,
+// then events of other protocols are excluded.
+func (m *Network) SetProtocols(includes, excludes []string) {
+	m.protoIncludes, m.protoExcludes = nil, nil
+	for _, proto := range includes {
+		if m.protoIncludes == nil {
+			m.protoIncludes = make(map[string]bool)
+		}
+		m.protoIncludes[strings.ToLower(proto)] = true
+	}
+	for _, proto := range excludes {
+		if m.protoExcludes == nil {
+			m.protoExcludes = make(map[string]bool)
+		}
+		m.protoExcludes[strings.ToLower(proto)] = true
+	}
+}
+
 // MatchSrcIP matches src ip to check if it's on networks included list
 // at the same time checking if it's not in any excluded list.
 func (m *Network) MatchSrcIP(srcIP net.IP) (bool, bool) {
@@ -169,6 +252,49 @@ func (m *Network) Match(srcIP, dstIP net.IP) (bool, bool) {
 	return m.MatchDstIP(dstIP)
 }
 
+// ExcludesPort checks if destination port and protocol are excluded, that is
+// they are not in included ports and protocols, if set, or they are
+// in excluded ones. Unknown port (0) or protocol (empty) is excluded
+// only if includes are set.
+func (m *Network) ExcludesPort(dstPort int, proto string) bool {
+	proto = strings.ToLower(proto)
+	if len(m.protoIncludes) > 0 && !m.protoIncludes[proto] {
+		return true
+	}
+	if m.protoExcludes[proto] {
+		return true
+	}
+
+	if len(m.portIncludes) > 0 {
+		included := false
+		for _, r := range m.portIncludes {
+			if r.Contains(dstPort, proto) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return true
+		}
+	}
+	for _, r := range m.portExcludes {
+		if r.Contains(dstPort, proto) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchFlow matches src and dest ips like Match, checking in addition
+// if destination port and protocol are not excluded.
+func (m *Network) MatchFlow(srcIP, dstIP net.IP, dstPort int, proto string) (bool, bool) {
+	matched, excluded := m.Match(srcIP, dstIP)
+	if !matched || excluded {
+		return matched, excluded
+	}
+	return true, m.ExcludesPort(dstPort, proto)
+}
+
 func isIpnetIP(ipnet *net.IPNet) bool {
 	once, _ := ipnet.Mask.Size()
 	return (ipnet.IP.To4() != nil && once == 32) || once == 128
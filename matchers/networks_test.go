@@ -134,3 +134,49 @@ func TestInvalidNetwork(t *testing.T) {
 		t.Fatalf("got %s; expected <nil>", err)
 	}
 }
+
+func TestNetworkPorts(t *testing.T) {
+	matcher, err := NewNetwork([]string{"10.0.0.0/8"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := matcher.SetPorts([]string{"53", "80", "443", "8000-8080"}, []string{"8008/tcp"}); err != nil {
+		t.Fatal(err)
+	}
+	matcher.SetProtocols(nil, []string{"ICMP"})
+
+	src, dst := net.IPv4(10, 0, 0, 1), net.IPv4(8, 8, 8, 8)
+	for _, tt := range []struct {
+		port     int
+		proto    string
+		excluded bool
+	}{
+		{53, "udp", false},
+		{443, "tcp", false},
+		{8001, "tcp", false},
+		{8008, "udp", false},
+		{8008, "tcp", true},
+		{22, "tcp", true},
+		{0, "icmp", true},
+		{53, "icmp", true},
+	} {
+		matched, excluded := matcher.MatchFlow(src, dst, tt.port, tt.proto)
+		if !matched || excluded != tt.excluded {
+			t.Errorf("MatchFlow(%s, %s, %d, %s) = %t, %t; expected true, %t",
+				src, dst, tt.port, tt.proto, matched, excluded, tt.excluded)
+		}
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	for _, s := range []string{"53", "1-65535", "123/udp", "8000-8080/TCP"} {
+		if _, err := ParsePortRange(s); err != nil {
+			t.Errorf("ParsePortRange(%s) got %s; expected <nil>", s, err)
+		}
+	}
+	for _, s := range []string{"", "http", "65536", "80-22", "53/", "-1"} {
+		if _, err := ParsePortRange(s); err == nil {
+			t.Errorf("ParsePortRange(%q) got <nil>; expected error", s)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package matchers
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alphasoc/nfr/utils"
+)
+
+// schemeRegexp matches url schemes, e.g. http or https.
+var schemeRegexp = regexp.MustCompile(`^[a-z][a-z0-9+.-]*$`)
+
+// URLPattern is a pattern of urls in format [scheme://]host[:port][/path].
+type URLPattern struct {
+	// Scheme of urls, any if empty.
+	Scheme string
+	// Host is a strict host name or ip, or multimatch domain with
+	// prefix *. like *.example.com, or * for any host.
+	Host string
+	// Port of urls, any if 0. Urls with no port have default port
+	// of the scheme, e.g. 443 for https.
+	Port int
+	// Path of urls. Path with * is a glob matched against the whole path
+	// of urls, where * matches any characters, including /. Path
+	// with no * is a prefix of the path of urls. Any path if empty.
+	Path string
+
+	// prefix and suffix of the path, and parts of the path between *,
+	// if it's a glob.
+	prefix, suffix string
+	parts          []string
+	glob           bool
+}
+
+// ParseURLPattern parses url pattern in format [scheme://]host[:port][/path],
+// e.g. windowsupdate.com/msdownload/, *.example.com/*.exe or https://example.com:8443.
+func ParseURLPattern(s string) (URLPattern, error) {
+	var p URLPattern
+	rest := s
+	if scheme, r, ok := strings.Cut(rest, "://"); ok {
+		p.Scheme = strings.ToLower(scheme)
+		if !schemeRegexp.MatchString(p.Scheme) {
+			return p, fmt.Errorf("%s has invalid scheme", s)
+		}
+		rest = r
+	}
+	if strings.ContainsAny(rest, "?#") {
+		return p, fmt.Errorf("%s has query or fragment", s)
+	}
+
+	hostport := rest
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		hostport, p.Path = rest[:i], rest[i:]
+	}
+	host, port := splitHostPort(hostport)
+	if port != "" {
+		var err error
+		if p.Port, err = strconv.Atoi(port); err != nil || p.Port < 1 || p.Port > 65535 {
+			return p, fmt.Errorf("%s has invalid port", s)
+		}
+	}
+	p.Host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if p.Host != "*" && net.ParseIP(p.Host) == nil &&
+		!utils.IsDomainName(p.Host) && !utils.IsDomainName(strings.TrimPrefix(p.Host, "*.")) {
+		return p, fmt.Errorf("%s has invalid host", s)
+	}
+
+	// glob with the only * at the end is a prefix, e.g. /msdownload/*
+	path := p.Path
+	if strings.Count(path, "*") == 1 && strings.HasSuffix(path, "*") {
+		path = path[:len(path)-1]
+	}
+	if !strings.Contains(path, "*") {
+		p.prefix = path
+		return p, nil
+	}
+	parts := strings.Split(path, "*")
+	p.glob = true
+	p.prefix, p.suffix = parts[0], parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		if part != "" {
+			p.parts = append(p.parts, part)
+		}
+	}
+	return p, nil
+}
+
+// match returns true if url with the scheme, port and path matches the pattern.
+func (p *URLPattern) match(scheme string, port int, path string) bool {
+	if (p.Scheme != "" && p.Scheme != scheme) || (p.Port != 0 && p.Port != port) {
+		return false
+	}
+	if !strings.HasPrefix(path, p.prefix) {
+		return false
+	}
+	if !p.glob {
+		return true
+	}
+	path = path[len(p.prefix):]
+	if len(path) < len(p.suffix) || !strings.HasSuffix(path, p.suffix) {
+		return false
+	}
+	path = path[:len(path)-len(p.suffix)]
+	for _, part := range p.parts {
+		i := strings.Index(path, part)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(part):]
+	}
+	return true
+}
+
+// URL matches urls on a list of url patterns. Patterns are indexed
+// by host, so matching takes time of patterns of the url host only.
+type URL struct {
+	hosts     map[string][]*URLPattern // strict host names and ips
+	domains   map[string][]*URLPattern // multimatch domain names
+	any       []*URLPattern            // patterns of any host
+	maxLabels int                      // maxLabels is max count of labels in multimatch domains map
+}
+
+// NewURL creates URL matcher for given url patterns.
+// It returns error if any of patterns has invalid format.
+func NewURL(patterns []string) (*URL, error) {
+	m := &URL{
+		hosts:   make(map[string][]*URLPattern),
+		domains: make(map[string][]*URLPattern),
+	}
+	for _, s := range patterns {
+		p, err := ParseURLPattern(s)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case p.Host == "*":
+			m.any = append(m.any, &p)
+		case strings.HasPrefix(p.Host, "*."):
+			domain := strings.TrimPrefix(p.Host, "*.")
+			m.domains[domain] = append(m.domains[domain], &p)
+			if labels := strings.Count(domain, ".") + 1; labels > m.maxLabels {
+				m.maxLabels = labels
+			}
+		default:
+			m.hosts[p.Host] = append(m.hosts[p.Host], &p)
+		}
+	}
+	return m, nil
+}
+
+// Match returns true if url matches any of patterns. Query and
+// fragment of the url are not matched.
+func (m *URL) Match(url string) bool {
+	if url == "" {
+		return false
+	}
+	scheme, host, port, path := splitURL(url)
+	if host == "" {
+		return false
+	}
+
+	for _, p := range m.hosts[host] {
+		if p.match(scheme, port, path) {
+			return true
+		}
+	}
+
+	if len(m.domains) > 0 {
+		// shrink to longest suffix, used to search in map
+		domain := host
+		dot := len(domain)
+		for n := m.maxLabels; n > 0 && dot > 0; n-- {
+			dot = strings.LastIndexByte(domain[:dot], '.')
+		}
+		domain = domain[dot+1:]
+
+		// check patterns of each suffix, e.g. b.c and c of a.b.c
+		for len(domain) > 0 {
+			for _, p := range m.domains[domain] {
+				if p.match(scheme, port, path) {
+					return true
+				}
+			}
+			dot := strings.IndexByte(domain, '.')
+			if dot < 0 {
+				break
+			}
+			domain = domain[dot+1:]
+		}
+	}
+
+	for _, p := range m.any {
+		if p.match(scheme, port, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPorts are ports of urls with no port, by scheme.
+var defaultPorts = map[string]int{
+	"":      80,
+	"http":  80,
+	"https": 443,
+	"ftp":   21,
+	"ws":    80,
+	"wss":   443,
+}
+
+// splitURL returns lowercased scheme and host, port and path of url.
+func splitURL(url string) (scheme, host string, port int, path string) {
+	rest := url
+	if s, r, ok := strings.Cut(rest, "://"); ok {
+		scheme, rest = strings.ToLower(s), r
+	}
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+
+	hostport, path := rest, "/"
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		hostport, path = rest[:i], rest[i:]
+	}
+	// user info, e.g. user:password@host
+	if i := strings.LastIndexByte(hostport, '@'); i >= 0 {
+		hostport = hostport[i+1:]
+	}
+
+	host, p := splitHostPort(hostport)
+	port = defaultPorts[scheme]
+	if n, err := strconv.Atoi(p); err == nil {
+		port = n
+	}
+	return scheme, strings.ToLower(strings.TrimSuffix(host, ".")), port, path
+}
+
+// splitHostPort splits host[:port], where host may be ipv6 address in brackets.
+func splitHostPort(hostport string) (host, port string) {
+	host = hostport
+	if i := strings.LastIndexByte(hostport, ':'); i >= 0 && !strings.Contains(hostport[i:], "]") {
+		host, port = hostport[:i], hostport[i+1:]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port
+}
@@ -0,0 +1,87 @@
+package matchers
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	urlsTests := []struct {
+		name     string
+		patterns []string
+		cases    []string
+		expected []bool
+	}{
+		{
+			"empty",
+			[]string{},
+			[]string{"", "http://example.com/"},
+			[]bool{false, false},
+		},
+		{
+			"host",
+			[]string{"example.com"},
+			[]string{"http://example.com", "https://Example.COM/a/b?c=d", "example.com:8080/a", "a.example.com/", "http://user@example.com/"},
+			[]bool{true, true, true, false, true},
+		},
+		{
+			"path prefix",
+			[]string{"windowsupdate.com/msdownload/", "example.com/a*"},
+			[]string{"http://windowsupdate.com/msdownload/update/x.cab", "http://windowsupdate.com/msdownload", "http://windowsupdate.com/other", "example.com/abc", "example.com/b"},
+			[]bool{true, false, false, true, false},
+		},
+		{
+			"path glob",
+			[]string{"*.example.com/*.exe", "example.com/a/*/c/*.js"},
+			[]string{"http://dl.example.com/x/y.exe", "http://example.com/y.exe", "http://dl.example.com/y.exe.txt", "example.com/a/b/b/c/d.js", "example.com/a/c/d.js"},
+			[]bool{true, true, false, true, false},
+		},
+		{
+			"scheme and port",
+			[]string{"https://secure.example.com", "example.com:8080", "[::1]:8443/"},
+			[]string{"https://secure.example.com/", "http://secure.example.com/", "secure.example.com:443/", "http://example.com:8080/", "http://example.com/", "https://[::1]:8443/a"},
+			[]bool{true, false, false, true, false, true},
+		},
+		{
+			"any host",
+			[]string{"*/favicon.ico"},
+			[]string{"http://example.com/favicon.ico", "http://example.com/index.html"},
+			[]bool{true, false},
+		},
+	}
+
+	for _, tt := range urlsTests {
+		matcher, err := NewURL(tt.patterns)
+		if err != nil {
+			t.Fatalf("%s %s", tt.name, err)
+		}
+		for i := range tt.cases {
+			if matcher.Match(tt.cases[i]) != tt.expected[i] {
+				t.Fatalf("test %s - match(%s) = %t; want %t", tt.name, tt.cases[i], !tt.expected[i], tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestParseURLPattern(t *testing.T) {
+	for _, s := range []string{"", "/path", "1http://example.com", "example.com:0", "example.com:http", "example.com/?a=b", "exa mple.com"} {
+		if _, err := ParseURLPattern(s); err == nil {
+			t.Errorf("ParseURLPattern(%q) expected error", s)
+		}
+	}
+}
+
+func BenchmarkURL(b *testing.B) {
+	patterns := make([]string, 10000)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf("*.host%d.example.com/path%d/*.exe", i, i)
+	}
+	matcher, err := NewURL(patterns)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matcher.Match("http://www.host9999.example.com/path9999/setup.exe?x=1")
+	}
+}
@@ -0,0 +1,383 @@
+// Package metrics exports nfr metrics in Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType of Prometheus text format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are default histogram buckets in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry keeps metrics exported by Handler.
+type Registry struct {
+	mx      sync.Mutex
+	metrics map[string]metric
+}
+
+// DefaultRegistry is a registry used by New* functions.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates new registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// metric writes its samples in text format.
+type metric interface {
+	write(w io.Writer)
+}
+
+// register adds metric to registry. It panics if metric with
+// the same name is already registered.
+func (r *Registry) register(name string, m metric) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicated metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// Write writes all metrics sorted by name in Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mx.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mx.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves metrics in Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// Handler returns http handler serving metrics of the default registry
+// and other given registries.
+func Handler(registries ...*Registry) http.Handler {
+	registries = append([]*Registry{DefaultRegistry}, registries...)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		for _, r := range registries {
+			if err := r.Write(w); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// desc describes metric and its labels.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+// key returns map key of label values.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// series formats metric name with labels, e.g. name{type="dns"}.
+func (d *desc) series(name string, values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return name
+	}
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, label := range d.labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		if len(d.labels) > 0 || i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra[i])
+		b.WriteString(`="`)
+		b.WriteString(extra[i+1])
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// vec keeps values of a metric by label values.
+type vec struct {
+	desc
+	mx     sync.Mutex
+	values map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+func (v *vec) add(delta float64, values []string, set bool) {
+	key := v.key(values)
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	s, ok := v.values[key]
+	if !ok {
+		s = &sample{labels: append([]string(nil), values...)}
+		v.values[key] = s
+	}
+	if set {
+		s.value = delta
+	} else {
+		s.value += delta
+	}
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+	v.writeHeader(w)
+	for _, s := range sortedSamples(v.values) {
+		fmt.Fprintf(w, "%s %s\n", v.series(v.name, s.labels), formatFloat(s.value))
+	}
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates and registers counter in the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates and registers counter in the registry.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec{desc: desc{name, help, "counter", labels}, values: make(map[string]*sample)}}
+	r.register(name, c)
+	return c
+}
+
+// Inc increments counter with given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.add(1, values, false)
+}
+
+// Add adds n to counter with given label values. Negative n is ignored.
+func (c *CounterVec) Add(n float64, values ...string) {
+	if n > 0 {
+		c.add(n, values, false)
+	}
+}
+
+// GaugeVec is a gauge with labels.
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec creates and registers gauge in the default registry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec creates and registers gauge in the registry.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec{desc: desc{name, help, "gauge", labels}, values: make(map[string]*sample)}}
+	r.register(name, g)
+	return g
+}
+
+// Set sets gauge with given label values.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	g.add(v, values, true)
+}
+
+// Func is a gauge or counter collected when metrics are written.
+type Func struct {
+	desc
+	collect func(set func(v float64, values ...string))
+}
+
+// NewGaugeFunc creates and registers gauge func in the default registry.
+// The collect function reports gauge values by calling set.
+func NewGaugeFunc(name, help string, labels []string, collect func(set func(v float64, values ...string))) *Func {
+	return DefaultRegistry.NewGaugeFunc(name, help, labels, collect)
+}
+
+// NewGaugeFunc creates and registers gauge func in the registry.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(set func(v float64, values ...string))) *Func {
+	f := &Func{desc{name, help, "gauge", labels}, collect}
+	r.register(name, f)
+	return f
+}
+
+// NewCounterFunc creates and registers counter func in the registry.
+// The collect function reports current counter values by calling set.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func(set func(v float64, values ...string))) *Func {
+	f := &Func{desc{name, help, "counter", labels}, collect}
+	r.register(name, f)
+	return f
+}
+
+func (f *Func) write(w io.Writer) {
+	samples := make(map[string]*sample)
+	f.collect(func(v float64, values ...string) {
+		samples[f.key(values)] = &sample{labels: append([]string(nil), values...), value: v}
+	})
+	f.writeHeader(w)
+	for _, s := range sortedSamples(samples) {
+		fmt.Fprintf(w, "%s %s\n", f.series(f.name, s.labels), formatFloat(s.value))
+	}
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+
+	mx     sync.Mutex
+	values map[string]*histogram
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers histogram in the default registry.
+// If buckets is nil, then DefaultBuckets are used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec creates and registers histogram in the registry.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{
+		desc:    desc{name, help, "histogram", labels},
+		buckets: append([]float64(nil), buckets...),
+		values:  make(map[string]*histogram),
+	}
+	sort.Float64s(h.buckets)
+	r.register(name, h)
+	return h
+}
+
+// Observe adds observation v to histogram with given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	s, ok := h.values[key]
+	if !ok {
+		s = &histogram{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = s
+	}
+	for i, le := range h.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.writeHeader(w)
+
+	keys := make([]string, 0, len(h.values))
+	for key := range h.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.values[key]
+		for i, le := range h.buckets {
+			fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", s.labels, "le", formatFloat(le)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_bucket", s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s %s\n", h.series(h.name+"_sum", s.labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.series(h.name+"_count", s.labels), s.count)
+	}
+}
+
+func sortedSamples(samples map[string]*sample) []*sample {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*sample, len(keys))
+	for i, key := range keys {
+		sorted[i] = samples[key]
+	}
+	return sorted
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
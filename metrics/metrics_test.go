@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("nfr_events_sent_total", "Events sent.", "type")
+	c.Inc("dns")
+	c.Add(2, "dns")
+	c.Add(5, "ip")
+	c.Add(-1, "ip")
+
+	g := r.NewGaugeVec("nfr_lag_seconds", "Lag.", "search")
+	g.Set(1.5, `a"b`)
+	g.Set(2.5, `a"b`)
+
+	r.NewGaugeFunc("nfr_buffer_events", "Buffered events.", []string{"type"}, func(set func(float64, ...string)) {
+		set(3, "ip")
+		set(7, "dns")
+	})
+
+	h := r.NewHistogramVec("nfr_api_duration_seconds", "Latency.", []float64{0.1, 1}, "endpoint")
+	h.Observe(0.05, "alerts")
+	h.Observe(0.5, "alerts")
+	h.Observe(3, "alerts")
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP nfr_api_duration_seconds Latency.
+# TYPE nfr_api_duration_seconds histogram
+nfr_api_duration_seconds_bucket{endpoint="alerts",le="0.1"} 1
+nfr_api_duration_seconds_bucket{endpoint="alerts",le="1"} 2
+nfr_api_duration_seconds_bucket{endpoint="alerts",le="+Inf"} 3
+nfr_api_duration_seconds_sum{endpoint="alerts"} 3.55
+nfr_api_duration_seconds_count{endpoint="alerts"} 3
+# HELP nfr_buffer_events Buffered events.
+# TYPE nfr_buffer_events gauge
+nfr_buffer_events{type="dns"} 7
+nfr_buffer_events{type="ip"} 3
+# HELP nfr_events_sent_total Events sent.
+# TYPE nfr_events_sent_total counter
+nfr_events_sent_total{type="dns"} 3
+nfr_events_sent_total{type="ip"} 5
+# HELP nfr_lag_seconds Lag.
+# TYPE nfr_lag_seconds gauge
+nfr_lag_seconds{search="a\"b"} 2.5
+`
+	if got := buf.String(); got != expected {
+		t.Fatalf("invalid metrics:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("nfr_test_total", "Test.").Inc()
+	r.NewCounterFunc("nfr_test_func_total", "Test.", nil, func(set func(float64, ...string)) {
+		set(2)
+	})
+
+	w := httptest.NewRecorder()
+	Handler(r).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("invalid content type %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "\nnfr_test_total 1\n") {
+		t.Fatalf("counter without labels not written:\n%s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "# TYPE nfr_test_func_total counter\nnfr_test_func_total 2\n") {
+		t.Fatalf("counter func not written:\n%s", w.Body.String())
+	}
+}
+
+func TestRegistryDuplicated(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering duplicated metric must panic")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounterVec("nfr_test_total", "Test.")
+	r.NewGaugeVec("nfr_test_total", "Test.")
+}
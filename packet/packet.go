@@ -170,6 +170,58 @@ func NewDNSPacket(raw gopacket.Packet) *DNSPacket {
 	return dnspacket
 }
 
+// DNSResponse represents single dns response. Only fields
+// required by local dns analytics are kept.
+type DNSResponse struct {
+	Timestamp  time.Time
+	ClientIP   net.IP
+	FQDN       string
+	RecordType string
+	NXDomain   bool
+	// Addresses from A and AAAA answers.
+	IPs []net.IP
+}
+
+// NewDNSResponse creates new dns response from raw packet.
+func NewDNSResponse(raw gopacket.Packet) *DNSResponse {
+	var (
+		metadata         = raw.Metadata()
+		networkLayer     = raw.NetworkLayer()
+		applicationLayer = raw.ApplicationLayer()
+	)
+
+	if metadata == nil || networkLayer == nil || applicationLayer == nil {
+		return nil
+	}
+
+	dns, ok := applicationLayer.(gopacket.Layer).(*layers.DNS)
+	if !ok || !dns.QR || len(dns.Questions) == 0 {
+		return nil
+	}
+
+	var response = &DNSResponse{
+		Timestamp:  metadata.Timestamp,
+		RecordType: dns.Questions[0].Type.String(),
+		FQDN:       string(dns.Questions[0].Name),
+		NXDomain:   dns.ResponseCode == layers.DNSResponseCodeNXDomain,
+	}
+	for _, answer := range dns.Answers {
+		if answer.Type == layers.DNSTypeA || answer.Type == layers.DNSTypeAAAA {
+			response.IPs = append(response.IPs, answer.IP)
+		}
+	}
+
+	if lipv4, ok := networkLayer.(gopacket.Layer).(*layers.IPv4); ok {
+		response.ClientIP = lipv4.DstIP
+	} else if lipv6, ok := networkLayer.(gopacket.Layer).(*layers.IPv6); ok {
+		response.ClientIP = lipv6.DstIP
+	} else {
+		return nil
+	}
+
+	return response
+}
+
 func (p *DNSPacket) String() string {
 	return fmt.Sprintf("%s %s from %s to %s", p.FQDN, p.RecordType, p.SrcIP, p.DstIP)
 }
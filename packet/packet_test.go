@@ -43,6 +43,33 @@ func TestDNSPacketEqual(t *testing.T) {
 	require.True(t, packet.Equal(packet), "not equal with itself")
 }
 
+func TestNewDNSResponse(t *testing.T) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IPv4(8, 8, 8, 8), DstIP: net.IPv4(10, 0, 2, 15)}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 13705}
+	udp.SetNetworkLayerForChecksum(ip)
+	dns := &layers.DNS{ID: 1, QR: true, ResponseCode: layers.DNSResponseCodeNXDomain,
+		Questions: []layers.DNSQuestion{{Name: []byte("x.alphasoc.net"), Type: layers.DNSTypeTXT, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{{Name: []byte("x.alphasoc.net"), Type: layers.DNSTypeA,
+			Class: layers.DNSClassIN, IP: net.IPv4(1, 2, 3, 4).To4()}}}
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, &layers.Ethernet{EthernetType: layers.EthernetTypeIPv4,
+		SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}}, ip, udp, dns))
+
+	rawPacket := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	response := NewDNSResponse(rawPacket)
+	require.NotNil(t, response)
+	require.Equal(t, "x.alphasoc.net", response.FQDN, "invalid fqdn")
+	require.Equal(t, "TXT", response.RecordType, "invalid record type")
+	require.True(t, response.NXDomain, "nxdomain not set")
+	require.True(t, net.IPv4(10, 0, 2, 15).Equal(response.ClientIP), "invalid client ip")
+	require.Len(t, response.IPs, 1, "invalid number of answers")
+	require.True(t, net.IPv4(1, 2, 3, 4).Equal(response.IPs[0]), "invalid answer ip")
+
+	require.Nil(t, NewDNSResponse(gopacket.NewPacket(testPacketDNSQuery, layers.LinkTypeEthernet, gopacket.Default)))
+}
+
 func TestNewIPPacket(t *testing.T) {
 	rawPacket := gopacket.NewPacket(testPacketDNSQuery, layers.LinkTypeEthernet, gopacket.Default)
 	packet := NewIPPacket(rawPacket)
@@ -0,0 +1,456 @@
+// Package response turns alerts from AlphaSOC Engine into blocklists
+// consumable by resolvers and firewalls.
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/matchers"
+	"github.com/alphasoc/nfr/utils"
+)
+
+// Supported blocklist formats.
+const (
+	FormatRPZ      = "rpz"
+	FormatNftables = "nftables"
+	FormatIPSet    = "ipset"
+	FormatPlain    = "plain"
+)
+
+// Config for the blocklist.
+type Config struct {
+	// File the blocklist is rendered to.
+	File string
+	// Format of the rendered file, one of rpz, nftables, ipset or plain.
+	Format string
+	// MinSeverity is the lowest threat severity that causes blocking.
+	MinSeverity int
+	// Expiry is the time after the last alert when the entry is removed.
+	// Zero means entries never expire.
+	Expiry time.Duration
+	// AllowedDomains are never blocked; *. prefix matches subdomains.
+	AllowedDomains []string
+	// AllowedIPs are ip addresses or cidrs that are never blocked.
+	AllowedIPs []string
+	// Zone is the origin of the rpz zone.
+	Zone string
+	// SetName is the name of nftables or ipset set.
+	SetName string
+	// Hook is a command run after blocklist updates. It's run in background,
+	// updates made while it's running trigger a single next run.
+	Hook string
+	// StateFile keeps blocklist entries between restarts.
+	StateFile string
+}
+
+// Entry is a single blocked domain or ip.
+type Entry struct {
+	Value     string    `json:"value"`
+	IsIP      bool      `json:"ip,omitempty"`
+	Threats   []string  `json:"threats"`
+	Severity  int       `json:"severity"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Blocklist keeps alerted domains and destination ips and
+// implements alerts.Writer interface.
+type Blocklist struct {
+	cfg Config
+
+	allowedDomains *matchers.Domain
+	allowedIPs     []*net.IPNet
+
+	mx      sync.Mutex
+	entries map[string]*Entry
+	serial  uint32
+
+	// hookMx guards state of the hook run in background.
+	hookMx      sync.Mutex
+	hookRunning bool
+	hookPending bool
+	hooks       sync.WaitGroup
+
+	// now is used in tests.
+	now func() time.Time
+}
+
+// NewBlocklist creates new blocklist and loads its state if state file exists.
+// Expired entries of the state are removed and the blocklist file is rendered,
+// so the file is up to date before new alerts come.
+func NewBlocklist(cfg Config) (*Blocklist, error) {
+	switch cfg.Format {
+	case FormatRPZ, FormatNftables, FormatIPSet, FormatPlain:
+	default:
+		return nil, fmt.Errorf("unsupported blocklist format %s", cfg.Format)
+	}
+
+	dm, err := matchers.NewDomain(cfg.AllowedDomains)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Blocklist{
+		cfg:            cfg,
+		allowedDomains: dm,
+		entries:        make(map[string]*Entry),
+		now:            time.Now,
+	}
+
+	for _, s := range cfg.AllowedIPs {
+		ipnet, err := parseIPOrCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		b.allowedIPs = append(b.allowedIPs, ipnet)
+	}
+
+	if err := b.loadState(); err != nil {
+		return nil, err
+	}
+	b.expire()
+	if err := b.update(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write adds event domain or destination ip to the blocklist and
+// renders the blocklist file if it has changed.
+func (b *Blocklist) Write(event *alerts.Event) error {
+	if event.Severity < b.cfg.MinSeverity {
+		return nil
+	}
+
+	var (
+		domain string
+		ip     net.IP
+	)
+	switch event.EventType {
+	case "dns":
+		domain = strings.ToLower(strings.TrimSuffix(event.Query, "."))
+	case "http":
+		domain = hostFromURL(event.URL)
+	case "ip", "tls":
+		ip = event.DestIP
+	}
+
+	if ip == nil && domain != "" {
+		// http urls may point to an ip instead of a domain
+		ip = net.ParseIP(domain)
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var added bool
+	switch {
+	case ip != nil:
+		if b.isIPAllowed(ip) {
+			return nil
+		}
+		added = b.add(ip.String(), true, event)
+	case domain != "":
+		if b.allowedDomains.Match(domain) {
+			return nil
+		}
+		added = b.add(domain, false, event)
+	default:
+		return nil
+	}
+
+	if added {
+		return b.update()
+	}
+	// refreshed entries only change the state, not the rendered list
+	if err := b.saveState(); err != nil {
+		log.Warnf("saving blocklist state failed: %s", err)
+	}
+	return nil
+}
+
+// Expire removes expired entries and renders the blocklist file if any
+// entry was removed.
+func (b *Blocklist) Expire() error {
+	if b.cfg.Expiry <= 0 {
+		return nil
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if !b.expire() {
+		return nil
+	}
+	return b.update()
+}
+
+// expire removes expired entries. It returns true if any entry was removed.
+func (b *Blocklist) expire() bool {
+	if b.cfg.Expiry <= 0 {
+		return false
+	}
+
+	var changed bool
+	deadline := b.now().Add(-b.cfg.Expiry)
+	for k, e := range b.entries {
+		if e.LastSeen.Before(deadline) {
+			delete(b.entries, k)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Entries returns sorted copy of blocklist entries.
+func (b *Blocklist) Entries() []Entry {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.sortedEntries()
+}
+
+// add adds or refreshes entry. It returns true if the entry was added,
+// so the rendered blocklist content has changed.
+func (b *Blocklist) add(value string, isIP bool, event *alerts.Event) bool {
+	now := b.now()
+	e, ok := b.entries[value]
+	if !ok {
+		e = &Entry{Value: value, IsIP: isIP, FirstSeen: now}
+		b.entries[value] = e
+	}
+	e.LastSeen = now
+	if event.Severity > e.Severity {
+		e.Severity = event.Severity
+	}
+	for tid := range event.Threats {
+		if !utils.StringsContains(e.Threats, tid) {
+			e.Threats = append(e.Threats, tid)
+		}
+	}
+	sort.Strings(e.Threats)
+	return !ok
+}
+
+// update renders the blocklist file, saves the state and triggers the hook.
+func (b *Blocklist) update() error {
+	entries := b.sortedEntries()
+
+	var content []byte
+	switch b.cfg.Format {
+	case FormatRPZ:
+		b.bumpSerial()
+		content = renderRPZ(b.cfg.Zone, b.serial, entries)
+	case FormatNftables:
+		content = renderNftables(b.cfg.SetName, entries)
+	case FormatIPSet:
+		content = renderIPSet(b.cfg.SetName, entries)
+	case FormatPlain:
+		content = renderPlain(entries)
+	}
+
+	if err := writeFileAtomic(b.cfg.File, content); err != nil {
+		return fmt.Errorf("writing blocklist: %s", err)
+	}
+	log.Infof("blocklist %s updated with %d entries", b.cfg.File, len(entries))
+
+	if err := b.saveState(); err != nil {
+		log.Warnf("saving blocklist state failed: %s", err)
+	}
+
+	b.triggerHook()
+	return nil
+}
+
+// triggerHook runs the hook in background, so a slow hook doesn't block
+// writing alerts. If the hook is running, it's run once more after,
+// however many updates were made in the meantime.
+func (b *Blocklist) triggerHook() {
+	if b.cfg.Hook == "" {
+		return
+	}
+
+	b.hookMx.Lock()
+	defer b.hookMx.Unlock()
+	if b.hookRunning {
+		b.hookPending = true
+		return
+	}
+	b.hookRunning = true
+	b.hooks.Add(1)
+	go func() {
+		defer b.hooks.Done()
+		for {
+			if err := b.runHook(); err != nil {
+				log.Warn(err)
+			}
+
+			b.hookMx.Lock()
+			if !b.hookPending {
+				b.hookRunning = false
+				b.hookMx.Unlock()
+				return
+			}
+			b.hookPending = false
+			b.hookMx.Unlock()
+		}
+	}()
+}
+
+// bumpSerial increments soa serial. The serial is based on current time,
+// so it keeps growing after restarts.
+func (b *Blocklist) bumpSerial() {
+	serial := uint32(b.now().Unix())
+	if serial <= b.serial {
+		serial = b.serial + 1
+	}
+	b.serial = serial
+}
+
+// runHook runs configured hook command.
+func (b *Blocklist) runHook() error {
+	args := strings.Fields(b.cfg.Hook)
+	if len(args) == 0 {
+		return nil
+	}
+
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("blocklist hook %s failed: %s: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (b *Blocklist) isIPAllowed(ip net.IP) bool {
+	for _, n := range b.allowedIPs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Blocklist) sortedEntries() []Entry {
+	entries := make([]Entry, 0, len(b.entries))
+	for _, e := range b.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Value < entries[j].Value
+	})
+	return entries
+}
+
+// blocklistState is the state stored in the state file.
+type blocklistState struct {
+	Serial  uint32   `json:"serial"`
+	Entries []*Entry `json:"entries"`
+}
+
+func (b *Blocklist) loadState() error {
+	if b.cfg.StateFile == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(b.cfg.StateFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state blocklistState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Warnf("corrupted blocklist state: %s", err)
+		return nil
+	}
+
+	b.serial = state.Serial
+	for _, e := range state.Entries {
+		b.entries[e.Value] = e
+	}
+	return nil
+}
+
+func (b *Blocklist) saveState() error {
+	if b.cfg.StateFile == "" {
+		return nil
+	}
+
+	state := blocklistState{Serial: b.serial}
+	for _, e := range b.entries {
+		state.Entries = append(state.Entries, e)
+	}
+
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.cfg.StateFile, data)
+}
+
+// writeFileAtomic writes data to temporary file and renames it, so
+// consumers never read partially written file.
+func writeFileAtomic(file string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// hostFromURL returns lower case host of the url without port.
+func hostFromURL(rawurl string) string {
+	if !strings.Contains(rawurl, "://") {
+		rawurl = "http://" + rawurl
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// parseIPOrCIDR parses single ip or cidr into network.
+func parseIPOrCIDR(s string) (*net.IPNet, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not cidr or ip", s)
+	}
+	return ipnet, nil
+}
@@ -0,0 +1,296 @@
+package response
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+)
+
+func newTestBlocklist(t *testing.T, cfg Config) (*Blocklist, func()) {
+	dir, err := ioutil.TempDir("", "nfr-blocklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.File = filepath.Join(dir, "blocklist")
+	cfg.StateFile = filepath.Join(dir, "blocklist.state")
+
+	b, err := NewBlocklist(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return b, func() { os.RemoveAll(dir) }
+}
+
+func dnsEvent(query string, severity int) *alerts.Event {
+	return &alerts.Event{
+		EventType:    "dns",
+		Severity:     severity,
+		Threats:      map[string]alerts.Threat{"c2_communication": {Severity: severity}},
+		EventUnified: client.EventUnified{Query: query},
+	}
+}
+
+func ipEvent(ip net.IP, severity int) *alerts.Event {
+	return &alerts.Event{
+		EventType:    "ip",
+		Severity:     severity,
+		Threats:      map[string]alerts.Threat{"c2_communication": {Severity: severity}},
+		EventUnified: client.EventUnified{DestIP: ip},
+	}
+}
+
+func values(entries []Entry) []string {
+	var s []string
+	for _, e := range entries {
+		s = append(s, e.Value)
+	}
+	return s
+}
+
+func TestBlocklistWrite(t *testing.T) {
+	b, cleanup := newTestBlocklist(t, Config{
+		Format:         FormatPlain,
+		MinSeverity:    3,
+		AllowedDomains: []string{"*.example.com"},
+		AllowedIPs:     []string{"10.0.0.0/8"},
+	})
+	defer cleanup()
+
+	events := []*alerts.Event{
+		dnsEvent("evil.com.", 4),
+		dnsEvent("low.com", 2),
+		dnsEvent("www.example.com", 5),
+		ipEvent(net.IPv4(1, 2, 3, 4), 3),
+		ipEvent(net.IPv4(10, 1, 1, 1), 5),
+		{
+			EventType:    "http",
+			Severity:     5,
+			EventUnified: client.EventUnified{URL: "http://Bad.org:8080/a/b"},
+		},
+	}
+	for _, ev := range events {
+		if err := b.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := "1.2.3.4,bad.org,evil.com"
+	if got := strings.Join(values(b.Entries()), ","); got != expected {
+		t.Fatalf("invalid entries - got %s; expected %s", got, expected)
+	}
+
+	content, err := ioutil.ReadFile(b.cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "1.2.3.4\nbad.org\nevil.com\n" {
+		t.Fatalf("invalid blocklist file content %q", content)
+	}
+}
+
+func TestBlocklistExpire(t *testing.T) {
+	b, cleanup := newTestBlocklist(t, Config{Format: FormatPlain, Expiry: time.Hour})
+	defer cleanup()
+
+	now := time.Now()
+	b.now = func() time.Time { return now }
+	b.Write(dnsEvent("old.com", 5))
+
+	now = now.Add(30 * time.Minute)
+	b.Write(dnsEvent("new.com", 5))
+
+	now = now.Add(45 * time.Minute)
+	if err := b.Expire(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(values(b.Entries()), ","); got != "new.com" {
+		t.Fatalf("invalid entries after expiry - got %s; expected %s", got, "new.com")
+	}
+}
+
+func TestBlocklistState(t *testing.T) {
+	b, cleanup := newTestBlocklist(t, Config{Format: FormatRPZ})
+	defer cleanup()
+
+	b.Write(dnsEvent("evil.com", 5))
+	b.Write(dnsEvent("evil.org", 5))
+
+	b2, err := NewBlocklist(b.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(values(b2.Entries()), ","); got != "evil.com,evil.org" {
+		t.Fatalf("invalid entries loaded from state - got %s", got)
+	}
+	// the list is rendered on start with bumped serial
+	if b2.serial <= b.serial {
+		t.Fatalf("invalid serial loaded from state - got %d; expected more than %d", b2.serial, b.serial)
+	}
+}
+
+func TestBlocklistStateExpired(t *testing.T) {
+	b, cleanup := newTestBlocklist(t, Config{Format: FormatPlain, Expiry: time.Hour})
+	defer cleanup()
+
+	now := time.Now()
+	b.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	b.Write(dnsEvent("old.com", 5))
+	b.now = func() time.Time { return now }
+	b.Write(dnsEvent("new.com", 5))
+
+	// stale list rendered by other process
+	if err := ioutil.WriteFile(b.cfg.File, []byte("stale.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b2, err := NewBlocklist(b.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(values(b2.Entries()), ","); got != "new.com" {
+		t.Fatalf("expired entries loaded from state - got %s", got)
+	}
+	content, err := ioutil.ReadFile(b.cfg.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "new.com\n" {
+		t.Fatalf("blocklist not rendered on start - got %q", content)
+	}
+}
+
+func TestBlocklistHook(t *testing.T) {
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs")
+	gate := filepath.Join(dir, "gate")
+	script := filepath.Join(dir, "hook.sh")
+	// hook is blocked until the gate file is created
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\nwhile [ ! -f "+gate+" ]; do sleep 0.01; done\necho run >> "+runs+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, cleanup := newTestBlocklist(t, Config{Format: FormatPlain, Hook: script})
+	defer cleanup()
+
+	written := make(chan error, 1)
+	go func() {
+		for _, domain := range []string{"a.com", "b.com", "c.com", "d.com"} {
+			if err := b.Write(dnsEvent(domain, 5)); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- nil
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		ioutil.WriteFile(gate, nil, 0644)
+		t.Fatal("hook must not block writing alerts")
+	}
+
+	if err := ioutil.WriteFile(gate, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	b.hooks.Wait()
+
+	content, err := ioutil.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// run on start, then updates while running are coalesced into one run
+	if n := strings.Count(string(content), "run"); n != 2 {
+		t.Fatalf("invalid number of hook runs - got %d; expected %d", n, 2)
+	}
+}
+
+func TestBlocklistSerialBump(t *testing.T) {
+	b, cleanup := newTestBlocklist(t, Config{Format: FormatRPZ})
+	defer cleanup()
+
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.Write(dnsEvent("a.com", 5))
+	serial := b.serial
+	b.Write(dnsEvent("b.com", 5))
+	if b.serial <= serial {
+		t.Fatalf("serial not bumped - got %d; previous %d", b.serial, serial)
+	}
+}
+
+func TestNewBlocklistInvalid(t *testing.T) {
+	if _, err := NewBlocklist(Config{Format: "hosts"}); err == nil {
+		t.Fatal("expected unsupported format error")
+	}
+	if _, err := NewBlocklist(Config{Format: FormatPlain, AllowedIPs: []string{"x"}}); err == nil {
+		t.Fatal("expected invalid allowed ip error")
+	}
+}
+
+func TestRenderRPZ(t *testing.T) {
+	entries := []Entry{
+		{Value: "1.2.3.4", IsIP: true},
+		{Value: "2001:db8::1", IsIP: true},
+		{Value: "evil.com"},
+	}
+
+	content := string(renderRPZ("rpz.nfr", 7, entries))
+	for _, line := range []string{
+		"$ORIGIN rpz.nfr.",
+		"@ IN SOA localhost. root.localhost. 7 3600 600 86400 60",
+		"32.4.3.2.1.rpz-ip CNAME .",
+		"128.1.0.0.0.0.0.db8.2001.rpz-ip CNAME .",
+		"evil.com CNAME .",
+		"*.evil.com CNAME .",
+	} {
+		if !strings.Contains(content, line+"\n") {
+			t.Fatalf("missing %q in rpz zone:\n%s", line, content)
+		}
+	}
+}
+
+func TestRenderSets(t *testing.T) {
+	entries := []Entry{
+		{Value: "1.2.3.4", IsIP: true},
+		{Value: "2001:db8::1", IsIP: true},
+		{Value: "evil.com"},
+	}
+
+	nft := string(renderNftables("nfr", entries))
+	for _, line := range []string{
+		"flush set inet nfr nfr_v4",
+		"add element inet nfr nfr_v4 { 1.2.3.4 }",
+		"add element inet nfr nfr_v6 { 2001:db8::1 }",
+	} {
+		if !strings.Contains(nft, line+"\n") {
+			t.Fatalf("missing %q in nftables file:\n%s", line, nft)
+		}
+	}
+
+	ipset := string(renderIPSet("nfr", entries))
+	for _, line := range []string{
+		"create nfr_v4 hash:ip family inet -exist",
+		"add nfr_v4 1.2.3.4",
+		"add nfr_v6 2001:db8::1",
+	} {
+		if !strings.Contains(ipset, line+"\n") {
+			t.Fatalf("missing %q in ipset file:\n%s", line, ipset)
+		}
+	}
+	if strings.Contains(ipset, "evil.com") || strings.Contains(nft, "evil.com") {
+		t.Fatal("domains must not be rendered into ip sets")
+	}
+}
@@ -0,0 +1,131 @@
+package response
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alphasoc/nfr/version"
+)
+
+// header returns comment line put on top of rendered files.
+func header(comment string) string {
+	return fmt.Sprintf("%s generated by nfr %s, do not edit\n", comment, version.Version)
+}
+
+// renderRPZ renders entries as a response policy zone. Domains are blocked
+// together with their subdomains and ips are blocked with rpz-ip triggers.
+func renderRPZ(zone string, serial uint32, entries []Entry) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(header(";"))
+	if zone != "" {
+		fmt.Fprintf(&buf, "$ORIGIN %s.\n", strings.TrimSuffix(zone, "."))
+	}
+	buf.WriteString("$TTL 60\n")
+	fmt.Fprintf(&buf, "@ IN SOA localhost. root.localhost. %d 3600 600 86400 60\n", serial)
+	buf.WriteString("@ IN NS localhost.\n")
+
+	for _, e := range entries {
+		if e.IsIP {
+			if trigger := rpzIPTrigger(net.ParseIP(e.Value)); trigger != "" {
+				fmt.Fprintf(&buf, "%s CNAME .\n", trigger)
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%s CNAME .\n", e.Value)
+		fmt.Fprintf(&buf, "*.%s CNAME .\n", e.Value)
+	}
+	return buf.Bytes()
+}
+
+// rpzIPTrigger returns rpz-ip owner name for single ip address, e.g.
+// 32.4.3.2.1.rpz-ip for 1.2.3.4.
+func rpzIPTrigger(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("32.%d.%d.%d.%d.rpz-ip", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+
+	ip16 := ip.To16()
+	labels := []string{"128"}
+	for i := len(ip16) - 2; i >= 0; i -= 2 {
+		labels = append(labels, fmt.Sprintf("%x", uint16(ip16[i])<<8|uint16(ip16[i+1])))
+	}
+	return strings.Join(labels, ".") + ".rpz-ip"
+}
+
+// renderNftables renders nft script that replaces set elements.
+// The script is loaded with nft -f.
+func renderNftables(setName string, entries []Entry) []byte {
+	var buf bytes.Buffer
+
+	v4, v6 := splitIPs(entries)
+
+	buf.WriteString(header("#"))
+	buf.WriteString("add table inet nfr\n")
+	fmt.Fprintf(&buf, "add set inet nfr %s_v4 { type ipv4_addr; }\n", setName)
+	fmt.Fprintf(&buf, "add set inet nfr %s_v6 { type ipv6_addr; }\n", setName)
+	fmt.Fprintf(&buf, "flush set inet nfr %s_v4\n", setName)
+	fmt.Fprintf(&buf, "flush set inet nfr %s_v6\n", setName)
+	if len(v4) > 0 {
+		fmt.Fprintf(&buf, "add element inet nfr %s_v4 { %s }\n", setName, strings.Join(v4, ", "))
+	}
+	if len(v6) > 0 {
+		fmt.Fprintf(&buf, "add element inet nfr %s_v6 { %s }\n", setName, strings.Join(v6, ", "))
+	}
+	return buf.Bytes()
+}
+
+// renderIPSet renders ipset restore file that replaces set members.
+func renderIPSet(setName string, entries []Entry) []byte {
+	var buf bytes.Buffer
+
+	v4, v6 := splitIPs(entries)
+
+	buf.WriteString(header("#"))
+	fmt.Fprintf(&buf, "create %s_v4 hash:ip family inet -exist\n", setName)
+	fmt.Fprintf(&buf, "create %s_v6 hash:ip family inet6 -exist\n", setName)
+	fmt.Fprintf(&buf, "flush %s_v4\n", setName)
+	fmt.Fprintf(&buf, "flush %s_v6\n", setName)
+	for _, ip := range v4 {
+		fmt.Fprintf(&buf, "add %s_v4 %s\n", setName, ip)
+	}
+	for _, ip := range v6 {
+		fmt.Fprintf(&buf, "add %s_v6 %s\n", setName, ip)
+	}
+	return buf.Bytes()
+}
+
+// renderPlain renders one domain or ip per line.
+func renderPlain(entries []Entry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		buf.WriteString(e.Value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// splitIPs returns ipv4 and ipv6 entries. Domains are skipped.
+func splitIPs(entries []Entry) (v4 []string, v6 []string) {
+	for _, e := range entries {
+		if !e.IsIP {
+			continue
+		}
+		ip := net.ParseIP(e.Value)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			v4 = append(v4, e.Value)
+		} else {
+			v6 = append(v6, e.Value)
+		}
+	}
+	return v4, v6
+}
@@ -61,3 +61,19 @@ func (s *PcapSniffer) Packets() chan gopacket.Packet {
 func (s *PcapSniffer) Close() {
 	s.handle.Close()
 }
+
+// Stats are capture statistics of the sniffer.
+type Stats struct {
+	Received  int // packets received
+	Dropped   int // packets dropped because of buffer overflow
+	IfDropped int // packets dropped by the network interface
+}
+
+// Stats returns capture statistics of the sniffer.
+func (s *PcapSniffer) Stats() (Stats, error) {
+	stats, err := s.handle.Stats()
+	if err != nil {
+		return Stats{}, err
+	}
+	return Stats{stats.PacketsReceived, stats.PacketsDropped, stats.PacketsIfDropped}, nil
+}
@@ -0,0 +1,232 @@
+// Package status reports health, readiness and status of running nfr.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// State of a check. Values are exit codes of Nagios plugins.
+type State int
+
+// States of checks, from the best to the worst.
+const (
+	OK State = iota
+	Warning
+	Critical
+	Unknown
+)
+
+var stateNames = []string{"ok", "warning", "critical", "unknown"}
+
+// String returns name of the state.
+func (s State) String() string {
+	if s < OK || s > Unknown {
+		return stateNames[Unknown]
+	}
+	return stateNames[s]
+}
+
+// MarshalJSON marshals state as its name.
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON unmarshals state from its name.
+func (s *State) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	for i, n := range stateNames {
+		if n == name {
+			*s = State(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid state %s", name)
+}
+
+// Check is a result of a single health check.
+type Check struct {
+	Name    string `json:"name"`
+	State   State  `json:"state"`
+	Message string `json:"message"`
+}
+
+// Report is a status of running nfr.
+type Report struct {
+	Time    time.Time `json:"time"`
+	Started time.Time `json:"started"`
+	// Live is false if nfr is stuck and should be restarted.
+	Live bool `json:"live"`
+	// Ready is false if nfr can't process events, e.g. api key is invalid.
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+
+	Tenants  []Tenant  `json:"tenants"`
+	Sniffer  *Sniffer  `json:"sniffer,omitempty"`
+	Monitors []Monitor `json:"monitors,omitempty"`
+	Searches []Search  `json:"elastic_searches,omitempty"`
+}
+
+// Tenant is a status of AlphaSOC Engine account events are sent to.
+// The default tenant has an empty name.
+type Tenant struct {
+	Name string `json:"name"`
+	// KeyValid is nil until the api key is used.
+	KeyValid  *bool                `json:"key_valid"`
+	KeyError  string               `json:"key_error,omitempty"`
+	LastSend  map[string]time.Time `json:"last_send,omitempty"`
+	SendError map[string]string    `json:"send_error,omitempty"`
+	LastPoll  time.Time            `json:"last_poll,omitempty"`
+	PollError string               `json:"poll_error,omitempty"`
+}
+
+// Sniffer is a status of the network sniffer.
+type Sniffer struct {
+	Interface string `json:"interface"`
+	Open      bool   `json:"open"`
+}
+
+// Monitor is a status of a monitored log file.
+type Monitor struct {
+	File   string `json:"file"`
+	Type   string `json:"type"`
+	Format string `json:"format"`
+	Open   bool   `json:"open"`
+	Offset int64  `json:"offset"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Search is a status of elasticsearch search.
+type Search struct {
+	Name       string    `json:"name"`
+	Checkpoint time.Time `json:"checkpoint"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// State returns the worst state of report checks.
+func (r *Report) State() State {
+	state := OK
+	for _, c := range r.Checks {
+		if c.State > state {
+			state = c.State
+		}
+	}
+	return state
+}
+
+// WriteSummary writes human readable summary of the report,
+// starting with the overall state, followed by all checks.
+func (r *Report) WriteSummary(w io.Writer) error {
+	live, ready := "live", "ready"
+	if !r.Live {
+		live = "not live"
+	}
+	if !r.Ready {
+		ready = "not ready"
+	}
+	fmt.Fprintf(w, "NFR %s: %s, %s, up %s\n", strings.ToUpper(r.State().String()),
+		live, ready, r.Time.Sub(r.Started).Round(time.Second))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range r.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", strings.ToUpper(c.State.String()), c.Name, c.Message)
+	}
+	return tw.Flush()
+}
+
+// Register registers /healthz, /readyz and /status handlers in mux.
+// Liveness and readiness endpoints respond with 503 status code
+// and failed checks if nfr is not live or not ready.
+func Register(mux *http.ServeMux, report func() *Report) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		r := report()
+		writeProbe(w, r.Live, r.Checks)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		r := report()
+		writeProbe(w, r.Ready, r.Checks)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report())
+	})
+}
+
+func writeProbe(w http.ResponseWriter, ok bool, checks []Check) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if ok {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	for _, c := range checks {
+		if c.State == Critical {
+			fmt.Fprintf(w, "%s: %s\n", c.Name, c.Message)
+		}
+	}
+}
+
+// unixPrefix is a prefix of unix socket addresses.
+const unixPrefix = "unix:"
+
+// Listen listens on addr, host:port or unix:/path/to/socket.
+// Stale socket file left by previous run is removed.
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixPrefix) {
+		file := strings.TrimPrefix(addr, unixPrefix)
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", file)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Fetch gets status report from nfr listening on addr,
+// host:port or unix:/path/to/socket.
+func Fetch(ctx context.Context, addr string) (*Report, error) {
+	c := &http.Client{}
+	url := "http://" + addr + "/status"
+	if strings.HasPrefix(addr, unixPrefix) {
+		file := strings.TrimPrefix(addr, unixPrefix)
+		c.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", file)
+			},
+		}
+		url = "http://unix/status"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status response: %s", resp.Status)
+	}
+
+	var r Report
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("invalid status response: %s", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,87 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Report{
+		Time:    started.Add(time.Hour),
+		Started: started,
+		Live:    true,
+		Checks: []Check{
+			{Name: "api_key", State: OK, Message: "api key valid"},
+			{Name: "sniffer", State: Critical, Message: "sniffer on eth0 not open"},
+		},
+	}
+}
+
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, testReport)
+
+	for path, code := range map[string]int{
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+		"/status":  http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != code {
+			t.Errorf("%s: invalid status code - got %d; expected %d", path, w.Code, code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	if body := w.Body.String(); body != "sniffer: sniffer on eth0 not open\n" {
+		t.Fatalf("invalid readiness body %q", body)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, testReport)
+
+	for _, addr := range []string{"127.0.0.1:0", "unix:" + filepath.Join(t.TempDir(), "nfr.sock")} {
+		l, err := Listen(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go http.Serve(l, mux)
+		if !strings.HasPrefix(addr, unixPrefix) {
+			addr = l.Addr().String()
+		}
+
+		r, err := Fetch(context.Background(), addr)
+		l.Close()
+		if err != nil {
+			t.Fatalf("%s: %s", addr, err)
+		}
+		if r.State() != Critical || len(r.Checks) != 2 || r.Checks[1].Name != "sniffer" {
+			t.Fatalf("%s: invalid report %+v", addr, r)
+		}
+	}
+}
+
+func TestWriteSummary(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testReport().WriteSummary(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `NFR CRITICAL: live, not ready, up 1h0m0s
+OK        api_key  api key valid
+CRITICAL  sniffer  sniffer on eth0 not open
+`
+	if buf.String() != expected {
+		t.Fatalf("invalid summary:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}